@@ -1,6 +1,7 @@
 package awscli
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"strconv"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Octogonapus/S3Benchmark/benchmark"
+	"github.com/Octogonapus/S3Benchmark/target"
 	"github.com/Octogonapus/S3Benchmark/util"
 	"github.com/mitchellh/mapstructure"
 )
@@ -17,10 +19,15 @@ type AwsCliBenchmarkInput struct {
 }
 
 type bmark struct {
-	ctx  *benchmark.BenchmarkContext
-	name string
+	ctx        *benchmark.BenchmarkContext
+	name       string
+	envPrefix  string
+	cliArchive string // the AWS CLI release installed for the target's architecture
 }
 
+// The AWS CLI can only be told to use path-style addressing through its config file.
+const pathStyleConfigPath = "s3benchmark-aws-config"
+
 func init() {
 	benchmark.RegisterBenchmark("aws_cli", func(a map[string]any) (benchmark.Benchmark, error) {
 		input := &AwsCliBenchmarkInput{}
@@ -36,9 +43,20 @@ func NewAwsCliBenchmark(input *AwsCliBenchmarkInput) benchmark.Benchmark {
 	return &bmark{name: input.Name}
 }
 
+func (b *bmark) Clone() benchmark.Benchmark {
+	return &bmark{name: b.name}
+}
+
 func (b *bmark) GetCommand() (string, error) {
 	// TODO we should really be copying the objects and not the entire bucket here but for now it is okay
-	return fmt.Sprintf("time aws s3 cp --recursive %s %s", fmt.Sprintf("s3://%s", b.ctx.Bucket), b.ctx.Bucket), nil
+	cmd := fmt.Sprintf("aws s3 cp --recursive %s %s", fmt.Sprintf("s3://%s", b.ctx.Bucket), b.ctx.Bucket)
+	if b.ctx.Endpoint.URL != "" {
+		cmd += " --endpoint-url " + b.ctx.Endpoint.URL
+	}
+	if b.ctx.Endpoint.UsePathStyle {
+		cmd = fmt.Sprintf("env AWS_CONFIG_FILE=./%s %s", pathStyleConfigPath, cmd)
+	}
+	return "time " + b.envPrefix + cmd, nil
 }
 
 func (b *bmark) ParseCommandOutput(out []byte) (*benchmark.BenchmarkOutput, error) {
@@ -55,19 +73,28 @@ func (b *bmark) ParseCommandOutput(out []byte) (*benchmark.BenchmarkOutput, erro
 		return nil, fmt.Errorf("failed to parse total time: %w", err)
 	}
 
-	return &benchmark.BenchmarkOutput{TotalTimeSec: float64(totalTime)}, nil
+	// The AWS CLI doesn't report what it transferred, so assume it copied every object once
+	return &benchmark.BenchmarkOutput{
+		TotalTimeSec:     float64(totalTime),
+		BytesTransferred: b.ctx.TotalObjectBytes(),
+		ObjectCount:      len(b.ctx.Objects),
+	}, nil
+}
+
+func (b *bmark) Artifacts() []string {
+	return []string{b.cliArchive}
 }
 
-func (b *bmark) SetUp(ctx *benchmark.BenchmarkContext) error {
-	b.ctx = ctx
+func (b *bmark) SetUp(ctx context.Context, bctx *benchmark.BenchmarkContext) error {
+	b.ctx = bctx
 
 	var out []byte
 	var err error
 	for i := 0; i < 3; i++ {
-		out, err = b.ctx.Target.RunCommand("apt update -y && apt install -y unzip net-tools")
+		out, err = target.InstallPackages(ctx, b.ctx.Target, "unzip", "net-tools")
 		if err != nil {
 			slog.Debug("failed to install dependencies, will try again", slog.String("command output", string(out)), slog.String("error", err.Error()))
-			time.Sleep(30 * time.Second)
+			util.Sleep(ctx, 30*time.Second)
 		} else {
 			break
 		}
@@ -77,24 +104,44 @@ func (b *bmark) SetUp(ctx *benchmark.BenchmarkContext) error {
 		return err
 	}
 
-	out, err = b.ctx.Target.RunCommand("curl https://awscli.amazonaws.com/awscli-exe-linux-x86_64.zip -o awscliv2.zip")
+	// The AWS CLI names architectures as uname does
+	b.cliArchive = fmt.Sprintf("https://awscli.amazonaws.com/awscli-exe-linux-%s.zip", b.ctx.Arch)
+	out, err = b.ctx.Target.RunCommand(ctx, fmt.Sprintf("curl %s -o awscliv2.zip", b.cliArchive))
 	if err != nil {
 		slog.Error("failed to download the AWS CLI", slog.String("command output", string(out)), slog.String("error", err.Error()))
 		return err
 	}
 
-	out, err = b.ctx.Target.RunCommand("unzip awscliv2.zip")
+	out, err = b.ctx.Target.RunCommand(ctx, "unzip awscliv2.zip")
 	if err != nil {
 		slog.Error("failed to unzip the AWS CLI", slog.String("command output", string(out)), slog.String("error", err.Error()))
 		return err
 	}
 
-	out, err = b.ctx.Target.RunCommand("./aws/install")
+	out, err = b.ctx.Target.RunCommand(ctx, "./aws/install")
 	if err != nil {
 		slog.Error("failed to install the AWS CLI", slog.String("command output", string(out)), slog.String("error", err.Error()))
 		return err
 	}
 
+	b.envPrefix, err = benchmark.SetUpEndpointEnv(ctx, b.ctx)
+	if err != nil {
+		return err
+	}
+
+	if b.ctx.Endpoint.UsePathStyle {
+		config := "[default]\n"
+		if b.ctx.Region != "" {
+			config += fmt.Sprintf("region = %s\n", b.ctx.Region)
+		}
+		config += "s3 =\n    addressing_style = path\n"
+		err = b.ctx.Target.CopyFileTo(strings.NewReader(config), pathStyleConfigPath)
+		if err != nil {
+			slog.Error("failed to copy the AWS CLI config", slog.String("error", err.Error()))
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1,8 +1,10 @@
 package benchmark
 
 import (
+	"context"
 	"fmt"
 
+	objectprovider "github.com/Octogonapus/S3Benchmark/object_provider"
 	"github.com/Octogonapus/S3Benchmark/target"
 )
 
@@ -11,12 +13,25 @@ type BenchmarkContext struct {
 	DesiredThroughput float64
 	Bucket            string
 	Keys              []string
+	Objects           []*objectprovider.ObjectSpec // the same objects as Keys, with sizes
 	Region            string
+	Endpoint          objectprovider.S3Endpoint // AWS S3 by default
+	Arch              target.Arch               // detected by the runner if empty
+}
+
+// The total size of all the objects.
+func (ctx *BenchmarkContext) TotalObjectBytes() int64 {
+	var total int64
+	for _, obj := range ctx.Objects {
+		total += int64(obj.SizeBytes)
+	}
+	return total
 }
 
 type Benchmark interface {
-	// Set up the benchmark. May involve installing software or copying files.
-	SetUp(*BenchmarkContext) error
+	// Set up the benchmark. May involve installing software or copying files. Commands run on the target must be
+	// canceled with ctx.
+	SetUp(ctx context.Context, bctx *BenchmarkContext) error
 
 	// Return the command to run the benchmark. If the benchmark needs a warmup period, that must be included in
 	// this function (but do not report results from that period).
@@ -32,6 +47,55 @@ type Benchmark interface {
 	GetInput() map[string]any
 }
 
+// Benchmarks which put or delete objects must implement this so orchestrators can grant them write permissions.
+// Benchmarks which don't implement it are assumed to only read.
+type ObjectWriter interface {
+	WritesObjects() bool
+}
+
+func WritesObjects(b Benchmark) bool {
+	w, ok := b.(ObjectWriter)
+	return ok && w.WritesObjects()
+}
+
+// Benchmarks which install software built for the target's architecture should implement this so the report records
+// what they chose. Only called after SetUp.
+type ArtifactReporter interface {
+	// Returns the URLs or names of the architecture-specific software the benchmark installed.
+	Artifacts() []string
+}
+
+func ArtifactsOf(b Benchmark) []string {
+	if r, ok := b.(ArtifactReporter); ok {
+		return r.Artifacts()
+	}
+	return nil
+}
+
+// Benchmarks keep what SetUp did on its target (e.g. paths of copied files), so one benchmark can't be set up on
+// several targets at once. Benchmarks should implement this so orchestrators can give each target a fresh copy.
+type Cloner interface {
+	// Returns a benchmark with the same input which hasn't been set up.
+	Clone() Benchmark
+}
+
+// Returns a fresh copy of the benchmark for another target, or b and false if it can't be copied.
+func CloneOf(b Benchmark) (Benchmark, bool) {
+	if cb, ok := b.(*configuredBenchmark); ok {
+		inner, ok := CloneOf(cb.Benchmark)
+		if !ok {
+			return b, false
+		}
+		clone := *cb
+		clone.Benchmark = inner
+		return &clone, true
+	}
+	if c, ok := b.(Cloner); ok {
+		return c.Clone(), true
+	}
+	return b, false
+}
+
 type benchmarkType string
 
 type benchmarkFactory func(map[string]any) (Benchmark, error)
@@ -47,8 +111,15 @@ func RegisterBenchmark(btype string, f benchmarkFactory) {
 }
 
 type SerializedBenchmark struct {
-	Type  benchmarkType
-	Input map[string]any
+	Type     benchmarkType
+	Input    map[string]any
+	Matrix   map[string][]any `json:",omitempty"` // see ExpandSerializedBenchmark
+	Exclude  []map[string]any `json:",omitempty"`
+	Include  []map[string]any `json:",omitempty"`
+	Timeouts *Timeouts        `json:",omitempty"` // overrides the runner's default timeouts
+
+	// Runs the benchmark on these EC2 instance types instead of the orchestrator's. Ignored by other orchestrators.
+	InstanceTypes []string `json:",omitempty"`
 }
 
 type BenchmarkFile []SerializedBenchmark
@@ -65,5 +136,35 @@ func DeserializeBenchmark(sb *SerializedBenchmark) (Benchmark, error) {
 		return nil, fmt.Errorf("unknown benchmark type: %s", sb.Type)
 	}
 
-	return benchmarks[sb.Type](sb.Input)
+	b, err := benchmarks[sb.Type](sb.Input)
+	if err != nil {
+		return nil, err
+	}
+	if sb.Timeouts != nil || len(sb.InstanceTypes) > 0 {
+		cb := &configuredBenchmark{Benchmark: b, instanceTypes: sb.InstanceTypes}
+		if sb.Timeouts != nil {
+			cb.timeouts = *sb.Timeouts
+		}
+		b = cb
+	}
+	return b, nil
+}
+
+// Deserializes every benchmark in the file, expanding matrices.
+func DeserializeBenchmarkFile(bf BenchmarkFile) ([]Benchmark, error) {
+	out := []Benchmark{}
+	for _, sb := range bf {
+		expanded, err := ExpandSerializedBenchmark(&sb)
+		if err != nil {
+			return nil, err
+		}
+		for _, esb := range expanded {
+			b, err := DeserializeBenchmark(esb)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b)
+		}
+	}
+	return out, nil
 }
@@ -1,15 +1,20 @@
 package benchmark
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/netip"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/Octogonapus/S3Benchmark/profile"
 	"github.com/Octogonapus/S3Benchmark/report"
 	systemmonitor "github.com/Octogonapus/S3Benchmark/system_monitor"
+	"github.com/Octogonapus/S3Benchmark/target"
 )
 
 type benchmarkRunner struct {
@@ -20,52 +25,117 @@ type benchmarkRunner struct {
 	profilerKind   profile.ProfilerKind
 	profileSaveDir string
 	runs           int
+	timeouts       Timeouts
+	collectors     []string
+	sampleInterval time.Duration
+	accounting     *processAccounting
+	deadline       time.Time // when the whole benchmark times out. zero if it doesn't.
 }
 
 // Helps implement a benchmark orchestrator. Handles the system monitor and profiler.
 // Wrap each benchmark in this interface via NewBenchmarkRunner.
 type BenchmarkRunner interface {
 	// Set up the benchmark and supporting machinery (e.g. system monitor, profiler).
-	SetUp(ctx *BenchmarkContext, s3Prefixes []netip.Prefix) error
+	SetUp(ctx context.Context, bctx *BenchmarkContext, s3Prefixes []netip.Prefix) error
 
-	// Run the benchmark and supporting machinery.
-	Run() *report.BenchmarkReport
+	// Run the benchmark and supporting machinery. If ctx is canceled or a timeout fires, the benchmark is killed and
+	// the report holds the runs and system measurements from before that along with the error.
+	Run(ctx context.Context) *report.BenchmarkReport
 }
 
 type BenchmarkOutput struct {
-	TotalTimeSec float64
-	Metadata     []any
-	Input        map[string]any
+	TotalTimeSec       float64
+	BytesTransferred   int64 // total over every repeat the benchmark did internally
+	ObjectCount        int   // total over every repeat the benchmark did internally
+	RequestCount       int   // zero if the benchmark doesn't count its requests
+	Metadata           []any
+	Input              map[string]any
+	RequestRecordsPath string // optional. a file of request records on the target. see RequestRecord.
 }
 
-func NewBenchmarkRunner(b Benchmark, profilerKind profile.ProfilerKind, profileSaveDir string, runs int) BenchmarkRunner {
-	return &benchmarkRunner{b: b, profilerKind: profilerKind, profileSaveDir: profileSaveDir, runs: max(runs, 1)}
+type BenchmarkRunnerInput struct {
+	Benchmark      Benchmark
+	ProfilerKind   profile.ProfilerKind
+	ProfileSaveDir string
+	Runs           int           // number of times to run the benchmark. 1 = run the benchmark once. 1 by default.
+	Timeouts       Timeouts      // overridden by the benchmark's own timeouts (see TimeoutsOf)
+	Collectors     []string      // the system monitor's collectors. systemmonitor.DefaultCollectors if empty.
+	SampleInterval time.Duration // how often the system monitor samples the target. 1s by default.
 }
 
-func (br *benchmarkRunner) SetUp(ctx *BenchmarkContext, s3Prefixes []netip.Prefix) error {
+func NewBenchmarkRunner(input *BenchmarkRunnerInput) BenchmarkRunner {
+	return &benchmarkRunner{
+		b:              input.Benchmark,
+		profilerKind:   input.ProfilerKind,
+		profileSaveDir: input.ProfileSaveDir,
+		runs:           max(input.Runs, 1),
+		timeouts:       input.Timeouts.Override(TimeoutsOf(input.Benchmark)),
+		collectors:     input.Collectors,
+		sampleInterval: input.SampleInterval,
+		accounting:     newProcessAccounting(),
+	}
+}
+
+// Returns a context which is canceled when the whole benchmark times out.
+func (br *benchmarkRunner) withBenchmarkTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if br.deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadlineCause(ctx, br.deadline, &TimeoutError{Phase: "benchmark", Timeout: br.timeouts.Benchmark})
+}
+
+func (br *benchmarkRunner) SetUp(ctx context.Context, bctx *BenchmarkContext, s3Prefixes []netip.Prefix) error {
 	slog.Info("starting benchmark setup", slog.String("name", br.b.GetName()))
-	br.ctx = ctx
-	br.sm = systemmonitor.NewSystemMonitor(ctx.Target, s3Prefixes)
+	br.ctx = bctx
+	if br.timeouts.Benchmark > 0 {
+		br.deadline = time.Now().Add(br.timeouts.Benchmark)
+	}
+
+	ctx, cancelBenchmark := br.withBenchmarkTimeout(ctx)
+	defer cancelBenchmark()
+	ctx, cancelSetUp := withTimeout(ctx, "setup", br.timeouts.SetUp)
+	defer cancelSetUp()
 
-	err := br.b.SetUp(ctx)
+	if bctx.Arch == "" {
+		arch, err := target.DetectArch(ctx, bctx.Target)
+		if err != nil {
+			return fmt.Errorf("detecting target architecture failed: %w", causeOf(ctx, err))
+		}
+		bctx.Arch = arch
+	}
+
+	var err error
+	br.sm, err = systemmonitor.NewSystemMonitor(&systemmonitor.SystemMonitorInput{
+		Target:         bctx.Target,
+		Arch:           bctx.Arch,
+		S3Prefixes:     s3Prefixes,
+		PIDFile:        br.accounting.pidFile,
+		Collectors:     br.collectors,
+		SampleInterval: br.sampleInterval,
+	})
+	if err != nil {
+		return fmt.Errorf("creating SystemMonitor failed: %w", err)
+	}
+
+	err = br.b.SetUp(ctx, bctx)
 	if err != nil {
-		return fmt.Errorf("setting up benchmark failed: %w", err)
+		return fmt.Errorf("setting up benchmark failed: %w", causeOf(ctx, err))
 	}
 
-	err = br.sm.SetUp()
+	err = br.sm.SetUp(ctx)
 	if err != nil {
-		return fmt.Errorf("setting up SystemMonitor failed: %w", err)
+		return fmt.Errorf("setting up SystemMonitor failed: %w", causeOf(ctx, err))
 	}
 
 	if br.profilerKind != profile.None {
-		br.prof, err = profile.NewProfiler(br.profilerKind, ctx.Target)
+		br.prof, err = profile.NewProfiler(br.profilerKind, bctx.Target)
 		if err != nil {
 			return fmt.Errorf("creating profiler failed: %w", err)
 		}
 
-		err = br.prof.SetUp()
+		err = br.prof.SetUp(ctx)
 		if err != nil {
-			return fmt.Errorf("setting up Profiler failed: %w", err)
+			return fmt.Errorf("setting up Profiler failed: %w", causeOf(ctx, err))
 		}
 	}
 
@@ -73,10 +143,11 @@ func (br *benchmarkRunner) SetUp(ctx *BenchmarkContext, s3Prefixes []netip.Prefi
 	return nil
 }
 
-func (br *benchmarkRunner) Run() *report.BenchmarkReport {
+func (br *benchmarkRunner) Run(ctx context.Context) *report.BenchmarkReport {
 	slog.Info("starting benchmark", slog.String("name", br.b.GetName()))
 	rep := &report.BenchmarkReport{Name: br.b.GetName()}
 	rep.Input = br.b.GetInput()
+	rep.BaselineThroughputGbps = br.ctx.DesiredThroughput
 
 	cmd, err := br.b.GetCommand()
 	if err != nil {
@@ -85,20 +156,37 @@ func (br *benchmarkRunner) Run() *report.BenchmarkReport {
 	}
 	slog.Debug("benchmark command", slog.String("name", br.b.GetName()), slog.String("command", cmd))
 
-	meta := map[string]string{"command": cmd, "profiler": string(br.profilerKind)}
+	meta := map[string]string{"command": cmd, "profiler": string(br.profilerKind), "architecture": string(br.ctx.Arch)}
+	if artifacts := ArtifactsOf(br.b); len(artifacts) > 0 {
+		meta["artifacts"] = strings.Join(artifacts, " ")
+	}
 	rep.Metadata = []any{&meta}
 
-	err = br.sm.StartMonitoring()
+	ctx, cancel := br.withBenchmarkTimeout(ctx)
+	defer cancel()
+
+	err = br.sm.StartMonitoring(ctx)
 	if err != nil {
 		rep.Error = fmt.Errorf("starting SystemMonitor failed: %w", err).Error()
 		return rep
 	}
-	defer br.sm.StopMonitoring()
+	// Keep the measurements even if the benchmark fails part way through
+	defer func() {
+		br.sm.StopMonitoring()
+		br.sm.WaitUntilStopped()
+		rep.SystemMeasurements = br.sm.GetSystemMeasurements()
+		err := br.sm.TearDown(context.WithoutCancel(ctx))
+		if err != nil {
+			slog.Warn("tearing down SystemMonitor failed", slog.String("name", br.b.GetName()), slog.String("error", err.Error()))
+		}
+	}()
 
 	if br.prof != nil {
-		remoteResultPath, err := br.prof.ProfileCommand(cmd)
+		runCtx, cancelRun := withTimeout(ctx, "run", br.timeouts.Run)
+		defer cancelRun()
+		remoteResultPath, err := br.prof.ProfileCommand(runCtx, cmd)
 		if err != nil {
-			rep.Error = fmt.Errorf("profiling benchmark failed: %w", err).Error()
+			rep.Error = fmt.Errorf("profiling benchmark failed: %w", causeOf(runCtx, err)).Error()
 			return rep
 		}
 
@@ -116,8 +204,23 @@ func (br *benchmarkRunner) Run() *report.BenchmarkReport {
 			return rep
 		}
 	} else {
+		ttfb := report.NewHistogram()
+		duration := report.NewHistogram()
+		latency := &report.RequestLatency{StatusCounts: map[int]int64{}}
+		// Deferred so a failed run still reports the latency of the requests recorded before it
+		defer func() {
+			if latency.Requests > 0 {
+				latency.TTFB = ttfb.SummarizeMicros()
+				latency.Duration = duration.SummarizeMicros()
+				rep.Latency = latency
+			}
+		}()
+
 		for range br.runs {
-			out, err := br.ctx.Target.RunCommand(cmd)
+			runCtx, cancelRun := withTimeout(ctx, "run", br.timeouts.Run)
+			out, err := br.ctx.Target.RunCommand(runCtx, br.accounting.wrap(cmd))
+			err = causeOf(runCtx, err)
+			cancelRun()
 			if err != nil {
 				slog.Error("running benchmark command failed", slog.String("name", br.b.GetName()), slog.String("error", err.Error()), slog.String("output", string(out)))
 				rep.Error = fmt.Errorf("running benchmark failed: %w", err).Error()
@@ -132,14 +235,64 @@ func (br *benchmarkRunner) Run() *report.BenchmarkReport {
 			}
 
 			rep.TotalTimeSec = append(rep.TotalTimeSec, benchOut.TotalTimeSec)
+			rep.BytesTransferred = append(rep.BytesTransferred, benchOut.BytesTransferred)
+			rep.ObjectCount = append(rep.ObjectCount, benchOut.ObjectCount)
+			rep.RequestCount = append(rep.RequestCount, benchOut.RequestCount)
+			gbps := 0.0
+			if benchOut.TotalTimeSec > 0 {
+				gbps = float64(benchOut.BytesTransferred) * 8 / 1e9 / benchOut.TotalTimeSec
+			}
+			rep.ThroughputGbps = append(rep.ThroughputGbps, gbps)
+			if br.ctx.DesiredThroughput > 0 {
+				rep.ThroughputFractionOfBaseline = append(rep.ThroughputFractionOfBaseline, gbps/br.ctx.DesiredThroughput)
+			}
 			rep.Metadata = append(rep.Metadata, benchOut.Metadata...)
+
+			userSec, sysSec, err := br.accounting.readCPUTime(ctx, br.ctx.Target)
+			if err != nil {
+				slog.Warn("failed to read the benchmark command's CPU time", slog.String("name", br.b.GetName()), slog.String("error", err.Error()))
+			} else {
+				rep.CPUUserSec = append(rep.CPUUserSec, userSec)
+				rep.CPUSysSec = append(rep.CPUSysSec, sysSec)
+			}
+
+			if benchOut.RequestRecordsPath != "" {
+				err = br.readRequestRecords(ctx, benchOut.RequestRecordsPath, func(r RequestRecord) {
+					ttfb.Record(int64(r.TTFBSec * 1e6))
+					duration.Record(int64(r.DurationSec * 1e6))
+					latency.Requests++
+					latency.Retries += int64(r.Retries)
+					latency.Bytes += r.Bytes
+					latency.StatusCounts[r.HTTPStatus]++
+				})
+				if err != nil {
+					rep.Error = fmt.Errorf("reading request records failed: %w", err).Error()
+					return rep
+				}
+			}
 		}
 	}
 
-	br.sm.StopMonitoring()
-	br.sm.WaitUntilStopped()
-	rep.SystemMeasurements = br.sm.GetSystemMeasurements()
-
 	slog.Info("finished benchmark", slog.String("name", br.b.GetName()))
 	return rep
 }
+
+// Streams the request records file back from the target into fn, then deletes it so the next run starts fresh.
+func (br *benchmarkRunner) readRequestRecords(ctx context.Context, remotePath string, fn func(RequestRecord)) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(br.ctx.Target.CopyFileFrom(remotePath, pw))
+	}()
+	err := ReadRequestRecords(pr, fn)
+	// Stops the copy if parsing failed part way through. A failed copy is returned by ReadRequestRecords.
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	out, err := br.ctx.Target.RunCommand(ctx, "rm -f "+remotePath)
+	if err != nil {
+		slog.Warn("failed to delete the request records", slog.String("path", remotePath), slog.String("error", err.Error()), slog.String("output", string(out)))
+	}
+	return nil
+}
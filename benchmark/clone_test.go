@@ -0,0 +1,157 @@
+package benchmark_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Octogonapus/S3Benchmark/benchmark"
+	"github.com/Octogonapus/S3Benchmark/benchmark/awscli"
+	"github.com/Octogonapus/S3Benchmark/benchmark/gobench"
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+// A target which pretends to be an Ubuntu machine of one architecture and records the commands run on it.
+type fakeTarget struct {
+	uname    string
+	mu       sync.Mutex
+	commands []string
+}
+
+func (t *fakeTarget) RunCommand(ctx context.Context, cmd string) ([]byte, error) {
+	t.mu.Lock()
+	t.commands = append(t.commands, cmd)
+	t.mu.Unlock()
+	switch cmd {
+	case "uname -m":
+		return []byte(t.uname + "\n"), nil
+	case "cat /etc/os-release":
+		return []byte("ID=ubuntu\nVERSION_ID=\"22.04\"\n"), nil
+	}
+	return nil, nil
+}
+
+func (t *fakeTarget) StreamCommand(ctx context.Context, cmd string, w io.Writer) error {
+	_, err := t.RunCommand(ctx, cmd)
+	return err
+}
+
+func (t *fakeTarget) CopyFileTo(localPath io.Reader, remotePath string) error {
+	_, err := io.Copy(io.Discard, localPath)
+	return err
+}
+
+func (t *fakeTarget) CopyFileFrom(remotePath string, localFile io.Writer) error {
+	return nil
+}
+
+func (t *fakeTarget) NewSession() (target.Session, error) {
+	return nil, errors.New("sessions aren't supported by the fake target")
+}
+
+func (t *fakeTarget) ranCommandContaining(s string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, cmd := range t.commands {
+		if strings.Contains(cmd, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sets up copies of one benchmark on an x86_64 and an arm64 target at once, as orchestrators do, and checks that each
+// copy installed the build for its own target.
+func TestClonesKeepPerTargetState(t *testing.T) {
+	goBench, err := gobench.NewGoBenchmark(&gobench.GoBenchmarkInput{Name: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		b          benchmark.Benchmark
+		x86Build   string
+		arm64Build string
+	}{
+		{goBench, "linux-amd64.tar.gz", "linux-arm64.tar.gz"},
+		{awscli.NewAwsCliBenchmark(&awscli.AwsCliBenchmarkInput{Name: "cli"}), "linux-x86_64.zip", "linux-aarch64.zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.b.GetName(), func(t *testing.T) {
+			targets := map[string]*fakeTarget{
+				tt.x86Build:   {uname: "x86_64"},
+				tt.arm64Build: {uname: "arm64"}, // macOS and some kernels name it arm64 rather than aarch64
+			}
+			clones := map[string]benchmark.Benchmark{}
+			wg := &sync.WaitGroup{}
+			errs := make(chan error, len(targets))
+			for build, ft := range targets {
+				clone, ok := benchmark.CloneOf(tt.b)
+				if !ok {
+					t.Fatalf("%s isn't a Cloner", tt.b.GetName())
+				}
+				clones[build] = clone
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					arch, err := target.DetectArch(context.Background(), ft)
+					if err != nil {
+						errs <- err
+						return
+					}
+					errs <- clone.SetUp(context.Background(), &benchmark.BenchmarkContext{
+						Target: ft,
+						Bucket: "bucket-" + build,
+						Arch:   arch,
+					})
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatalf("SetUp failed: %v", err)
+				}
+			}
+
+			for build, ft := range targets {
+				artifacts := benchmark.ArtifactsOf(clones[build])
+				if len(artifacts) != 1 || !strings.HasSuffix(artifacts[0], build) {
+					t.Errorf("the %s target's copy reports %v, want a %s build", ft.uname, artifacts, build)
+				}
+				for other := range targets {
+					if ran := ft.ranCommandContaining(other); ran != (other == build) {
+						t.Errorf("the %s target installed %s: %t", ft.uname, other, ran)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCloneOfConfiguredBenchmark(t *testing.T) {
+	b, err := benchmark.DeserializeBenchmark(&benchmark.SerializedBenchmark{
+		Type:          "aws_cli",
+		Input:         map[string]any{"Name": "cli"},
+		Timeouts:      &benchmark.Timeouts{Run: 5},
+		InstanceTypes: []string{"c7gn.large", "c6in.large"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone, ok := benchmark.CloneOf(b)
+	if !ok {
+		t.Fatal("a deserialized benchmark isn't copyable")
+	}
+	if clone == b {
+		t.Errorf("CloneOf returned the same benchmark")
+	}
+	if benchmark.TimeoutsOf(clone) != benchmark.TimeoutsOf(b) {
+		t.Errorf("the copy lost its timeouts")
+	}
+	if len(benchmark.InstanceTypesOf(clone)) != 2 {
+		t.Errorf("the copy lost its instance types")
+	}
+}
@@ -0,0 +1,34 @@
+package benchmark
+
+// Benchmarks deserialized with Timeouts or InstanceTypes are wrapped in this so that runners and orchestrators can find
+// them with TimeoutsOf and InstanceTypesOf.
+type configuredBenchmark struct {
+	Benchmark
+	timeouts      Timeouts
+	instanceTypes []string
+}
+
+func (b *configuredBenchmark) WritesObjects() bool {
+	return WritesObjects(b.Benchmark)
+}
+
+func (b *configuredBenchmark) Artifacts() []string {
+	return ArtifactsOf(b.Benchmark)
+}
+
+// Returns the timeouts set on the benchmark when it was deserialized, which override the runner's defaults.
+func TimeoutsOf(b Benchmark) Timeouts {
+	if cb, ok := b.(*configuredBenchmark); ok {
+		return cb.timeouts
+	}
+	return Timeouts{}
+}
+
+// Returns the instance types set on the benchmark when it was deserialized, which override the orchestrator's. Empty
+// if none were set.
+func InstanceTypesOf(b Benchmark) []string {
+	if cb, ok := b.(*configuredBenchmark); ok {
+		return cb.instanceTypes
+	}
+	return nil
+}
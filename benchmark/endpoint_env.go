@@ -0,0 +1,56 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Written to the working directory of the target by SetUpEndpointEnv.
+const endpointEnvPath = "s3benchmark-endpoint.env"
+
+// Writes the static credentials and region of bctx.Endpoint to a file on the target. Returns a command prefix which
+// runs the rest of the command with them exported, or an empty string if there is nothing to export. The prefix execs
+// the command so that profilers still see it. Credentials are passed this way rather than in the command so that they
+// don't end up in logs or reports. The AWS SDKs and the AWS CLI all read these environment variables.
+func SetUpEndpointEnv(ctx context.Context, bctx *BenchmarkContext) (string, error) {
+	vars := map[string]string{}
+	if bctx.Endpoint.HasStaticCredentials() {
+		vars["AWS_ACCESS_KEY_ID"] = bctx.Endpoint.AccessKeyID
+		vars["AWS_SECRET_ACCESS_KEY"] = bctx.Endpoint.SecretAccessKey
+		if bctx.Endpoint.SessionToken != "" {
+			vars["AWS_SESSION_TOKEN"] = bctx.Endpoint.SessionToken
+		}
+	}
+	if bctx.Endpoint.URL != "" && bctx.Region != "" {
+		// Off EC2 there is no IMDS to get the region from
+		vars["AWS_REGION"] = bctx.Region
+		vars["AWS_DEFAULT_REGION"] = bctx.Region
+	}
+	if len(vars) == 0 {
+		return "", nil
+	}
+
+	sb := &strings.Builder{}
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if value, ok := vars[name]; ok {
+			fmt.Fprintf(sb, "export %s=%s\n", name, shellQuote(value))
+		}
+	}
+
+	// Create the file with restrictive permissions before it holds any secrets
+	out, err := bctx.Target.RunCommand(ctx, fmt.Sprintf("touch %s && chmod 600 %s", endpointEnvPath, endpointEnvPath))
+	if err != nil {
+		return "", fmt.Errorf("creating endpoint environment file failed: %w: %s", err, string(out))
+	}
+	err = bctx.Target.CopyFileTo(strings.NewReader(sb.String()), endpointEnvPath)
+	if err != nil {
+		return "", fmt.Errorf("copying endpoint environment file failed: %w", err)
+	}
+	return fmt.Sprintf(`sh -c '. ./%s && exec "$@"' sh `, endpointEnvPath), nil
+}
+
+// Quotes s for use as a single word in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -2,6 +2,7 @@ package gobench
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -13,39 +14,75 @@ import (
 
 	"github.com/Octogonapus/S3Benchmark/benchmark"
 	"github.com/Octogonapus/S3Benchmark/util"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/mitchellh/mapstructure"
 )
 
 //go:embed go_benchmark/*
 var goProject embed.FS
 
+type GoOperation string
+
+const (
+	Download GoOperation = "download"
+	Upload   GoOperation = "upload"
+)
+
 type bmark struct {
-	input       *GoBenchmarkInput
-	ctx         *benchmark.BenchmarkContext
-	objectsPath string
+	input              *GoBenchmarkInput
+	ctx                *benchmark.BenchmarkContext
+	objectsPath        string
+	uploadPrefix       string
+	requestRecordsPath string // empty if requests aren't recorded
+	envPrefix          string
+	goArchive          string // the Go release installed for the target's architecture
 }
 
 type GoBenchmarkInput struct {
-	Name                string
-	DownloadInParts     bool
-	DownloadConcurrency int
-	PartSize            int
-	PartConcurrency     int
-	Repeats             int
+	Name                  string
+	Operation             GoOperation // download by default
+	DownloadInParts       bool
+	DownloadConcurrency   int
+	UploadInParts         bool   // use manager.Uploader (multipart) instead of a single PutObject per object
+	UploadFromBuffer      bool   // upload each object's body from memory preallocated before timing instead of streaming it
+	UploadConcurrency     int    // number of objects uploaded concurrently
+	UploadPrefix          string // prepended to each object key when uploading. random by default. with Repeats, each repeat's keys get a .N suffix.
+	DeleteUploadedObjects bool   // delete the uploaded objects after each run (not included in the timing)
+	PartSize              int
+	PartConcurrency       int
+	Repeats               int
+	RecordRequests        bool // record every S3 request for latency histograms
 }
 
 type input struct {
 	Bucket              string
 	ObjectsPath         string
+	Operation           string
 	DownloadStrategy    string
 	DownloadConcurrency int
+	UploadStrategy      string
+	UploadBody          string
+	UploadConcurrency   int
+	UploadPrefix        string
+	DeleteUploaded      bool
 	PartSize            int
 	PartConcurrency     int
 	Repeats             int
+	RequestRecordsPath  string
+	EndpointURL         string
+	UsePathStyle        bool
+}
+
+type object struct {
+	Key       string
+	SizeBytes int
 }
 
 type output struct {
-	TotalTimeSec float64
+	TotalTimeSec     float64
+	BytesTransferred int64
+	ObjectCount      int
+	RequestCount     int
 }
 
 func init() {
@@ -60,17 +97,42 @@ func init() {
 }
 
 func NewGoBenchmark(input *GoBenchmarkInput) (benchmark.Benchmark, error) {
+	if input.Operation == "" {
+		input.Operation = Download
+	}
+	if input.Operation != Download && input.Operation != Upload {
+		return nil, fmt.Errorf("unknown operation: %s", input.Operation)
+	}
+	if input.Operation == Upload && input.UploadConcurrency < 1 {
+		return nil, fmt.Errorf("UploadConcurrency must be at least 1 when uploading")
+	}
+	if input.Operation == Upload && input.UploadInParts && input.PartSize != 0 && int64(input.PartSize) < manager.MinUploadPartSize {
+		return nil, fmt.Errorf("PartSize must be at least %d bytes when uploading in parts", manager.MinUploadPartSize)
+	}
 	return &bmark{input: input}, nil
 }
 
-func (b *bmark) installGo() error {
+func (b *bmark) Clone() benchmark.Benchmark {
+	return &bmark{input: b.input}
+}
+
+func (b *bmark) WritesObjects() bool {
+	return b.input.Operation == Upload
+}
+
+func (b *bmark) Artifacts() []string {
+	return []string{b.goArchive}
+}
+
+func (b *bmark) installGo(ctx context.Context) error {
+	b.goArchive = fmt.Sprintf("https://go.dev/dl/go1.22.4.linux-%s.tar.gz", b.ctx.Arch.GoArch())
 	var out []byte
 	var err error
 	for i := 0; i < 3; i++ {
-		out, err = b.ctx.Target.RunCommand("wget -nv https://go.dev/dl/go1.22.4.linux-amd64.tar.gz && rm -rf /usr/local/go && tar -C /usr/local -xzf go1.22.4.linux-amd64.tar.gz")
+		out, err = b.ctx.Target.RunCommand(ctx, fmt.Sprintf("curl -fsSLO %s && rm -rf /usr/local/go && tar -C /usr/local -xzf %s", b.goArchive, path.Base(b.goArchive)))
 		if err != nil {
 			slog.Debug("failed to install dependencies, will try again", slog.String("command output", string(out)), slog.String("error", err.Error()))
-			time.Sleep(30 * time.Second)
+			util.Sleep(ctx, 30*time.Second)
 		} else {
 			break
 		}
@@ -82,10 +144,20 @@ func (b *bmark) installGo() error {
 	return nil
 }
 
-func (b *bmark) SetUp(ctx *benchmark.BenchmarkContext) error {
-	b.ctx = ctx
+func (b *bmark) SetUp(ctx context.Context, bctx *benchmark.BenchmarkContext) error {
+	b.ctx = bctx
+
+	b.uploadPrefix = b.input.UploadPrefix
+	if b.input.Operation == Upload && b.uploadPrefix == "" {
+		b.uploadPrefix = fmt.Sprintf("upload-%s/", util.Randstring(8))
+	}
 
-	err := b.installGo()
+	err := b.installGo(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.envPrefix, err = benchmark.SetUpEndpointEnv(ctx, b.ctx)
 	if err != nil {
 		return err
 	}
@@ -113,7 +185,11 @@ func (b *bmark) SetUp(ctx *benchmark.BenchmarkContext) error {
 		return err
 	}
 
-	buf, err := json.Marshal(b.ctx.Keys)
+	objects := []object{}
+	for _, obj := range b.ctx.Objects {
+		objects = append(objects, object{Key: obj.Key, SizeBytes: obj.SizeBytes})
+	}
+	buf, err := json.Marshal(objects)
 	if err != nil {
 		return err
 	}
@@ -123,7 +199,11 @@ func (b *bmark) SetUp(ctx *benchmark.BenchmarkContext) error {
 		return err
 	}
 
-	out, err := b.ctx.Target.RunCommand("cd go_benchmark && /usr/local/go/bin/go build")
+	if b.input.RecordRequests {
+		b.requestRecordsPath = fmt.Sprintf("./%s-requests.jsonl", util.Randstring(8))
+	}
+
+	out, err := b.ctx.Target.RunCommand(ctx, "cd go_benchmark && /usr/local/go/bin/go build")
 	if err != nil {
 		slog.Error("failed to build the go project", slog.String("error", err.Error()), slog.String("command output", string(out)))
 		return err
@@ -142,14 +222,32 @@ func (b *bmark) GetCommand() (string, error) {
 
 	downloadStrategy := fmt.Sprintf("%s", parts)
 
+	uploadStrategy := "single put"
+	if b.input.UploadInParts {
+		uploadStrategy = "multipart"
+	}
+	uploadBody := "stream"
+	if b.input.UploadFromBuffer {
+		uploadBody = "buffer"
+	}
+
 	input := input{
 		Bucket:              b.ctx.Bucket,
 		ObjectsPath:         b.objectsPath,
+		Operation:           string(b.input.Operation),
 		DownloadStrategy:    downloadStrategy,
 		DownloadConcurrency: b.input.DownloadConcurrency,
+		UploadStrategy:      uploadStrategy,
+		UploadBody:          uploadBody,
+		UploadConcurrency:   b.input.UploadConcurrency,
+		UploadPrefix:        b.uploadPrefix,
+		DeleteUploaded:      b.input.DeleteUploadedObjects,
 		PartSize:            b.input.PartSize,
 		PartConcurrency:     b.input.PartConcurrency,
 		Repeats:             max(1, b.input.Repeats),
+		RequestRecordsPath:  b.requestRecordsPath,
+		EndpointURL:         b.ctx.Endpoint.URL,
+		UsePathStyle:        b.ctx.Endpoint.UsePathStyle,
 	}
 	buf, err := json.Marshal(input)
 	if err != nil {
@@ -157,7 +255,8 @@ func (b *bmark) GetCommand() (string, error) {
 	}
 
 	return fmt.Sprintf(
-		"go_benchmark/go_benchmark '%s'",
+		"%sgo_benchmark/go_benchmark '%s'",
+		b.envPrefix,
 		string(buf),
 	), nil
 }
@@ -173,7 +272,11 @@ func (b *bmark) ParseCommandOutput(out []byte) (*benchmark.BenchmarkOutput, erro
 	}
 
 	benchOutput := benchmark.BenchmarkOutput{
-		TotalTimeSec: output.TotalTimeSec,
+		TotalTimeSec:       output.TotalTimeSec,
+		BytesTransferred:   output.BytesTransferred,
+		ObjectCount:        output.ObjectCount,
+		RequestCount:       output.RequestCount,
+		RequestRecordsPath: b.requestRecordsPath,
 	}
 	return &benchOutput, nil
 }
@@ -3,29 +3,65 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/alitto/pond"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
 )
 
 type Input struct {
 	Bucket              string
 	ObjectsPath         string
+	Operation           string
 	DownloadStrategy    string
 	DownloadConcurrency int
+	UploadStrategy      string
+	UploadBody          string
+	UploadConcurrency   int
+	UploadPrefix        string
+	DeleteUploaded      bool
 	PartSize            int
 	PartConcurrency     int
 	Repeats             int
+	RequestRecordsPath  string // write a record of every request here. nothing is recorded if empty.
+	EndpointURL         string
+	UsePathStyle        bool
+}
+
+type Object struct {
+	Key       string
+	SizeBytes int
 }
 
 type Output struct {
-	TotalTimeSec float64
+	TotalTimeSec     float64
+	BytesTransferred int64
+	ObjectCount      int64
+	RequestCount     int64
+}
+
+// Totals over every repeat.
+type counters struct {
+	bytes    atomic.Int64
+	objects  atomic.Int64
+	requests atomic.Int64
+}
+
+func (c *counters) addObject(bytes int64) {
+	c.bytes.Add(bytes)
+	c.objects.Add(1)
 }
 
 func main() {
@@ -41,7 +77,7 @@ func main() {
 		panic(err)
 	}
 
-	objects := []string{}
+	objects := []Object{}
 	err = json.Unmarshal(objsBuf, &objects)
 	if err != nil {
 		panic(err)
@@ -52,10 +88,57 @@ func main() {
 		panic(err)
 	}
 
-	s3Client := s3.NewFromConfig(cfg)
+	counts := &counters{}
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		// The finalize step runs once per attempt, so retries are counted as requests too
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("CountRequests", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			counts.requests.Add(1)
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)
+	})
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if input.EndpointURL != "" {
+			o.BaseEndpoint = aws.String(input.EndpointURL)
+		}
+		o.UsePathStyle = input.UsePathStyle
+	})
+	var s3Client s3API = client
+	var recorder *requestRecorder
+	if input.RequestRecordsPath != "" {
+		recorder = &requestRecorder{}
+		s3Client = &recordingClient{Client: client, recorder: recorder}
+	}
 
 	output := Output{}
 
+	if input.Operation == "upload" {
+		output.TotalTimeSec = upload(s3Client, &input, objects, counts)
+	} else {
+		output.TotalTimeSec = download(s3Client, &input, objects, counts)
+	}
+	output.BytesTransferred = counts.bytes.Load()
+	output.ObjectCount = counts.objects.Load()
+	output.RequestCount = counts.requests.Load()
+
+	// Delete after counting so that cleanup requests aren't attributed to the benchmark
+	if input.Operation == "upload" && input.DeleteUploaded {
+		deleteUploaded(s3Client, &input, objects)
+	}
+
+	// Write the records after timing so that writing them doesn't slow down the benchmark
+	if recorder != nil {
+		recorder.write(input.RequestRecordsPath)
+	}
+
+	outBuf, err := json.Marshal(output)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(outBuf))
+}
+
+func download(s3Client s3API, input *Input, objects []Object, counts *counters) float64 {
 	if input.DownloadStrategy == "parts" {
 		downloader := manager.NewDownloader(s3Client, func(d *manager.Downloader) {
 			d.PartSize = int64(input.PartSize)
@@ -65,63 +148,191 @@ func main() {
 		tstart := time.Now()
 		for i := 0; i < input.Repeats; i++ {
 			for _, obj := range objects {
-				if len(obj) == 0 {
+				if len(obj.Key) == 0 {
 					continue
 				}
 				pool.Submit(func() {
 					head, err := s3Client.HeadObject(context.Background(), &s3.HeadObjectInput{
 						Bucket: &input.Bucket,
-						Key:    &obj,
+						Key:    &obj.Key,
 					})
 					if err != nil {
 						panic(err)
 					}
 					buf := make([]byte, *head.ContentLength) // it is very important to preallocate otherwise performance is TERRIBLE
 					wr := manager.NewWriteAtBuffer(buf)
-					_, err = downloader.Download(context.Background(), wr, &s3.GetObjectInput{
+					n, err := downloader.Download(context.Background(), wr, &s3.GetObjectInput{
 						Bucket: &input.Bucket,
-						Key:    &obj,
+						Key:    &obj.Key,
 					})
 					if err != nil {
 						panic(err)
 					}
+					counts.addObject(n)
 				})
 			}
 		}
 		pool.StopAndWait()
-		output.TotalTimeSec = time.Since(tstart).Seconds()
+		return time.Since(tstart).Seconds()
 	} else {
 		pool := pond.New(input.DownloadConcurrency, 0, pond.MinWorkers(input.DownloadConcurrency))
 		tstart := time.Now()
 		for i := 0; i < input.Repeats; i++ {
 			for _, obj := range objects {
-				if len(obj) == 0 {
+				if len(obj.Key) == 0 {
 					continue
 				}
 				pool.Submit(func() {
 					resp, err := s3Client.GetObject(context.Background(), &s3.GetObjectInput{
 						Bucket: &input.Bucket,
-						Key:    &obj,
+						Key:    &obj.Key,
 					})
 					if err != nil {
 						panic(err)
 					}
 					// Reading the bytes is very important for an accurate test, otherwise not all data is downloaded
 					buf := bytes.NewBuffer([]byte{})
-					_, err = buf.ReadFrom(resp.Body)
+					n, err := buf.ReadFrom(resp.Body)
 					if err != nil {
 						panic(err)
 					}
+					counts.addObject(n)
 				})
 			}
 		}
 		pool.StopAndWait()
-		output.TotalTimeSec = time.Since(tstart).Seconds()
+		return time.Since(tstart).Seconds()
 	}
+}
 
-	outBuf, err := json.Marshal(output)
+func upload(s3Client s3API, input *Input, objects []Object, counts *counters) float64 {
+	// Generating random data for every byte would measure the RNG instead of S3, so repeat one random block
+	block := make([]byte, 1024*1024)
+	_, err := rand.Read(block)
 	if err != nil {
 		panic(err)
 	}
-	fmt.Println(string(outBuf))
+
+	var uploader *manager.Uploader
+	if input.UploadStrategy == "multipart" {
+		uploader = manager.NewUploader(s3Client, func(u *manager.Uploader) {
+			if input.PartSize > 0 {
+				u.PartSize = int64(input.PartSize)
+			}
+			if input.PartConcurrency > 0 {
+				u.Concurrency = input.PartConcurrency
+			}
+		})
+	}
+
+	// In buffer mode every body is a prefix of one buffer built before timing starts, so the benchmark doesn't measure
+	// allocating and filling it. Readers only read it, so it is shared by concurrent uploads.
+	var buf []byte
+	if input.UploadBody == "buffer" {
+		maxSize := 0
+		for _, obj := range objects {
+			maxSize = max(maxSize, obj.SizeBytes)
+		}
+		buf = make([]byte, maxSize)
+		for off := 0; off < len(buf); off += len(block) {
+			copy(buf[off:], block)
+		}
+	}
+
+	pool := pond.New(input.UploadConcurrency, 0, pond.MinWorkers(input.UploadConcurrency))
+	tstart := time.Now()
+	for i := 0; i < input.Repeats; i++ {
+		for _, obj := range objects {
+			if len(obj.Key) == 0 {
+				continue
+			}
+			pool.Submit(func() {
+				key := uploadKey(input, obj, i)
+
+				var body io.Reader
+				if buf != nil {
+					body = bytes.NewReader(buf[:obj.SizeBytes])
+				} else {
+					body = &repeatReader{block: block, remaining: obj.SizeBytes}
+				}
+
+				var err error
+				if uploader != nil {
+					_, err = uploader.Upload(context.Background(), &s3.PutObjectInput{
+						Bucket: &input.Bucket,
+						Key:    &key,
+						Body:   body,
+					})
+				} else {
+					var optFns []func(*s3.Options)
+					if buf == nil {
+						// A stream can't be rewound to compute the payload hash, so send it unsigned
+						optFns = append(optFns, s3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
+					}
+					_, err = s3Client.PutObject(context.Background(), &s3.PutObjectInput{
+						Bucket:        &input.Bucket,
+						Key:           &key,
+						Body:          body,
+						ContentLength: aws.Int64(int64(obj.SizeBytes)),
+					}, optFns...)
+				}
+				if err != nil {
+					panic(err)
+				}
+				counts.addObject(int64(obj.SizeBytes))
+			})
+		}
+	}
+	pool.StopAndWait()
+	return time.Since(tstart).Seconds()
+}
+
+// Returns the key an object is uploaded to. Each repeat uploads to its own keys so that concurrent repeats never PUT
+// the same key.
+func uploadKey(input *Input, obj Object, repeat int) string {
+	key := input.UploadPrefix + obj.Key
+	if input.Repeats > 1 {
+		key += fmt.Sprintf(".%d", repeat)
+	}
+	return key
+}
+
+func deleteUploaded(s3Client s3API, input *Input, objects []Object) {
+	ids := []s3Types.ObjectIdentifier{}
+	for i := 0; i < input.Repeats; i++ {
+		for _, obj := range objects {
+			if len(obj.Key) == 0 {
+				continue
+			}
+			ids = append(ids, s3Types.ObjectIdentifier{Key: aws.String(uploadKey(input, obj, i))})
+		}
+	}
+	// DeleteObjects accepts at most 1000 keys per request
+	for start := 0; start < len(ids); start += 1000 {
+		end := min(start+1000, len(ids))
+		_, err := s3Client.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: &input.Bucket,
+			Delete: &s3Types.Delete{Objects: ids[start:end], Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Streams remaining bytes by repeating block without allocating.
+type repeatReader struct {
+	block     []byte
+	offset    int
+	remaining int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p[:min(len(p), r.remaining)], r.block[r.offset:])
+	r.offset = (r.offset + n) % len(r.block)
+	r.remaining -= n
+	return n, nil
 }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Must match benchmark.RequestRecord.
+type RequestRecord struct {
+	Operation         string
+	Key               string
+	Range             string `json:",omitempty"`
+	StartTimeUnixNano int64
+	TTFBSec           float64
+	DurationSec       float64
+	Bytes             int64
+	HTTPStatus        int
+	Retries           int
+}
+
+type s3API interface {
+	manager.DownloadAPIClient
+	manager.UploadAPIClient
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+type requestRecorder struct {
+	mu      sync.Mutex
+	records []RequestRecord
+}
+
+func (r *requestRecorder) add(record RequestRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+// Writes one JSON record per line to the file at p, replacing it if it exists.
+func (r *requestRecorder) write(p string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.Create(p)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, record := range r.records {
+		err = enc.Encode(record)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Wraps an S3 client to record every request which transfers object data.
+// Requests which fail are not recorded because the benchmark panics on any failure.
+type recordingClient struct {
+	*s3.Client
+	recorder *requestRecorder
+}
+
+func newRecord(operation string, key *string, start time.Time, metadata middleware.Metadata) RequestRecord {
+	record := RequestRecord{
+		Operation:         operation,
+		StartTimeUnixNano: start.UnixNano(),
+		TTFBSec:           time.Since(start).Seconds(),
+	}
+	if key != nil {
+		record.Key = *key
+	}
+	if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+		record.HTTPStatus = resp.StatusCode
+	}
+	if attempts, ok := retry.GetAttemptResults(metadata); ok && len(attempts.Results) > 0 {
+		record.Retries = len(attempts.Results) - 1
+	}
+	return record
+}
+
+func (c *recordingClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	start := time.Now()
+	out, err := c.Client.GetObject(ctx, params, optFns...)
+	if err != nil {
+		return out, err
+	}
+	record := newRecord("GetObject", params.Key, start, out.ResultMetadata)
+	if params.Range != nil {
+		record.Range = *params.Range
+	}
+	out.Body = &recordingBody{ReadCloser: out.Body, recorder: c.recorder, record: record, start: start}
+	return out, nil
+}
+
+func (c *recordingClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	start := time.Now()
+	out, err := c.Client.HeadObject(ctx, params, optFns...)
+	if err != nil {
+		return out, err
+	}
+	record := newRecord("HeadObject", params.Key, start, out.ResultMetadata)
+	record.DurationSec = record.TTFBSec
+	c.recorder.add(record)
+	return out, nil
+}
+
+func (c *recordingClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	start := time.Now()
+	size := bodySize(params.Body, params.ContentLength)
+	out, err := c.Client.PutObject(ctx, params, optFns...)
+	if err != nil {
+		return out, err
+	}
+	// The response only arrives after the whole body was sent, so the TTFB is the duration
+	record := newRecord("PutObject", params.Key, start, out.ResultMetadata)
+	record.DurationSec = record.TTFBSec
+	record.Bytes = size
+	c.recorder.add(record)
+	return out, nil
+}
+
+func (c *recordingClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	start := time.Now()
+	size := bodySize(params.Body, params.ContentLength)
+	out, err := c.Client.UploadPart(ctx, params, optFns...)
+	if err != nil {
+		return out, err
+	}
+	record := newRecord("UploadPart", params.Key, start, out.ResultMetadata)
+	record.DurationSec = record.TTFBSec
+	record.Bytes = size
+	c.recorder.add(record)
+	return out, nil
+}
+
+func bodySize(body io.Reader, contentLength *int64) int64 {
+	if contentLength != nil {
+		return *contentLength
+	}
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return 0
+	}
+	curr, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0
+	}
+	_, err = seeker.Seek(curr, io.SeekStart)
+	if err != nil {
+		panic(err)
+	}
+	return end - curr
+}
+
+// Finishes a GetObject record once the body is fully read or closed.
+type recordingBody struct {
+	io.ReadCloser
+	recorder *requestRecorder
+	record   RequestRecord
+	start    time.Time
+	once     sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.record.Bytes += int64(n)
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) finish() {
+	b.once.Do(func() {
+		b.record.DurationSec = time.Since(b.start).Seconds()
+		b.recorder.add(b.record)
+	})
+}
@@ -2,6 +2,7 @@ package julia_awsjl
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/Octogonapus/S3Benchmark/benchmark"
+	"github.com/Octogonapus/S3Benchmark/target"
 	"github.com/Octogonapus/S3Benchmark/util"
 	"github.com/hashicorp/go-version"
 	"github.com/mitchellh/mapstructure"
@@ -40,6 +42,8 @@ type bmark struct {
 	ctx         *benchmark.BenchmarkContext
 	objectsPath string
 	juliaCmd    string
+	julia       string // the Julia build installed for the target's architecture
+	envPrefix   string
 }
 
 type JuliaAwsjlBenchmarkInput struct {
@@ -66,11 +70,16 @@ type input struct {
 	DownloadPartSizeBytes int
 	DownloadPartsNThreads int
 	ShouldProfile         bool
+	EndpointURL           string
+	Region                string
 }
 
 type output struct {
-	DtMs    float64
-	Profile string
+	DtMs             float64
+	Profile          string
+	BytesTransferred int64
+	ObjectCount      int
+	RequestCount     int
 }
 
 func init() {
@@ -114,15 +123,23 @@ func NewJuliaAwsjlBenchmark(input *JuliaAwsjlBenchmarkInput) (benchmark.Benchmar
 	return &bmark{input: input}, nil
 }
 
-func (b *bmark) installJulia() error {
+func (b *bmark) Clone() benchmark.Benchmark {
+	return &bmark{input: b.input}
+}
+
+func (b *bmark) Artifacts() []string {
+	return []string{b.julia}
+}
+
+func (b *bmark) installJulia(ctx context.Context) error {
 	if b.input.SetUpForVTune {
 		var out []byte
 		var err error
 		for i := 0; i < 3; i++ {
-			out, err = b.ctx.Target.RunCommand("apt-get update -y && apt-get install -y build-essential libatomic1 python3 gfortran perl wget m4 cmake pkg-config curl")
+			out, err = target.InstallPackages(ctx, b.ctx.Target, "build-essential", "libatomic1", "python3", "gfortran", "perl", "wget", "m4", "cmake", "pkg-config", "curl", "git")
 			if err != nil {
 				slog.Debug("failed to install dependencies, will try again", slog.String("command output", string(out)), slog.String("error", err.Error()))
-				time.Sleep(30 * time.Second)
+				util.Sleep(ctx, 30*time.Second)
 			} else {
 				break
 			}
@@ -132,10 +149,17 @@ func (b *bmark) installJulia() error {
 			return err
 		}
 
-		out, err = b.ctx.Target.RunCommand(
+		// Intel JIT events are only supported on x86
+		makeUser := ""
+		if b.ctx.Arch == target.X8664 {
+			makeUser = "USE_INTEL_JITEVENTS=1"
+		}
+		b.julia = fmt.Sprintf("https://github.com/JuliaLang/julia.git@v%s (built on %s)", b.input.JuliaVersion, b.ctx.Arch)
+		out, err = b.ctx.Target.RunCommand(ctx,
 			fmt.Sprintf(
-				"git clone https://github.com/JuliaLang/julia.git && cd julia && git checkout v%s && echo USE_INTEL_JITEVENTS=1 > Make.user && make -j$(nproc)",
+				"git clone https://github.com/JuliaLang/julia.git && cd julia && git checkout v%s && echo %s > Make.user && make -j$(nproc)",
 				b.input.JuliaVersion,
+				makeUser,
 			),
 		)
 		if err != nil {
@@ -143,7 +167,7 @@ func (b *bmark) installJulia() error {
 			return err
 		}
 
-		out, err = b.ctx.Target.RunCommand("echo '#!/bin/bash\nENABLE_JITPROFILING=1 ~/julia/usr/bin/julia -q -g2 -O0 \"$@\"' > runjulia.sh && chmod +x runjulia.sh")
+		out, err = b.ctx.Target.RunCommand(ctx, "echo '#!/bin/bash\nENABLE_JITPROFILING=1 ~/julia/usr/bin/julia -q -g2 -O0 \"$@\"' > runjulia.sh && chmod +x runjulia.sh")
 		if err != nil {
 			slog.Error("failed to create custom runjulia script", slog.String("command output", string(out)), slog.String("error", err.Error()))
 			return err
@@ -154,10 +178,10 @@ func (b *bmark) installJulia() error {
 		var out []byte
 		var err error
 		for i := 0; i < 3; i++ {
-			out, err = b.ctx.Target.RunCommand(fmt.Sprintf("curl -fsSL https://install.julialang.org | sh -s -- -y --default-channel %s", b.input.JuliaVersion))
+			out, err = b.ctx.Target.RunCommand(ctx, fmt.Sprintf("curl -fsSL https://install.julialang.org | sh -s -- -y --default-channel %s", b.input.JuliaVersion))
 			if err != nil {
 				slog.Debug("failed to install dependencies, will try again", slog.String("command output", string(out)), slog.String("error", err.Error()))
-				time.Sleep(30 * time.Second)
+				util.Sleep(ctx, 30*time.Second)
 			} else {
 				break
 			}
@@ -167,17 +191,24 @@ func (b *bmark) installJulia() error {
 			return err
 		}
 
+		// juliaup installs the build for the target's architecture
+		b.julia = fmt.Sprintf("juliaup channel %s (%s)", b.input.JuliaVersion, b.ctx.Arch)
 		b.juliaCmd = "~/.juliaup/bin/julia -q"
 	}
 	return nil
 }
 
-func (b *bmark) SetUp(ctx *benchmark.BenchmarkContext) error {
-	b.ctx = ctx
+func (b *bmark) SetUp(ctx context.Context, bctx *benchmark.BenchmarkContext) error {
+	b.ctx = bctx
 
 	var out []byte
 	var err error
-	err = b.installJulia()
+	err = b.installJulia(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.envPrefix, err = benchmark.SetUpEndpointEnv(ctx, b.ctx)
 	if err != nil {
 		return err
 	}
@@ -213,7 +244,7 @@ func (b *bmark) SetUp(ctx *benchmark.BenchmarkContext) error {
 		return err
 	}
 
-	out, err = b.ctx.Target.RunCommand(fmt.Sprintf("%s -t auto --project=julia_awsjl_benchmark -e 'using Pkg; Pkg.instantiate(); Pkg.build(); Pkg.precompile()'", b.juliaCmd))
+	out, err = b.ctx.Target.RunCommand(ctx, fmt.Sprintf("%s -t auto --project=julia_awsjl_benchmark -e 'using Pkg; Pkg.instantiate(); Pkg.build(); Pkg.precompile()'", b.juliaCmd))
 	if err != nil {
 		slog.Error("failed to instantiate the julia project", slog.String("command output", string(out)), slog.String("error", err.Error()))
 		return err
@@ -241,6 +272,8 @@ func (b *bmark) GetCommand() (string, error) {
 		DownloadPartSizeBytes: b.input.DownloadPartSizeBytes,
 		DownloadPartsNThreads: b.input.DownloadPartsNThreads,
 		ShouldProfile:         b.input.ProfileUsingBuiltin,
+		EndpointURL:           b.ctx.Endpoint.URL,
+		Region:                b.ctx.Region,
 	}
 	buf, err := json.Marshal(input)
 	if err != nil {
@@ -253,7 +286,8 @@ func (b *bmark) GetCommand() (string, error) {
 	}
 
 	return fmt.Sprintf(
-		"%s -t %s --project=julia_awsjl_benchmark -- julia_awsjl_benchmark/main.jl '%s'",
+		"%s%s -t %s --project=julia_awsjl_benchmark -- julia_awsjl_benchmark/main.jl '%s'",
+		b.envPrefix,
 		b.juliaCmd,
 		nthreadsCmd,
 		string(buf),
@@ -271,7 +305,10 @@ func (b *bmark) ParseCommandOutput(out []byte) (*benchmark.BenchmarkOutput, erro
 	}
 
 	benchOutput := benchmark.BenchmarkOutput{
-		TotalTimeSec: output.DtMs / 1000.0,
+		TotalTimeSec:     output.DtMs / 1000.0,
+		BytesTransferred: output.BytesTransferred,
+		ObjectCount:      output.ObjectCount,
+		RequestCount:     output.RequestCount,
 		Metadata: []any{
 			map[string]string{"juliaprofile": output.Profile},
 		},
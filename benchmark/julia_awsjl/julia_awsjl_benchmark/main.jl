@@ -4,13 +4,27 @@ using AWS, JSON, Random, Dates, SHA, Profile
 @kwdef struct Output
     DtMs::Float64
     Profile::String
+    BytesTransferred::Int
+    ObjectCount::Int
+    RequestCount::Int
+end
+
+const BYTES_TRANSFERRED = Threads.Atomic{Int}(0)
+const OBJECT_COUNT = Threads.Atomic{Int}(0)
+const REQUEST_COUNT = Threads.Atomic{Int}(0)
+
+function count_object(data)
+    Threads.atomic_add!(BYTES_TRANSFERRED, length(data))
+    Threads.atomic_add!(OBJECT_COUNT, 1)
 end
 
 function download_parts(key, aws_config, input)
     content_length_header = input.Backend == "http" ? "Content-Length" : "content-length"
     response = S3.head_object(input.Bucket, key; aws_config)
+    Threads.atomic_add!(REQUEST_COUNT, 1)
     object_length = parse(Int, response[content_length_header])
     if object_length < input.DownloadPartSizeBytes
+        Threads.atomic_add!(REQUEST_COUNT, 1)
         return S3.get_object(input.Bucket, key, Dict("response-content-type" => "application/octet-stream"); aws_config)
     end
 
@@ -26,6 +40,7 @@ function download_parts(key, aws_config, input)
         next_byte_range_start = range_end + 1
 
         Base.acquire(sem)
+        Threads.atomic_add!(REQUEST_COUNT, 1)
         t = Threads.@spawn begin
             try
                 obj_buf = S3.get_object(
@@ -56,6 +71,8 @@ struct Input
     DownloadPartSizeBytes::Int
     DownloadPartsNThreads::Int
     ShouldProfile::Bool
+    EndpointURL::String
+    Region::String
 end
 
 function Input(d::Dict)
@@ -68,12 +85,27 @@ function Input(d::Dict)
         d["DownloadPartSizeBytes"],
         d["DownloadPartsNThreads"],
         d["ShouldProfile"],
+        get(d, "EndpointURL", ""),
+        get(d, "Region", ""),
     )
 end
 
+# Sends requests to an S3-compatible endpoint instead of AWS. AWS.jl always uses path-style addressing.
+struct EndpointConfig <: AWS.AbstractAWSConfig
+    endpoint::String
+    region::String
+    credentials::AWS.AWSCredentials
+end
+
+AWS.region(c::EndpointConfig) = c.region
+AWS.credentials(c::EndpointConfig) = c.credentials
+AWS.generate_service_url(c::EndpointConfig, service::String, resource::String) = string(c.endpoint, resource)
+
 function download_objects_dynamic_threads_no_parts(objects, aws_config, dir, input)
     Threads.@threads for object in objects
         data = S3.get_object(input.Bucket, object; aws_config)
+        Threads.atomic_add!(REQUEST_COUNT, 1)
+        count_object(data)
         if input.WriteToDisk
             path = joinpath(dir, input.Bucket, object)
             mkpath(dirname(path))
@@ -87,6 +119,7 @@ end
 function download_objects_dynamic_threads_parts(objects, aws_config, dir, input)
     Threads.@threads for object in objects
         data = download_parts(object, aws_config, input)
+        count_object(data)
         if input.WriteToDisk
             path = joinpath(dir, input.Bucket, object)
             mkpath(dirname(path))
@@ -101,6 +134,7 @@ end
     function download_objects_greedy_threads_parts(objects, aws_config, dir, input)
         Threads.@threads :greedy for object in objects
             data = download_parts(object, aws_config, input)
+            count_object(data)
             if input.WriteToDisk
                 path = joinpath(dir, input.Bucket, object)
                 mkpath(dirname(path))
@@ -127,6 +161,8 @@ function download_objects_keep_off_thread_1_no_parts(objects, aws_config, dir, i
         t = Task() do
             try
                 data = S3.get_object(input.Bucket, object; aws_config)
+                Threads.atomic_add!(REQUEST_COUNT, 1)
+                count_object(data)
                 if input.WriteToDisk
                     path = joinpath(dir, input.Bucket, object)
                     mkpath(dirname(path))
@@ -152,6 +188,10 @@ function download_objects_keep_off_thread_1_no_parts(objects, aws_config, dir, i
 end
 
 function do_benchmark(objects, input, download_strategy)
+    # Only count the objects of this call, so the warmup isn't included
+    BYTES_TRANSFERRED[] = 0
+    OBJECT_COUNT[] = 0
+    REQUEST_COUNT[] = 0
     tstart = now(UTC)
     if input.ShouldProfile
         Profile.@profile download_strategy(objects)
@@ -166,7 +206,13 @@ function do_benchmark(objects, input, download_strategy)
     else
         ""
     end
-    return Output(; DtMs = Millisecond(tend - tstart).value, Profile = profile_str)
+    return Output(;
+        DtMs = Millisecond(tend - tstart).value,
+        Profile = profile_str,
+        BytesTransferred = BYTES_TRANSFERRED[],
+        ObjectCount = OBJECT_COUNT[],
+        RequestCount = REQUEST_COUNT[],
+    )
 end
 
 function main()
@@ -174,7 +220,11 @@ function main()
     input = Input(JSON.parse(ARGS[1]))
 
     AWS.DEFAULT_BACKEND[] = input.Backend == "http" ? AWS.HTTPBackend() : AWS.DownloadsBackend()
-    aws_config = AWS.AWSConfig()
+    aws_config = if isempty(input.EndpointURL)
+        AWS.AWSConfig()
+    else
+        EndpointConfig(rstrip(input.EndpointURL, '/'), input.Region, AWS.AWSCredentials())
+    end
     dir = mkpath(joinpath(homedir(), randstring(8)))
 
     download_strategy = if input.DownloadStrategy == "dynamic threads, no parts"
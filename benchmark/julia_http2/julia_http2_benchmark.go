@@ -2,6 +2,7 @@ package julia_http2
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,8 @@ import (
 	"time"
 
 	"github.com/Octogonapus/S3Benchmark/benchmark"
+	objectprovider "github.com/Octogonapus/S3Benchmark/object_provider"
+	"github.com/Octogonapus/S3Benchmark/target"
 	"github.com/Octogonapus/S3Benchmark/util"
 	"github.com/hashicorp/go-version"
 	"github.com/mitchellh/mapstructure"
@@ -25,6 +28,7 @@ type bmark struct {
 	ctx         *benchmark.BenchmarkContext
 	objectsPath string
 	juliaCmd    string
+	julia       string // the Julia build installed for the target's architecture
 }
 
 type JuliaHttp2BenchmarkInput struct {
@@ -41,7 +45,9 @@ type input struct {
 }
 
 type output struct {
-	DtMs float64
+	DtMs             float64
+	BytesTransferred int64
+	ObjectCount      int
 }
 
 func init() {
@@ -73,15 +79,23 @@ func NewJuliaHttp2Benchmark(input *JuliaHttp2BenchmarkInput) (benchmark.Benchmar
 	return &bmark{input: input}, nil
 }
 
-func (b *bmark) installJulia() error {
+func (b *bmark) Clone() benchmark.Benchmark {
+	return &bmark{input: b.input}
+}
+
+func (b *bmark) Artifacts() []string {
+	return []string{b.julia}
+}
+
+func (b *bmark) installJulia(ctx context.Context) error {
 	if b.input.SetUpForVTune {
 		var out []byte
 		var err error
 		for i := 0; i < 3; i++ {
-			out, err = b.ctx.Target.RunCommand("apt-get update -y && apt-get install -y build-essential libatomic1 python3 gfortran perl wget m4 cmake pkg-config curl")
+			out, err = target.InstallPackages(ctx, b.ctx.Target, "build-essential", "libatomic1", "python3", "gfortran", "perl", "wget", "m4", "cmake", "pkg-config", "curl", "git")
 			if err != nil {
 				slog.Debug("failed to install dependencies, will try again", slog.String("command output", string(out)), slog.String("error", err.Error()))
-				time.Sleep(30 * time.Second)
+				util.Sleep(ctx, 30*time.Second)
 			} else {
 				break
 			}
@@ -91,10 +105,17 @@ func (b *bmark) installJulia() error {
 			return err
 		}
 
-		out, err = b.ctx.Target.RunCommand(
+		// Intel JIT events are only supported on x86
+		makeUser := ""
+		if b.ctx.Arch == target.X8664 {
+			makeUser = "USE_INTEL_JITEVENTS=1"
+		}
+		b.julia = fmt.Sprintf("https://github.com/JuliaLang/julia.git@v%s (built on %s)", b.input.JuliaVersion, b.ctx.Arch)
+		out, err = b.ctx.Target.RunCommand(ctx,
 			fmt.Sprintf(
-				"git clone https://github.com/JuliaLang/julia.git && cd julia && git checkout v%s && echo USE_INTEL_JITEVENTS=1 > Make.user && make -j$(nproc)",
+				"git clone https://github.com/JuliaLang/julia.git && cd julia && git checkout v%s && echo %s > Make.user && make -j$(nproc)",
 				b.input.JuliaVersion,
+				makeUser,
 			),
 		)
 		if err != nil {
@@ -102,7 +123,7 @@ func (b *bmark) installJulia() error {
 			return err
 		}
 
-		out, err = b.ctx.Target.RunCommand("echo '#!/bin/bash\nENABLE_JITPROFILING=1 ~/julia/usr/bin/julia -q -g2 -O0 \"$@\"' > runjulia.sh && chmod +x runjulia.sh")
+		out, err = b.ctx.Target.RunCommand(ctx, "echo '#!/bin/bash\nENABLE_JITPROFILING=1 ~/julia/usr/bin/julia -q -g2 -O0 \"$@\"' > runjulia.sh && chmod +x runjulia.sh")
 		if err != nil {
 			slog.Error("failed to create custom runjulia script", slog.String("command output", string(out)), slog.String("error", err.Error()))
 			return err
@@ -113,10 +134,10 @@ func (b *bmark) installJulia() error {
 		var out []byte
 		var err error
 		for i := 0; i < 3; i++ {
-			out, err = b.ctx.Target.RunCommand(fmt.Sprintf("curl -fsSL https://install.julialang.org | sh -s -- -y --default-channel %s", b.input.JuliaVersion))
+			out, err = b.ctx.Target.RunCommand(ctx, fmt.Sprintf("curl -fsSL https://install.julialang.org | sh -s -- -y --default-channel %s", b.input.JuliaVersion))
 			if err != nil {
 				slog.Debug("failed to install dependencies, will try again", slog.String("command output", string(out)), slog.String("error", err.Error()))
-				time.Sleep(30 * time.Second)
+				util.Sleep(ctx, 30*time.Second)
 			} else {
 				break
 			}
@@ -126,17 +147,24 @@ func (b *bmark) installJulia() error {
 			return err
 		}
 
+		// juliaup installs the build for the target's architecture
+		b.julia = fmt.Sprintf("juliaup channel %s (%s)", b.input.JuliaVersion, b.ctx.Arch)
 		b.juliaCmd = "~/.juliaup/bin/julia -q"
 	}
 	return nil
 }
 
-func (b *bmark) SetUp(ctx *benchmark.BenchmarkContext) error {
-	b.ctx = ctx
+func (b *bmark) SetUp(ctx context.Context, bctx *benchmark.BenchmarkContext) error {
+	b.ctx = bctx
+
+	if bctx.Endpoint != (objectprovider.S3Endpoint{}) {
+		// The benchmark hardcodes its region and credentials (see main.jl)
+		return fmt.Errorf("the julia_http2 benchmark only supports AWS S3 with the default credentials")
+	}
 
 	var out []byte
 	var err error
-	err = b.installJulia()
+	err = b.installJulia(ctx)
 	if err != nil {
 		return err
 	}
@@ -172,7 +200,7 @@ func (b *bmark) SetUp(ctx *benchmark.BenchmarkContext) error {
 		return err
 	}
 
-	out, err = b.ctx.Target.RunCommand(fmt.Sprintf("%s -t auto --project=julia_http2_benchmark -e 'using Pkg; Pkg.instantiate(); Pkg.build(); Pkg.precompile()'", b.juliaCmd))
+	out, err = b.ctx.Target.RunCommand(ctx, fmt.Sprintf("%s -t auto --project=julia_http2_benchmark -e 'using Pkg; Pkg.instantiate(); Pkg.build(); Pkg.precompile()'", b.juliaCmd))
 	if err != nil {
 		slog.Error("failed to instantiate the julia project", slog.String("command output", string(out)), slog.String("error", err.Error()))
 		return err
@@ -215,7 +243,9 @@ func (b *bmark) ParseCommandOutput(out []byte) (*benchmark.BenchmarkOutput, erro
 	}
 
 	benchOutput := benchmark.BenchmarkOutput{
-		TotalTimeSec: output.DtMs / 1000.0,
+		TotalTimeSec:     output.DtMs / 1000.0,
+		BytesTransferred: output.BytesTransferred,
+		ObjectCount:      output.ObjectCount,
 	}
 	return &benchOutput, nil
 }
@@ -11,13 +11,30 @@ end
 
 @kwdef struct Output
     DtMs::Float64
+    BytesTransferred::Int
+    ObjectCount::Int
+end
+
+const BYTES_TRANSFERRED = Threads.Atomic{Int}(0)
+const OBJECT_COUNT = Threads.Atomic{Int}(0)
+
+function count_object(data)
+    Threads.atomic_add!(BYTES_TRANSFERRED, length(data))
+    Threads.atomic_add!(OBJECT_COUNT, 1)
 end
 
 function do_benchmark(download_strategy, objects)
+    # Only count the objects of this call, so the warmup isn't included
+    BYTES_TRANSFERRED[] = 0
+    OBJECT_COUNT[] = 0
     tstart = now(UTC)
     download_strategy(objects)
     tend = now(UTC)
-    return Output(; DtMs = Millisecond(tend - tstart).value)
+    return Output(;
+        DtMs = Millisecond(tend - tstart).value,
+        BytesTransferred = BYTES_TRANSFERRED[],
+        ObjectCount = OBJECT_COUNT[],
+    )
 end
 
 function main()
@@ -36,6 +53,7 @@ function main()
                 for _ = 1:3
                     try
                         data = CloudStore.get(b, object; credentials)
+                        count_object(data)
                         break
                     catch ex
                         @error ex
@@ -50,6 +68,7 @@ function main()
                 for _ = 1:3
                     try
                         data = CloudStore.get(b, object; credentials)
+                        count_object(data)
                         break
                     catch ex
                         @error ex
@@ -0,0 +1,182 @@
+package benchmark
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+var namePlaceholder = regexp.MustCompile(`{{\s*(\w+)\s*(?:\|\s*(\w+)\s*)?}}`)
+
+// Formats for name placeholders, used like {{PartSize | MiB}}.
+var nameFormats = map[string]func(value any) (string, error){
+	"MiB": func(value any) (string, error) {
+		var bytes int64
+		switch v := value.(type) {
+		case float64:
+			bytes = int64(v)
+		case int:
+			bytes = int64(v)
+		default:
+			return "", fmt.Errorf("MiB needs a number of bytes, got %v", value)
+		}
+		return strconv.FormatInt(bytes/(1024*1024), 10) + "MiB", nil
+	},
+}
+
+// Expands a serialized benchmark with a Matrix into one serialized benchmark per combination of matrix values.
+// The semantics follow GitHub Actions matrices:
+//  1. Every combination of the Matrix values is generated.
+//  2. Combinations matching an Exclude rule (all of the rule's keys have equal values) are removed.
+//  3. Each Include rule is merged into every original combination whose matrix values it wouldn't change, so a rule
+//     without any matrix keys extends every combination. Keys added by earlier Include rules may be overwritten. If
+//     the rule can't be merged into any combination, it is added as a new combination.
+//
+// Each combination is merged over Input. Placeholders like {{PartSize}} in the Name input are replaced with the
+// value of that input, optionally formatted like {{PartSize | MiB}} (see nameFormats). A serialized benchmark without
+// a Matrix or Include expands to itself.
+func ExpandSerializedBenchmark(sb *SerializedBenchmark) ([]*SerializedBenchmark, error) {
+	if len(sb.Matrix) == 0 && len(sb.Include) == 0 {
+		return []*SerializedBenchmark{sb}, nil
+	}
+
+	keys := []string{}
+	for key := range sb.Matrix {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	combos := []map[string]any{{}}
+	for _, key := range keys {
+		values := sb.Matrix[key]
+		if len(values) == 0 {
+			return nil, fmt.Errorf("matrix key %s has no values", key)
+		}
+		next := []map[string]any{}
+		for _, combo := range combos {
+			for _, value := range values {
+				c := maps.Clone(combo)
+				c[key] = value
+				next = append(next, c)
+			}
+		}
+		combos = next
+	}
+	if len(keys) == 0 {
+		combos = []map[string]any{}
+	}
+
+	combos = slices.DeleteFunc(combos, func(combo map[string]any) bool {
+		return slices.ContainsFunc(sb.Exclude, func(rule map[string]any) bool {
+			return matchesRule(combo, rule, nil)
+		})
+	})
+
+	original := len(combos)
+	for _, rule := range sb.Include {
+		matched := false
+		for _, combo := range combos[:original] {
+			// Only the original matrix keys decide a match, so include rules can add new keys to combinations
+			if matchesRule(combo, rule, sb.Matrix) {
+				matched = true
+				for k, v := range rule {
+					if _, ok := sb.Matrix[k]; !ok {
+						combo[k] = v
+					}
+				}
+			}
+		}
+		if !matched {
+			combos = append(combos, maps.Clone(rule))
+		}
+	}
+
+	out := []*SerializedBenchmark{}
+	names := map[string]bool{}
+	for _, combo := range combos {
+		input := maps.Clone(sb.Input)
+		if input == nil {
+			input = map[string]any{}
+		}
+		maps.Copy(input, combo)
+
+		if name, ok := input["Name"].(string); ok {
+			name, err := expandName(name, input)
+			if err != nil {
+				return nil, err
+			}
+			if names[name] {
+				return nil, fmt.Errorf("matrix generated the name %q more than once; add placeholders to the Name input to make it unique", name)
+			}
+			names[name] = true
+			input["Name"] = name
+		}
+
+		out = append(out, &SerializedBenchmark{
+			Type:          sb.Type,
+			Input:         input,
+			Timeouts:      sb.Timeouts,
+			InstanceTypes: sb.InstanceTypes,
+		})
+	}
+	return out, nil
+}
+
+// Returns true if every key in rule appears in combo with an equal value. If matrix is not nil, rule keys which are
+// not matrix keys are ignored.
+func matchesRule(combo map[string]any, rule map[string]any, matrix map[string][]any) bool {
+	for k, v := range rule {
+		if matrix != nil {
+			if _, ok := matrix[k]; !ok {
+				continue
+			}
+		}
+		cv, ok := combo[k]
+		if !ok || !reflect.DeepEqual(cv, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func expandName(name string, input map[string]any) (string, error) {
+	var err error
+	expanded := namePlaceholder.ReplaceAllStringFunc(name, func(m string) string {
+		groups := namePlaceholder.FindStringSubmatch(m)
+		key, format := groups[1], groups[2]
+		value, ok := input[key]
+		if !ok {
+			err = fmt.Errorf("name placeholder %s does not match any input", m)
+			return m
+		}
+		if format == "" {
+			return formatValue(value)
+		}
+		formatFn, ok := nameFormats[format]
+		if !ok {
+			err = fmt.Errorf("name placeholder %s has an unknown format", m)
+			return m
+		}
+		formatted, formatErr := formatFn(value)
+		if formatErr != nil {
+			err = fmt.Errorf("name placeholder %s: %w", m, formatErr)
+			return m
+		}
+		return formatted
+	})
+	return expanded, err
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case float64:
+		// JSON numbers are float64; don't print large integers in scientific notation
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
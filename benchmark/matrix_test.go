@@ -0,0 +1,164 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandSerializedBenchmark(t *testing.T) {
+	tests := []struct {
+		name string
+		sb   string // a SerializedBenchmark as JSON, to get JSON's number types
+		want []map[string]any
+	}{
+		{
+			name: "no matrix",
+			sb:   `{"Input": {"Name": "plain", "PartSize": 5}}`,
+			want: []map[string]any{{"Name": "plain", "PartSize": 5.0}},
+		},
+		{
+			name: "every combination",
+			sb:   `{"Input": {"Name": "{{A}}-{{B}}"}, "Matrix": {"A": [1, 2], "B": ["x", "y"]}}`,
+			want: []map[string]any{
+				{"Name": "1-x", "A": 1.0, "B": "x"},
+				{"Name": "1-y", "A": 1.0, "B": "y"},
+				{"Name": "2-x", "A": 2.0, "B": "x"},
+				{"Name": "2-y", "A": 2.0, "B": "y"},
+			},
+		},
+		{
+			name: "matrix overrides input",
+			sb:   `{"Input": {"Name": "{{A}}", "A": 0, "C": true}, "Matrix": {"A": [1]}}`,
+			want: []map[string]any{{"Name": "1", "A": 1.0, "C": true}},
+		},
+		{
+			name: "exclude",
+			sb: `{"Input": {"Name": "{{A}}-{{B}}"}, "Matrix": {"A": [1, 2], "B": ["x", "y"]},
+				"Exclude": [{"A": 2, "B": "y"}, {"B": "z"}]}`,
+			want: []map[string]any{
+				{"Name": "1-x", "A": 1.0, "B": "x"},
+				{"Name": "1-y", "A": 1.0, "B": "y"},
+				{"Name": "2-x", "A": 2.0, "B": "x"},
+			},
+		},
+		{
+			name: "exclude on a partial combination",
+			sb:   `{"Input": {"Name": "{{A}}-{{B}}"}, "Matrix": {"A": [1, 2], "B": ["x", "y"]}, "Exclude": [{"A": 1}]}`,
+			want: []map[string]any{
+				{"Name": "2-x", "A": 2.0, "B": "x"},
+				{"Name": "2-y", "A": 2.0, "B": "y"},
+			},
+		},
+		{
+			// The example from the GitHub Actions documentation for jobs.<job_id>.strategy.matrix.include
+			name: "include like GitHub Actions",
+			sb: `{"Matrix": {"fruit": ["apple", "pear"], "animal": ["cat", "dog"]},
+				"Include": [
+					{"color": "green"},
+					{"color": "pink", "animal": "cat"},
+					{"fruit": "apple", "shape": "circle"},
+					{"fruit": "banana"},
+					{"fruit": "banana", "animal": "cat"}
+				]}`,
+			want: []map[string]any{
+				{"fruit": "apple", "animal": "cat", "color": "pink", "shape": "circle"},
+				{"fruit": "apple", "animal": "dog", "color": "green", "shape": "circle"},
+				{"fruit": "pear", "animal": "cat", "color": "pink"},
+				{"fruit": "pear", "animal": "dog", "color": "green"},
+				{"fruit": "banana"},
+				{"fruit": "banana", "animal": "cat"},
+			},
+		},
+		{
+			name: "include without a matrix",
+			sb:   `{"Input": {"Name": "go {{A}}"}, "Include": [{"A": 1}, {"A": 2}]}`,
+			want: []map[string]any{
+				{"Name": "go 1", "A": 1.0},
+				{"Name": "go 2", "A": 2.0},
+			},
+		},
+		{
+			name: "name formats",
+			sb: `{"Input": {"Name": "partsize={{ PartSize | MiB }}, raw={{PartSize}}"},
+				"Matrix": {"PartSize": [5242880, 10485760]}}`,
+			want: []map[string]any{
+				{"Name": "partsize=5MiB, raw=5242880", "PartSize": 5242880.0},
+				{"Name": "partsize=10MiB, raw=10485760", "PartSize": 10485760.0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := &SerializedBenchmark{}
+			if err := json.Unmarshal([]byte(tt.sb), sb); err != nil {
+				t.Fatal(err)
+			}
+			out, err := ExpandSerializedBenchmark(sb)
+			if err != nil {
+				t.Fatalf("expanding failed: %v", err)
+			}
+			got := []map[string]any{}
+			for _, o := range out {
+				got = append(got, o.Input)
+			}
+			if !sameCombinations(got, tt.want) {
+				t.Errorf("expanded to\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Compares combinations regardless of order.
+func sameCombinations(got, want []map[string]any) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	used := make([]bool, len(got))
+	for _, w := range want {
+		i := slices.IndexFunc(got, func(g map[string]any) bool { return reflect.DeepEqual(g, w) })
+		for i >= 0 && used[i] {
+			j := slices.IndexFunc(got[i+1:], func(g map[string]any) bool { return reflect.DeepEqual(g, w) })
+			if j < 0 {
+				i = -1
+			} else {
+				i += j + 1
+			}
+		}
+		if i < 0 {
+			return false
+		}
+		used[i] = true
+	}
+	return true
+}
+
+func TestExpandSerializedBenchmarkErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		sb      string
+		wantErr string
+	}{
+		{"duplicate names", `{"Input": {"Name": "same"}, "Matrix": {"A": [1, 2]}}`, "more than once"},
+		{"unknown placeholder", `{"Input": {"Name": "{{Missing}}"}, "Matrix": {"A": [1]}}`, "does not match any input"},
+		{"placeholder missing from an included combination", `{"Input": {"Name": "{{A}}-{{B}}"}, "Matrix": {"A": [1]},
+			"Include": [{"A": 1, "B": 2}, {"A": 3}]}`, "{{B}}"},
+		{"unknown format", `{"Input": {"Name": "{{A | GiB}}"}, "Matrix": {"A": [1]}}`, "unknown format"},
+		{"format of a string", `{"Input": {"Name": "{{A | MiB}}"}, "Matrix": {"A": ["x"]}}`, "number of bytes"},
+		{"empty matrix key", `{"Input": {"Name": "{{A}}"}, "Matrix": {"A": []}}`, "has no values"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := &SerializedBenchmark{}
+			if err := json.Unmarshal([]byte(tt.sb), sb); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ExpandSerializedBenchmark(sb)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expanding returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+	"github.com/Octogonapus/S3Benchmark/util"
+)
+
+// Where a benchmark command's shell writes its PID and CPU time on the target.
+type processAccounting struct {
+	pidFile   string
+	timesFile string
+}
+
+func newProcessAccounting() *processAccounting {
+	id := util.Randstring(8)
+	return &processAccounting{
+		pidFile:   fmt.Sprintf("/tmp/s3benchmark-%s.pid", id),
+		timesFile: fmt.Sprintf("/tmp/s3benchmark-%s.times", id),
+	}
+}
+
+// Wraps cmd so that the shell which runs it writes its PID for the process collector and, once cmd exits, the CPU
+// time of every process cmd started and waited for. The output and exit code of cmd are unchanged.
+func (pa *processAccounting) wrap(cmd string) string {
+	return fmt.Sprintf("echo $$ > %s; bash -c %s; rc=$?; times > %s; exit $rc", pa.pidFile, shellQuote(cmd), pa.timesFile)
+}
+
+// Returns the user and system CPU time of the last run of the wrapped command and removes the accounting files.
+func (pa *processAccounting) readCPUTime(ctx context.Context, t target.Target) (float64, float64, error) {
+	out, err := t.RunCommand(ctx, fmt.Sprintf("cat %s; rm -f %s %s", pa.timesFile, pa.pidFile, pa.timesFile))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %s", err, string(out))
+	}
+	return parseTimes(out)
+}
+
+var timesPattern = regexp.MustCompile(`(\d+)m([\d.]+)s\s+(\d+)m([\d.]+)s`)
+
+// Parses the output of the shell's times builtin, which is the user and system time of the shell and then of its
+// children, e.g. "0m0.001s 0m0.002s\n1m2.345s 0m6.789s". Returns the children's times.
+func parseTimes(out []byte) (userSec float64, sysSec float64, err error) {
+	matches := timesPattern.FindAllStringSubmatch(string(out), -1)
+	if len(matches) != 2 {
+		return 0, 0, fmt.Errorf("unexpected output of times: %q", string(out))
+	}
+	seconds := func(min, sec string) float64 {
+		m, _ := strconv.ParseFloat(min, 64)
+		s, _ := strconv.ParseFloat(sec, 64)
+		return 60*m + s
+	}
+	children := matches[1]
+	return seconds(children[1], children[2]), seconds(children[3], children[4]), nil
+}
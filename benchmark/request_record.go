@@ -0,0 +1,41 @@
+package benchmark
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Benchmarks may record their requests by writing one JSON RequestRecord per line to a file on the target and returning
+// its path in BenchmarkOutput.RequestRecordsPath. The runner copies the file back after each run, streams it into the
+// latency histograms, and deletes it, so the records never pass through the command's output.
+type RequestRecord struct {
+	Operation         string // e.g. GetObject
+	Key               string
+	Range             string `json:",omitempty"` // the Range header, if any
+	StartTimeUnixNano int64
+	TTFBSec           float64 // time until the response headers arrived
+	DurationSec       float64 // time until the body was fully transferred
+	Bytes             int64
+	HTTPStatus        int
+	Retries           int
+}
+
+// Reads request records, one JSON object per line, calling fn for each one without holding them all in memory.
+func ReadRequestRecords(r io.Reader, fn func(RequestRecord)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		record := RequestRecord{}
+		err := json.Unmarshal(line, &record)
+		if err != nil {
+			return fmt.Errorf("unmarshalling request record failed: %w", err)
+		}
+		fn(record)
+	}
+	return scanner.Err()
+}
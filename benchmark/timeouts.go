@@ -0,0 +1,97 @@
+package benchmark
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Limits how long a benchmark may take. Zero means no limit. In JSON, each field is a duration string like "30m".
+type Timeouts struct {
+	Benchmark time.Duration // setup and every run together
+	SetUp     time.Duration // the benchmark's setup, including installing its dependencies
+	Run       time.Duration // each run of the benchmark command
+}
+
+type serializedTimeouts struct {
+	Benchmark string `json:",omitempty"`
+	SetUp     string `json:",omitempty"`
+	Run       string `json:",omitempty"`
+}
+
+func (t Timeouts) MarshalJSON() ([]byte, error) {
+	st := serializedTimeouts{}
+	if t.Benchmark > 0 {
+		st.Benchmark = t.Benchmark.String()
+	}
+	if t.SetUp > 0 {
+		st.SetUp = t.SetUp.String()
+	}
+	if t.Run > 0 {
+		st.Run = t.Run.String()
+	}
+	return json.Marshal(st)
+}
+
+func (t *Timeouts) UnmarshalJSON(buf []byte) error {
+	st := serializedTimeouts{}
+	err := json.Unmarshal(buf, &st)
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		value string
+		dst   *time.Duration
+	}{{st.Benchmark, &t.Benchmark}, {st.SetUp, &t.SetUp}, {st.Run, &t.Run}} {
+		if f.value == "" {
+			continue
+		}
+		*f.dst, err = time.ParseDuration(f.value)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	return nil
+}
+
+// Returns t with the nonzero fields of override replacing its own.
+func (t Timeouts) Override(override Timeouts) Timeouts {
+	if override.Benchmark > 0 {
+		t.Benchmark = override.Benchmark
+	}
+	if override.SetUp > 0 {
+		t.SetUp = override.SetUp
+	}
+	if override.Run > 0 {
+		t.Run = override.Run
+	}
+	return t
+}
+
+// The cause of a context which was canceled by a timeout.
+type TimeoutError struct {
+	Phase   string // "benchmark", "setup", or "run"
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Phase, e.Timeout)
+}
+
+// Returns a context which is canceled with a TimeoutError after d, or a plain child of ctx if d is zero.
+func withTimeout(ctx context.Context, phase string, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, d, &TimeoutError{Phase: phase, Timeout: d})
+}
+
+// Returns why ctx is done (e.g. a TimeoutError) in place of err, which is usually just context.DeadlineExceeded.
+// Returns err if ctx is not done.
+func causeOf(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	return context.Cause(ctx)
+}
@@ -1,21 +1,29 @@
 package benchmarkorchestrator
 
 import (
+	"context"
+	"time"
+
 	"github.com/Octogonapus/S3Benchmark/benchmark"
 	objectprovider "github.com/Octogonapus/S3Benchmark/object_provider"
 	"github.com/Octogonapus/S3Benchmark/report"
 )
 
 type BenchmarkConfig struct {
-	ObjectsName   string
-	ObjectsDesc   string
-	ObjectSpecs   []*objectprovider.ObjectSpec
-	ResultDir     string
-	WarmUpObjects bool
+	ObjectsName      string
+	ObjectsDesc      string
+	ObjectSpecs      []*objectprovider.ObjectSpec
+	Objects          objectprovider.ObjectProvider `json:"-"` // reads the objects when warming up locally
+	ResultDir        string
+	WarmUp           *WarmUpConfig `json:",omitempty"` // read the objects before benchmarking. no warm-up if nil.
+	UploadedAt       time.Time     // when the objects finished uploading. zero if they were uploaded by an earlier run.
+	DelayAfterUpload time.Duration // benchmarks start at least this long after UploadedAt, after any warm-up
+	InstanceTypes    []string      `json:",omitempty"` // set by the EC2 orchestrator to every instance type benchmarks run on
 }
 
 type Report struct {
 	Config  *BenchmarkConfig
+	WarmUp  *WarmUpReport `json:",omitempty"`
 	Reports []*report.BenchmarkReport
 }
 
@@ -25,11 +33,12 @@ type BenchmarkOrchestrator interface {
 	AddBenchmark(benchmark.Benchmark) error
 
 	// Set up the environment.
-	SetUp(*BenchmarkConfig) error
+	SetUp(ctx context.Context, cfg *BenchmarkConfig) error
 
-	// Run benchmarks (concurrently) and return a report.
-	RunBenchmarks() (*Report, error)
+	// Run benchmarks (concurrently) and return a report. If ctx is canceled, running benchmarks are killed, the rest
+	// are skipped, and the report holds the results which finished before that.
+	RunBenchmarks(ctx context.Context) (*Report, error)
 
-	// Tear down the environment.
+	// Tear down the environment. Works even if the context given to the other methods was canceled.
 	TearDown() error
 }
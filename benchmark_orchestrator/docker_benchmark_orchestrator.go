@@ -0,0 +1,254 @@
+package benchmarkorchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/benchmark"
+	objectprovider "github.com/Octogonapus/S3Benchmark/object_provider"
+	"github.com/Octogonapus/S3Benchmark/profile"
+	"github.com/Octogonapus/S3Benchmark/report"
+	"github.com/Octogonapus/S3Benchmark/target"
+	"github.com/alitto/pond"
+)
+
+type dockerBenchmarkOrchestrator struct {
+	input      *DockerBenchmarkOrchestratorInput
+	benchmarks []benchmark.Benchmark
+	cfg        *BenchmarkConfig
+}
+
+// The local equivalent of an instance type.
+type ContainerSize struct {
+	Name                 string
+	CPUs                 float64 // unlimited if zero
+	MemoryBytes          int64   // unlimited if zero
+	NetworkBandwidthMbit int     // unlimited if zero
+}
+
+type containerMetadata struct {
+	ContainerSize        string
+	Image                string
+	CPUs                 float64
+	MemoryBytes          int64
+	NetworkBandwidthMbit int
+}
+
+type DockerBenchmarkOrchestratorInput struct {
+	Image                string // must use apt or dnf (e.g. ubuntu:22.04 or amazonlinux:2023) because benchmarks install software
+	Network              string // the docker network to attach containers to, e.g. one shared with a local S3 stand-in
+	Env                  []string
+	ContainerSizes       []*ContainerSize
+	Bucket               string
+	Region               string
+	Endpoint             objectprovider.S3Endpoint // AWS S3 by default. e.g. a MinIO container on Network.
+	S3Prefixes           []netip.Prefix            // used to count connections to S3. optional.
+	ProfilerKind         profile.ProfilerKind
+	ProfileSaveDir       string
+	BenchmarkConcurrency int                // runs all benchmarks in parallel by default
+	BenchmarkRuns        int                // number of times to run each benchmark. 1 = run the benchmark once. 1 by default.
+	Timeouts             benchmark.Timeouts // defaults for benchmarks which don't set their own. no timeouts by default.
+	Collectors           []string           // the system monitor's collectors to run. the default collectors if empty.
+	SampleInterval       time.Duration      // how often the system monitor samples the target. 1s by default and at least 100ms.
+}
+
+// Loads a JSON list of ContainerSize.
+func LoadContainerSizesFromBuf(buf []byte) ([]*ContainerSize, error) {
+	sizes := []*ContainerSize{}
+	err := json.Unmarshal(buf, &sizes)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, size := range sizes {
+		if size.Name == "" {
+			return nil, fmt.Errorf("container size is missing a name")
+		}
+		if names[size.Name] {
+			return nil, fmt.Errorf("container size %s is listed more than once", size.Name)
+		}
+		names[size.Name] = true
+	}
+	return sizes, nil
+}
+
+func NewDockerBenchmarkOrchestrator(input *DockerBenchmarkOrchestratorInput) (*dockerBenchmarkOrchestrator, error) {
+	if input.Image == "" {
+		return nil, fmt.Errorf("an image is required")
+	}
+	if len(input.ContainerSizes) == 0 {
+		return nil, fmt.Errorf("at least one container size is required")
+	}
+	return &dockerBenchmarkOrchestrator{input: input}, nil
+}
+
+// Benchmarks must be Cloners because each container size runs its own copy of the benchmark at the same time.
+func (o *dockerBenchmarkOrchestrator) AddBenchmark(b benchmark.Benchmark) error {
+	if _, ok := benchmark.CloneOf(b); !ok {
+		return fmt.Errorf("benchmark %s can't be copied for each container size; it must implement benchmark.Cloner", b.GetName())
+	}
+	o.benchmarks = append(o.benchmarks, b)
+	return nil
+}
+
+func (o *dockerBenchmarkOrchestrator) SetUp(ctx context.Context, cfg *BenchmarkConfig) error {
+	o.cfg = cfg
+
+	err := validateWarmUp(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(o.cfg.ResultDir, fs.ModePerm)
+}
+
+func (o *dockerBenchmarkOrchestrator) runBenchmark(ctx context.Context, keys []string, b benchmark.Benchmark, size *ContainerSize) *report.BenchmarkReport {
+	meta := containerMetadata{
+		ContainerSize:        size.Name,
+		Image:                o.input.Image,
+		CPUs:                 size.CPUs,
+		MemoryBytes:          size.MemoryBytes,
+		NetworkBandwidthMbit: size.NetworkBandwidthMbit,
+	}
+	fail := func(err error) *report.BenchmarkReport {
+		slog.Error("benchmark failed",
+			slog.String("error", err.Error()),
+			slog.String("benchmark", b.GetName()),
+			slog.String("containerSize", size.Name),
+		)
+		return &report.BenchmarkReport{
+			Name:     b.GetName(),
+			Metadata: []any{meta},
+			Error:    err.Error(),
+		}
+	}
+	if ctx.Err() != nil {
+		return fail(ctx.Err())
+	}
+
+	t := &target.DockerTarget{
+		Image:                o.input.Image,
+		Name:                 *randString(),
+		Network:              o.input.Network,
+		Env:                  o.input.Env,
+		CPUs:                 size.CPUs,
+		MemoryBytes:          size.MemoryBytes,
+		NetworkBandwidthMbit: size.NetworkBandwidthMbit,
+	}
+	err := t.Start()
+	if err != nil {
+		return fail(err)
+	}
+	slog.Debug("started container", slog.String("name", t.Name))
+	defer func() {
+		err := t.Stop()
+		if err != nil {
+			slog.Error("failed to remove container", slog.String("name", t.Name), slog.String("error", err.Error()))
+		}
+	}()
+
+	bctx := &benchmark.BenchmarkContext{
+		Target:            t,
+		DesiredThroughput: float64(size.NetworkBandwidthMbit) / 1000,
+		Bucket:            o.input.Bucket,
+		Keys:              keys,
+		Objects:           o.cfg.ObjectSpecs,
+		Region:            o.input.Region,
+		Endpoint:          o.input.Endpoint,
+	}
+
+	br := benchmark.NewBenchmarkRunner(&benchmark.BenchmarkRunnerInput{
+		Benchmark:      b,
+		ProfilerKind:   o.input.ProfilerKind,
+		ProfileSaveDir: o.input.ProfileSaveDir,
+		Runs:           o.input.BenchmarkRuns,
+		Timeouts:       o.input.Timeouts,
+		Collectors:     o.input.Collectors,
+		SampleInterval: o.input.SampleInterval,
+	})
+	err = br.SetUp(ctx, bctx, o.input.S3Prefixes)
+	if err != nil {
+		return fail(err)
+	}
+
+	rep := br.Run(ctx)
+	rep.Metadata = append(rep.Metadata, meta)
+	return rep
+}
+
+func (o *dockerBenchmarkOrchestrator) RunBenchmarks(ctx context.Context) (*Report, error) {
+	// If this is interrupted, the benchmarks fail right away so the partial report is still returned
+	warmUp, err := prepareObjects(ctx, o.cfg, nil)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, obj := range o.cfg.ObjectSpecs {
+		keys = append(keys, obj.Key)
+	}
+
+	// Setting up a benchmark records things about its container, so each container size gets its own copy of the
+	// benchmark
+	type job struct {
+		b    benchmark.Benchmark
+		size *ContainerSize
+	}
+	jobs := []job{}
+	for _, b := range o.benchmarks {
+		for _, size := range o.input.ContainerSizes {
+			clone, ok := benchmark.CloneOf(b)
+			if !ok {
+				return nil, fmt.Errorf("benchmark %s can't be copied for each container size", b.GetName())
+			}
+			jobs = append(jobs, job{b: clone, size: size})
+		}
+	}
+	reportCh := make(chan *report.BenchmarkReport, len(jobs))
+
+	concurrency := o.input.BenchmarkConcurrency
+	if concurrency == 0 {
+		// unlimited
+		wg := &sync.WaitGroup{}
+		for _, j := range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reportCh <- o.runBenchmark(ctx, keys, j.b, j.size)
+			}()
+		}
+		wg.Wait()
+	} else {
+		pool := pond.New(concurrency, 0, pond.MinWorkers(concurrency))
+		for _, j := range jobs {
+			pool.Submit(func() {
+				reportCh <- o.runBenchmark(ctx, keys, j.b, j.size)
+			})
+		}
+		pool.StopAndWait()
+	}
+
+	close(reportCh)
+
+	rep := &Report{
+		Config:  o.cfg,
+		WarmUp:  warmUp,
+		Reports: []*report.BenchmarkReport{},
+	}
+	for r := range reportCh {
+		rep.Reports = append(rep.Reports, r)
+	}
+	return rep, nil
+}
+
+// Containers are removed after each benchmark so there is nothing to tear down.
+func (o *dockerBenchmarkOrchestrator) TearDown() error {
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
@@ -11,12 +12,15 @@ import (
 	"math/big"
 	"net/netip"
 	"os"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Octogonapus/S3Benchmark/benchmark"
+	objectprovider "github.com/Octogonapus/S3Benchmark/object_provider"
 	"github.com/Octogonapus/S3Benchmark/profile"
 	"github.com/Octogonapus/S3Benchmark/report"
 	"github.com/Octogonapus/S3Benchmark/target"
@@ -31,67 +35,98 @@ import (
 )
 
 type ec2BenchmarkOrchestrator struct {
-	input                *EC2BenchmarkOrchestratorInput
-	benchmarks           []benchmark.Benchmark
-	cfg                  *BenchmarkConfig
-	ec2                  *ec2.Client
-	iam                  *iam.Client
-	s3                   *s3.Client
-	vpcID                *string
-	igwID                *string
-	sgID                 *string
-	subnetID             *string
-	s3EndpointID         *string
-	roleArn              *string
-	roleName             *string
-	roleInlinePolicyName *string
-	insProfArn           *string
-	insProfName          *string
-	keyName              *string
-	keyID                *string
-	signer               ssh.Signer
-	s3Prefixes           []netip.Prefix
-	totalObjectSizeGB    int32
+	input             *EC2BenchmarkOrchestratorInput
+	benchmarks        []benchmark.Benchmark
+	instanceTypes     []ec2Types.InstanceType // for benchmarks which don't set their own. see resolveInstanceTypes.
+	cfg               *BenchmarkConfig
+	ec2               *ec2.Client
+	iam               *iam.Client
+	s3                *s3.Client
+	state             *EC2State
+	stateMu           sync.Mutex // guards state once benchmarks are running
+	signer            ssh.Signer
+	s3Prefixes        []netip.Prefix
+	totalObjectSizeGB int32
+	images            map[ec2Types.ArchitectureType]*resolvedImage // see resolveImage
+	imagesMu          sync.Mutex
 }
 
 type benchmarkResult struct {
-	benchmark    benchmark.Benchmark
-	instanceType ec2Types.InstanceType
-	report       *report.BenchmarkReport
-	err          error
+	benchmark     benchmark.Benchmark
+	instanceType  ec2Types.InstanceType
+	lifecycle     string // "spot" or "on-demand"
+	interrupted   bool   // the Spot instance was reclaimed, so the benchmark should be run again
+	interruptions int
+	report        *report.BenchmarkReport
+	err           error
 }
 
 type benchmarkMetadata struct {
-	InstanceType string
+	InstanceType  string
+	Lifecycle     string `json:",omitempty"`
+	Interruptions int    `json:",omitempty"` // how many Spot instances were reclaimed before this run finished
 }
 
 type EC2BenchmarkOrchestratorInput struct {
 	AwsConfig            aws.Config
-	InstanceTypes        []ec2Types.InstanceType
+	InstanceTypes        []ec2Types.InstanceType // benchmarks which don't set their own instance types run on each of these
+	InstanceTypeQuery    *InstanceTypeQuery      // adds the instance types matching this query to InstanceTypes
 	WaitToInitialize     bool
 	Bucket               string
+	Endpoint             objectprovider.S3Endpoint // AWS S3 by default
 	ProfilerKind         profile.ProfilerKind
 	ProfileSaveDir       string
-	BenchmarkConcurrency int // runs all benchmarks in parallel by default
-	BenchmarkRuns        int // number of times to run each benchmark. 1 = run the benchmark once. 1 by default.
+	BenchmarkConcurrency int                // runs all benchmarks in parallel by default
+	BenchmarkRuns        int                // number of times to run each benchmark. 1 = run the benchmark once. 1 by default.
+	Timeouts             benchmark.Timeouts // defaults for benchmarks which don't set their own. no timeouts by default.
+	Collectors           []string           // the system monitor's collectors to run. the default collectors if empty.
+	SampleInterval       time.Duration      // how often the system monitor samples the target. 1s by default and at least 100ms.
+
+	Spot                   bool   // launch Spot instances instead of on-demand instances
+	SpotMaxPrice           string // the max price per instance hour in USD. the on-demand price by default.
+	SpotFallbackToOnDemand bool   // launch an on-demand instance when there is no Spot capacity at the max price
+	SpotMaxInterruptions   int    // how many times a benchmark is requeued after its Spot instance is reclaimed. 3 by default.
+	CapacityReservationID  string // launch into this capacity reservation. can't be used with Spot.
+	PlacementGroup         string // launch into this existing placement group
+
+	OSImage OSImage // the OS to run instances with. Ubuntu 22.04 by default.
 }
 
 func NewEC2BenchmarkOrchestrator(input *EC2BenchmarkOrchestratorInput) (*ec2BenchmarkOrchestrator, error) {
+	if input.Spot && input.CapacityReservationID != "" {
+		return nil, fmt.Errorf("spot instances can't launch into a capacity reservation")
+	}
+	if input.SpotMaxInterruptions == 0 {
+		input.SpotMaxInterruptions = 3
+	}
+	if input.OSImage == "" {
+		input.OSImage = Ubuntu2204
+	}
+	if _, ok := osImages[input.OSImage]; !ok {
+		return nil, fmt.Errorf("unknown OS image: %s", input.OSImage)
+	}
 	return &ec2BenchmarkOrchestrator{
-		input: input,
-		ec2:   ec2.NewFromConfig(input.AwsConfig),
-		iam:   iam.NewFromConfig(input.AwsConfig),
-		s3:    s3.NewFromConfig(input.AwsConfig),
+		input:  input,
+		images: map[ec2Types.ArchitectureType]*resolvedImage{},
+		ec2:    ec2.NewFromConfig(input.AwsConfig),
+		iam:    iam.NewFromConfig(input.AwsConfig),
+		s3:     s3.NewFromConfig(input.AwsConfig, input.Endpoint.Apply),
 	}, nil
 }
 
+// Benchmarks must be Cloners because each instance type runs its own copy of the benchmark at the same time.
 func (o *ec2BenchmarkOrchestrator) AddBenchmark(b benchmark.Benchmark) error {
+	if _, ok := benchmark.CloneOf(b); !ok {
+		return fmt.Errorf("benchmark %s can't be copied for each instance type; it must implement benchmark.Cloner", b.GetName())
+	}
 	o.benchmarks = append(o.benchmarks, b)
 	return nil
 }
 
-func (o *ec2BenchmarkOrchestrator) SetUp(cfg *BenchmarkConfig) error {
+func (o *ec2BenchmarkOrchestrator) SetUp(ctx context.Context, cfg *BenchmarkConfig) error {
 	o.cfg = cfg
+	// Creating a resource isn't canceled part way through so that its ID is always saved for TearDown
+	createCtx := context.WithoutCancel(ctx)
 
 	sizeBytes := 0
 	for _, obj := range o.cfg.ObjectSpecs {
@@ -99,78 +134,122 @@ func (o *ec2BenchmarkOrchestrator) SetUp(cfg *BenchmarkConfig) error {
 	}
 	o.totalObjectSizeGB = int32(math.Ceil(float64(sizeBytes) / 1e9))
 
-	if o.cfg.WarmUpObjects {
-		// TODO implement object warming
-		return fmt.Errorf("object warming is not implemented")
+	err := validateWarmUp(cfg, true)
+	if err != nil {
+		return err
 	}
 
-	err := os.MkdirAll(o.cfg.ResultDir, fs.ModePerm)
+	err = o.resolveInstanceTypes(ctx)
 	if err != nil {
 		return err
 	}
 
+	err = os.MkdirAll(o.cfg.ResultDir, fs.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// A state file left by an earlier run lists resources which leaked, so it must be cleaned up before it is replaced
+	statePath := path.Join(o.cfg.ResultDir, EC2StateFileName)
+	leftover, err := LoadEC2State(statePath)
+	if err == nil && !leftover.IsEmpty() {
+		return fmt.Errorf("%s lists resources left by run %s; delete them with the cleanup command first", statePath, leftover.RunID)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	runID := *randString()
+	o.state = &EC2State{RunID: runID, Region: o.input.AwsConfig.Region}
+	slog.Info("creating EC2 resources", slog.String("runID", runID),
+		slog.String("stateFile", statePath))
+
 	cidr := aws.String("10.0.0.0/16")
-	vpc, err := o.ec2.CreateVpc(context.Background(), &ec2.CreateVpcInput{
-		CidrBlock: cidr,
-		TagSpecifications: []ec2Types.TagSpecification{{
-			ResourceType: ec2Types.ResourceTypeVpc,
-			Tags: []ec2Types.Tag{{
-				Key:   aws.String("Name"),
-				Value: o.randString(),
-			}},
-		}},
+	vpcTags := runIDTagSpecs(runID, ec2Types.ResourceTypeVpc)
+	vpcTags[0].Tags = append(vpcTags[0].Tags, ec2Types.Tag{Key: aws.String("Name"), Value: aws.String(runID)})
+	vpc, err := o.ec2.CreateVpc(createCtx, &ec2.CreateVpcInput{
+		CidrBlock:         cidr,
+		TagSpecifications: vpcTags,
 	})
 	if err != nil {
 		return err
 	}
 	slog.Debug("created VPC", slog.String("ID", *vpc.Vpc.VpcId))
-	o.vpcID = vpc.Vpc.VpcId
+	err = o.updateState(func(s *EC2State) { s.VpcID = *vpc.Vpc.VpcId })
+	if err != nil {
+		return err
+	}
+	vpcID := vpc.Vpc.VpcId
 
 	// This must be done in two requests
-	_, err = o.ec2.ModifyVpcAttribute(context.Background(), &ec2.ModifyVpcAttributeInput{
-		VpcId:            o.vpcID,
+	_, err = o.ec2.ModifyVpcAttribute(ctx, &ec2.ModifyVpcAttributeInput{
+		VpcId:            vpcID,
 		EnableDnsSupport: &ec2Types.AttributeBooleanValue{Value: aws.Bool(true)},
 	})
 	if err != nil {
 		return err
 	}
-	_, err = o.ec2.ModifyVpcAttribute(context.Background(), &ec2.ModifyVpcAttributeInput{
-		VpcId:              o.vpcID,
+	_, err = o.ec2.ModifyVpcAttribute(ctx, &ec2.ModifyVpcAttributeInput{
+		VpcId:              vpcID,
 		EnableDnsHostnames: &ec2Types.AttributeBooleanValue{Value: aws.Bool(true)},
 	})
 	if err != nil {
 		return err
 	}
 
-	subnet, err := o.ec2.CreateSubnet(context.Background(), &ec2.CreateSubnetInput{
-		VpcId:     o.vpcID,
-		CidrBlock: cidr,
+	// Capacity reservations are in one availability zone, so the subnet must be too
+	var availabilityZone *string
+	if o.input.CapacityReservationID != "" {
+		reservations, err := o.ec2.DescribeCapacityReservations(ctx, &ec2.DescribeCapacityReservationsInput{
+			CapacityReservationIds: []string{o.input.CapacityReservationID},
+		})
+		if err != nil {
+			return err
+		}
+		if len(reservations.CapacityReservations) == 0 {
+			return fmt.Errorf("capacity reservation %s was not found in %s", o.input.CapacityReservationID, o.input.AwsConfig.Region)
+		}
+		availabilityZone = reservations.CapacityReservations[0].AvailabilityZone
+	}
+
+	subnet, err := o.ec2.CreateSubnet(createCtx, &ec2.CreateSubnetInput{
+		VpcId:             vpcID,
+		CidrBlock:         cidr,
+		AvailabilityZone:  availabilityZone,
+		TagSpecifications: runIDTagSpecs(runID, ec2Types.ResourceTypeSubnet),
 	})
 	if err != nil {
 		return err
 	}
 	slog.Debug("created subnet", slog.String("ID", *subnet.Subnet.SubnetId))
-	o.subnetID = subnet.Subnet.SubnetId
+	err = o.updateState(func(s *EC2State) { s.SubnetID = *subnet.Subnet.SubnetId })
+	if err != nil {
+		return err
+	}
 
-	igw, err := o.ec2.CreateInternetGateway(context.Background(), &ec2.CreateInternetGatewayInput{})
+	igw, err := o.ec2.CreateInternetGateway(createCtx, &ec2.CreateInternetGatewayInput{
+		TagSpecifications: runIDTagSpecs(runID, ec2Types.ResourceTypeInternetGateway),
+	})
 	if err != nil {
 		return err
 	}
 	slog.Debug("created internet gateway", slog.String("ID", *igw.InternetGateway.InternetGatewayId))
-	o.igwID = igw.InternetGateway.InternetGatewayId
+	err = o.updateState(func(s *EC2State) { s.InternetGatewayID = *igw.InternetGateway.InternetGatewayId })
+	if err != nil {
+		return err
+	}
 
-	_, err = o.ec2.AttachInternetGateway(context.Background(), &ec2.AttachInternetGatewayInput{
-		InternetGatewayId: o.igwID,
-		VpcId:             o.vpcID,
+	_, err = o.ec2.AttachInternetGateway(ctx, &ec2.AttachInternetGatewayInput{
+		InternetGatewayId: igw.InternetGateway.InternetGatewayId,
+		VpcId:             vpcID,
 	})
 	if err != nil {
 		return err
 	}
 
 	// The VPC comes with a main route table so we don't make one
-	routeTable, err := o.ec2.DescribeRouteTables(context.Background(), &ec2.DescribeRouteTablesInput{
+	routeTable, err := o.ec2.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{
 		Filters: []ec2Types.Filter{
-			{Name: aws.String("vpc-id"), Values: []string{*o.vpcID}},
+			{Name: aws.String("vpc-id"), Values: []string{*vpcID}},
 		},
 	})
 	if err != nil {
@@ -178,30 +257,34 @@ func (o *ec2BenchmarkOrchestrator) SetUp(cfg *BenchmarkConfig) error {
 	}
 	routeTableID := routeTable.RouteTables[0].RouteTableId
 
-	_, err = o.ec2.CreateRoute(context.Background(), &ec2.CreateRouteInput{
+	_, err = o.ec2.CreateRoute(ctx, &ec2.CreateRouteInput{
 		RouteTableId:         routeTableID,
 		DestinationCidrBlock: aws.String("0.0.0.0/0"),
-		GatewayId:            o.igwID,
+		GatewayId:            igw.InternetGateway.InternetGatewayId,
 	})
 	if err != nil {
 		return err
 	}
 
 	regionalS3ServiceName := aws.String(fmt.Sprintf("com.amazonaws.%s.s3", o.input.AwsConfig.Region))
-	s3Endpoint, err := o.ec2.CreateVpcEndpoint(context.Background(), &ec2.CreateVpcEndpointInput{
-		VpcId:           o.vpcID,
-		ServiceName:     regionalS3ServiceName,
-		VpcEndpointType: ec2Types.VpcEndpointTypeGateway,
-		RouteTableIds:   []string{*routeTableID},
+	s3Endpoint, err := o.ec2.CreateVpcEndpoint(createCtx, &ec2.CreateVpcEndpointInput{
+		VpcId:             vpcID,
+		ServiceName:       regionalS3ServiceName,
+		VpcEndpointType:   ec2Types.VpcEndpointTypeGateway,
+		RouteTableIds:     []string{*routeTableID},
+		TagSpecifications: runIDTagSpecs(runID, ec2Types.ResourceTypeVpcEndpoint),
 	})
 	if err != nil {
 		return err
 	}
 	slog.Debug("created S3 endpoint", slog.String("ID", *s3Endpoint.VpcEndpoint.VpcEndpointId))
-	o.s3EndpointID = s3Endpoint.VpcEndpoint.VpcEndpointId
+	err = o.updateState(func(s *EC2State) { s.S3EndpointID = *s3Endpoint.VpcEndpoint.VpcEndpointId })
+	if err != nil {
+		return err
+	}
 
 	// After we add the S3 endpoint it will add a route with a prefix list containing S3 CIDRs. We need to collect these.
-	routeTableAfterS3Endpoint, err := o.ec2.DescribeRouteTables(context.Background(), &ec2.DescribeRouteTablesInput{
+	routeTableAfterS3Endpoint, err := o.ec2.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{
 		RouteTableIds: []string{*routeTableID},
 	})
 	if err != nil {
@@ -209,7 +292,7 @@ func (o *ec2BenchmarkOrchestrator) SetUp(cfg *BenchmarkConfig) error {
 	}
 	for _, route := range routeTableAfterS3Endpoint.RouteTables[0].Routes {
 		if route.DestinationPrefixListId != nil {
-			pl, err := o.ec2.GetManagedPrefixListEntries(context.Background(), &ec2.GetManagedPrefixListEntriesInput{
+			pl, err := o.ec2.GetManagedPrefixListEntries(ctx, &ec2.GetManagedPrefixListEntriesInput{
 				PrefixListId: route.DestinationPrefixListId,
 			})
 			if err != nil {
@@ -225,19 +308,23 @@ func (o *ec2BenchmarkOrchestrator) SetUp(cfg *BenchmarkConfig) error {
 		}
 	}
 
-	sg, err := o.ec2.CreateSecurityGroup(context.Background(), &ec2.CreateSecurityGroupInput{
-		GroupName:   o.randString(),
-		Description: o.randString(),
-		VpcId:       o.vpcID,
+	sg, err := o.ec2.CreateSecurityGroup(createCtx, &ec2.CreateSecurityGroupInput{
+		GroupName:         randString(),
+		Description:       randString(),
+		VpcId:             vpcID,
+		TagSpecifications: runIDTagSpecs(runID, ec2Types.ResourceTypeSecurityGroup),
 	})
 	if err != nil {
 		return err
 	}
 	slog.Debug("created security group", slog.String("ID", *sg.GroupId))
-	o.sgID = sg.GroupId
+	err = o.updateState(func(s *EC2State) { s.SecurityGroupID = *sg.GroupId })
+	if err != nil {
+		return err
+	}
 
-	_, err = o.ec2.AuthorizeSecurityGroupIngress(context.Background(), &ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId: o.sgID,
+	_, err = o.ec2.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId: sg.GroupId,
 		IpPermissions: []ec2Types.IpPermission{
 			{
 				FromPort:   aws.Int32(22),
@@ -263,24 +350,32 @@ func (o *ec2BenchmarkOrchestrator) SetUp(cfg *BenchmarkConfig) error {
 	if err != nil {
 		return err
 	}
-	role, err := o.iam.CreateRole(context.Background(), &iam.CreateRoleInput{
-		RoleName:                 o.randString(),
+	role, err := o.iam.CreateRole(createCtx, &iam.CreateRoleInput{
+		RoleName:                 randString(),
+		Path:                     iamPath(runID),
 		AssumeRolePolicyDocument: aws.String(string(assumePolicyDoc)),
 		MaxSessionDuration:       aws.Int32(int32((12 * time.Hour).Seconds())),
+		Tags:                     runIDIAMTags(runID),
 	})
 	if err != nil {
 		return err
 	}
-	o.roleArn = role.Role.Arn
-	o.roleName = role.Role.RoleName
-	slog.Debug("created role", slog.String("name", *o.roleName))
+	slog.Debug("created role", slog.String("name", *role.Role.RoleName))
+	err = o.updateState(func(s *EC2State) { s.RoleName = *role.Role.RoleName })
+	if err != nil {
+		return err
+	}
 
+	actions := []string{"s3:GetObject", "s3:ListBucket"}
+	if slices.ContainsFunc(o.benchmarks, benchmark.WritesObjects) {
+		actions = append(actions, "s3:PutObject", "s3:DeleteObject", "s3:AbortMultipartUpload", "s3:ListMultipartUploadParts")
+	}
 	policy := PolicyDocument{
 		Version: "2012-10-17",
 		Statement: []StatementEntry{
 			{
 				Effect:   "Allow",
-				Action:   []string{"s3:GetObject", "s3:ListBucket"},
+				Action:   actions,
 				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/*", o.input.Bucket), fmt.Sprintf("arn:aws:s3:::%s", o.input.Bucket)},
 			},
 		},
@@ -289,88 +384,114 @@ func (o *ec2BenchmarkOrchestrator) SetUp(cfg *BenchmarkConfig) error {
 	if err != nil {
 		return err
 	}
-	o.roleInlinePolicyName = aws.String("inline")
-	_, err = o.iam.PutRolePolicy(context.Background(), &iam.PutRolePolicyInput{
+	_, err = o.iam.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
 		RoleName:       role.Role.RoleName,
-		PolicyName:     o.roleInlinePolicyName,
+		PolicyName:     aws.String("inline"),
 		PolicyDocument: aws.String(string(policyDoc)),
 	})
 	if err != nil {
 		return err
 	}
 
-	insProf, err := o.iam.CreateInstanceProfile(context.Background(), &iam.CreateInstanceProfileInput{
-		InstanceProfileName: o.randString(),
+	insProf, err := o.iam.CreateInstanceProfile(createCtx, &iam.CreateInstanceProfileInput{
+		InstanceProfileName: randString(),
+		Path:                iamPath(runID),
+		Tags:                runIDIAMTags(runID),
 	})
 	if err != nil {
 		return err
 	}
-	o.insProfArn = insProf.InstanceProfile.Arn
-	o.insProfName = insProf.InstanceProfile.InstanceProfileName
-	slog.Debug("created instance profile", slog.String("name", *o.insProfName))
+	slog.Debug("created instance profile", slog.String("name", *insProf.InstanceProfile.InstanceProfileName))
+	err = o.updateState(func(s *EC2State) { s.InstanceProfileName = *insProf.InstanceProfile.InstanceProfileName })
+	if err != nil {
+		return err
+	}
 
-	o.iam.AddRoleToInstanceProfile(context.Background(), &iam.AddRoleToInstanceProfileInput{
+	o.iam.AddRoleToInstanceProfile(ctx, &iam.AddRoleToInstanceProfileInput{
 		InstanceProfileName: insProf.InstanceProfile.InstanceProfileName,
 		RoleName:            role.Role.RoleName,
 	})
 
-	keyPair, err := o.ec2.CreateKeyPair(context.Background(), &ec2.CreateKeyPairInput{
-		KeyName:   o.randString(),
-		KeyType:   ec2Types.KeyTypeEd25519,
-		KeyFormat: ec2Types.KeyFormatPem,
+	keyPair, err := o.ec2.CreateKeyPair(createCtx, &ec2.CreateKeyPairInput{
+		KeyName:           randString(),
+		KeyType:           ec2Types.KeyTypeEd25519,
+		KeyFormat:         ec2Types.KeyFormatPem,
+		TagSpecifications: runIDTagSpecs(runID, ec2Types.ResourceTypeKeyPair),
+	})
+	if err != nil {
+		return err
+	}
+	slog.Debug("created key pair", slog.String("ID", *keyPair.KeyPairId))
+	err = o.updateState(func(s *EC2State) {
+		s.KeyPairID = *keyPair.KeyPairId
+		s.KeyName = *keyPair.KeyName
 	})
 	if err != nil {
 		return err
 	}
-	o.keyName = keyPair.KeyName
-	o.keyID = keyPair.KeyPairId
-	slog.Debug("created key pair", slog.String("ID", *o.keyID))
 	o.signer, err = ssh.ParsePrivateKey([]byte(*keyPair.KeyMaterial))
 	if err != nil {
 		return err
 	}
 
 	// IAM needs a few seconds to propagate the instance profile
-	time.Sleep(10 * time.Second)
-
-	return nil
+	return util.Sleep(ctx, 10*time.Second)
 }
 
+// A warm-up is run once and never profiled, regardless of the benchmark runs and profiler configured for the run.
 func (o *ec2BenchmarkOrchestrator) runBenchmark(
-	resultCh chan *benchmarkResult,
-	keys []string,
+	ctx context.Context,
+	objects []*objectprovider.ObjectSpec,
 	b benchmark.Benchmark,
 	instanceType ec2Types.InstanceType,
-) {
+	warmUp bool,
+) *benchmarkResult {
 	// Random jitter to offset each benchmark when we start lots of them at once
 	nBig, err := rand.Int(rand.Reader, big.NewInt(10))
 	if err != nil {
 		panic(err)
 	}
 	n := nBig.Int64()
-	time.Sleep(time.Duration(n * int64(time.Second)))
 
 	result := &benchmarkResult{
 		benchmark:    b,
 		instanceType: instanceType,
 	}
 
-	resp, err := o.ec2.DescribeInstanceTypes(context.Background(), &ec2.DescribeInstanceTypesInput{
+	err = util.Sleep(ctx, time.Duration(n*int64(time.Second)))
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	resp, err := o.ec2.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
 		InstanceTypes: []ec2Types.InstanceType{instanceType},
 	})
 	if err != nil {
 		result.err = err
-		resultCh <- result
-		return
+		return result
 	}
 
-	instance, err := o.launchInstance(instanceType)
+	image, err := o.resolveImage(ctx, instanceArchitecture(&resp.InstanceTypes[0]))
 	if err != nil {
 		result.err = err
-		resultCh <- result
-		return
+		return result
+	}
+
+	instance, err := o.launchInstance(ctx, instanceType, image)
+	if err != nil {
+		result.err = err
+		return result
 	}
 	instanceID := instance.Instances[0].InstanceId
+	result.lifecycle = "on-demand"
+	if instance.Instances[0].InstanceLifecycle == ec2Types.InstanceLifecycleTypeSpot {
+		result.lifecycle = "spot"
+	}
+	err = o.updateState(func(s *EC2State) { s.InstanceIDs = append(s.InstanceIDs, *instanceID) })
+	if err != nil {
+		slog.Error("failed to save EC2 state", slog.String("instanceID", *instanceID), slog.String("error", err.Error()))
+	}
 	defer func() {
 		_, err := o.ec2.TerminateInstances(context.Background(), &ec2.TerminateInstancesInput{
 			InstanceIds: []string{*instanceID},
@@ -386,6 +507,12 @@ func (o *ec2BenchmarkOrchestrator) runBenchmark(
 			})
 			if err == nil && len(resp.Reservations) > 0 &&
 				resp.Reservations[0].Instances[0].State.Name == ec2Types.InstanceStateNameTerminated {
+				err = o.updateState(func(s *EC2State) {
+					s.InstanceIDs = slices.DeleteFunc(s.InstanceIDs, func(id string) bool { return id == *instanceID })
+				})
+				if err != nil {
+					slog.Error("failed to save EC2 state", slog.String("instanceID", *instanceID), slog.String("error", err.Error()))
+				}
 				break
 			}
 			if err != nil {
@@ -397,11 +524,23 @@ func (o *ec2BenchmarkOrchestrator) runBenchmark(
 		}
 	}()
 
+	// Canceled if the Spot instance is reclaimed. Runs before the instance is terminated above.
+	ctx, interrupt := context.WithCancelCause(ctx)
+	defer interrupt(nil)
+	if result.lifecycle == "spot" {
+		defer func() {
+			failed := result.err != nil || (result.report != nil && result.report.Error != "")
+			if failed && o.wasSpotInterrupted(ctx, *instanceID) {
+				result.interrupted = true
+			}
+		}()
+	}
+
 	// Wait for the instance to finish initializing
 	if o.input.WaitToInitialize {
 		var status *ec2.DescribeInstanceStatusOutput
 		for i := 0; i < 5; i++ {
-			status, err = o.ec2.DescribeInstanceStatus(context.Background(), &ec2.DescribeInstanceStatusInput{
+			status, err = o.ec2.DescribeInstanceStatus(ctx, &ec2.DescribeInstanceStatusInput{
 				InstanceIds:         []string{*instanceID},
 				IncludeAllInstances: aws.Bool(true),
 			})
@@ -417,99 +556,133 @@ func (o *ec2BenchmarkOrchestrator) runBenchmark(
 				slog.Debug("waiting for instance to finish initializing")
 			}
 
-			time.Sleep(60 * time.Second)
+			err = util.Sleep(ctx, 60*time.Second)
+			if err != nil {
+				break
+			}
 		}
 		if err != nil {
 			result.err = err
-			resultCh <- result
-			return
+			return result
 		}
 	}
 
-	instanceIP, err := o.getInstanceIP(instanceID)
+	instanceIP, err := o.getInstanceIP(ctx, instanceID)
 	if err != nil {
 		result.err = err
-		resultCh <- result
-		return
+		return result
 	}
 	slog.Debug("instance got IP", slog.String("instanceID", *instanceID), slog.String("ip", *instanceIP))
 
 	target := &target.SSHTarget{
-		User:    aws.String("ubuntu"),
+		User:    aws.String(image.spec.user),
 		IP:      instanceIP,
 		SSHPort: 22,
 		Auths:   []ssh.AuthMethod{ssh.PublicKeys(o.signer)},
 	}
 
-	err = o.waitForTargetReachable(target)
+	err = o.waitForTargetReachable(ctx, target, image.spec.user)
 	if err != nil {
 		slog.Error("instance is not reachable", slog.String("instanceID", *instanceID), slog.String("error", err.Error()))
 		result.err = err
-		resultCh <- result
-		return
+		return result
 	}
 
-	err = o.configureForRootLogin(target)
+	err = o.configureForRootLogin(ctx, target, image.spec.sshService)
 	if err != nil {
 		slog.Error("failed to configure target for root login", slog.String("instanceID", *instanceID), slog.String("error", err.Error()))
 		result.err = err
-		resultCh <- result
-		return
+		return result
 	}
 	target.User = aws.String("root")
 
-	ctx := &benchmark.BenchmarkContext{
+	if result.lifecycle == "spot" {
+		go watchSpotInterruption(ctx, target, *instanceID, interrupt)
+	}
+
+	keys := []string{}
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	bctx := &benchmark.BenchmarkContext{
 		Target:            target,
-		DesiredThroughput: *resp.InstanceTypes[0].NetworkInfo.NetworkCards[0].BaselineBandwidthInGbps,
+		DesiredThroughput: baselineBandwidthGbps(&resp.InstanceTypes[0]),
 		Bucket:            o.input.Bucket,
 		Keys:              keys,
+		Objects:           objects,
 		Region:            o.input.AwsConfig.Region,
-	}
-
-	br := benchmark.NewBenchmarkRunner(b, o.input.ProfilerKind, o.input.ProfileSaveDir, o.input.BenchmarkRuns)
-	err = br.SetUp(ctx, o.s3Prefixes)
+		Endpoint:          o.input.Endpoint,
+	}
+
+	profilerKind := o.input.ProfilerKind
+	runs := o.input.BenchmarkRuns
+	if warmUp {
+		profilerKind = profile.None
+		runs = 1
+	}
+	br := benchmark.NewBenchmarkRunner(&benchmark.BenchmarkRunnerInput{
+		Benchmark:      b,
+		ProfilerKind:   profilerKind,
+		ProfileSaveDir: o.input.ProfileSaveDir,
+		Runs:           runs,
+		Timeouts:       o.input.Timeouts,
+		Collectors:     o.input.Collectors,
+		SampleInterval: o.input.SampleInterval,
+	})
+	err = br.SetUp(ctx, bctx, o.s3Prefixes)
 	if err != nil {
 		slog.Error("benchmark setup failed", slog.String("benchmarkName", b.GetName()), slog.String("error", err.Error()))
 		result.err = err
-		resultCh <- result
-		return
+		return result
 	}
 
-	result.report = br.Run()
-	resultCh <- result
+	result.report = br.Run(ctx)
+	return result
 }
 
-func (o *ec2BenchmarkOrchestrator) RunBenchmarks() (*Report, error) {
-	keys := []string{}
-	for _, obj := range o.cfg.ObjectSpecs {
-		keys = append(keys, obj.Key)
+func (o *ec2BenchmarkOrchestrator) RunBenchmarks(ctx context.Context) (*Report, error) {
+	// If this is interrupted, the benchmarks fail right away so the partial report is still returned
+	warmUp, err := prepareObjects(ctx, o.cfg, o.warmUpOnInstance)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+
+	// Setting up a benchmark records things about its instance, e.g. its architecture, so each instance type gets its
+	// own copy of the benchmark
+	type job struct {
+		b            benchmark.Benchmark
+		instanceType ec2Types.InstanceType
+	}
+	jobs := []job{}
+	for _, b := range o.benchmarks {
+		for _, instanceType := range o.instanceTypesFor(b) {
+			clone, ok := benchmark.CloneOf(b)
+			if !ok {
+				return nil, fmt.Errorf("benchmark %s can't be copied for each instance type", b.GetName())
+			}
+			jobs = append(jobs, job{b: clone, instanceType: instanceType})
+		}
 	}
-
-	ntotal := len(o.benchmarks) * len(o.input.InstanceTypes)
-	resultCh := make(chan *benchmarkResult, ntotal)
+	resultCh := make(chan *benchmarkResult, len(jobs))
 
 	concurrency := o.input.BenchmarkConcurrency
 	if concurrency == 0 {
 		// unlimited
 		wg := &sync.WaitGroup{}
-		for _, b := range o.benchmarks {
-			for _, instanceType := range o.input.InstanceTypes {
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					o.runBenchmark(resultCh, keys, b, instanceType) // gopls complains but we use 1.22
-				}()
-			}
+		for _, j := range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resultCh <- o.runWithRequeue(ctx, o.cfg.ObjectSpecs, j.b, j.instanceType, false) // gopls complains but we use 1.22
+			}()
 		}
 		wg.Wait()
 	} else {
 		pool := pond.New(concurrency, 0, pond.MinWorkers(concurrency))
-		for _, b := range o.benchmarks {
-			for _, instanceType := range o.input.InstanceTypes {
-				pool.Submit(func() {
-					o.runBenchmark(resultCh, keys, b, instanceType)
-				})
-			}
+		for _, j := range jobs {
+			pool.Submit(func() {
+				resultCh <- o.runWithRequeue(ctx, o.cfg.ObjectSpecs, j.b, j.instanceType, false)
+			})
 		}
 		pool.StopAndWait()
 	}
@@ -518,11 +691,14 @@ func (o *ec2BenchmarkOrchestrator) RunBenchmarks() (*Report, error) {
 
 	rep := &Report{
 		Config:  o.cfg,
+		WarmUp:  warmUp,
 		Reports: []*report.BenchmarkReport{},
 	}
 	for result := range resultCh {
 		meta := benchmarkMetadata{
-			InstanceType: string(result.instanceType),
+			InstanceType:  string(result.instanceType),
+			Lifecycle:     result.lifecycle,
+			Interruptions: result.interruptions,
 		}
 		if result.err == nil {
 			result.report.Metadata = append(result.report.Metadata, meta)
@@ -543,6 +719,76 @@ func (o *ec2BenchmarkOrchestrator) RunBenchmarks() (*Report, error) {
 	return rep, nil
 }
 
+// Runs the benchmark, running it again on a new instance each time its Spot instance is reclaimed.
+func (o *ec2BenchmarkOrchestrator) runWithRequeue(
+	ctx context.Context,
+	objects []*objectprovider.ObjectSpec,
+	b benchmark.Benchmark,
+	instanceType ec2Types.InstanceType,
+	warmUp bool,
+) *benchmarkResult {
+	for interruptions := 0; ; interruptions++ {
+		result := o.runBenchmark(ctx, objects, b, instanceType, warmUp)
+		result.interruptions = interruptions
+		if !result.interrupted || ctx.Err() != nil {
+			return result
+		}
+		if interruptions >= o.input.SpotMaxInterruptions {
+			result.err = fmt.Errorf("spot instance was interrupted %d times", interruptions+1)
+			return result
+		}
+		slog.Warn("requeueing benchmark on a new instance because its spot instance was interrupted",
+			slog.String("benchmark", b.GetName()),
+			slog.String("instanceType", string(instanceType)),
+		)
+	}
+}
+
+// Warms up the objects by running the go benchmark on a dedicated instance, which reads every object once per pass.
+func (o *ec2BenchmarkOrchestrator) warmUpOnInstance(
+	ctx context.Context,
+	warmUp *WarmUpConfig,
+	objects []*objectprovider.ObjectSpec,
+) (*WarmUpReport, error) {
+	b, err := benchmark.DeserializeBenchmark(&benchmark.SerializedBenchmark{
+		Type: "go",
+		Input: map[string]any{
+			"Name":                "warm-up",
+			"Operation":           "download",
+			"DownloadConcurrency": warmUp.Concurrency,
+			"Repeats":             warmUp.Passes,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("warming up from an instance needs the go benchmark: %w", err)
+	}
+
+	instanceType := ec2Types.InstanceType(warmUp.InstanceType)
+	if instanceType == "" {
+		if len(o.cfg.InstanceTypes) == 0 {
+			return nil, fmt.Errorf("no instance type to warm up from")
+		}
+		instanceType = ec2Types.InstanceType(o.cfg.InstanceTypes[0])
+		if len(o.instanceTypes) > 0 {
+			instanceType = o.instanceTypes[0]
+		}
+	}
+
+	result := o.runWithRequeue(ctx, objects, b, instanceType, true)
+	if result.err != nil {
+		return nil, result.err
+	}
+	if result.report.Error != "" {
+		return nil, errors.New(result.report.Error)
+	}
+	if len(result.report.BytesTransferred) == 0 || len(result.report.TotalTimeSec) == 0 {
+		return nil, fmt.Errorf("the warm-up didn't report how much it read")
+	}
+	rep := newWarmUpReport(warmUp, objects, result.report.BytesTransferred[0], result.report.TotalTimeSec[0])
+	rep.InstanceType = string(instanceType)
+	return rep, nil
+}
+
 func ParseNetworkPerformance(perf string) (int, error) {
 	parts := strings.Fields(perf)
 	unit := parts[len(parts)-1]
@@ -553,55 +799,97 @@ func ParseNetworkPerformance(perf string) (int, error) {
 	return 0, fmt.Errorf("unknown unit: %s", unit)
 }
 
-func (o *ec2BenchmarkOrchestrator) launchInstance(instanceType ec2Types.InstanceType) (*ec2.RunInstancesOutput, error) {
+func (o *ec2BenchmarkOrchestrator) launchInstance(ctx context.Context, instanceType ec2Types.InstanceType, image *resolvedImage) (*ec2.RunInstancesOutput, error) {
+	spot := o.input.Spot
 	var resp *ec2.RunInstancesOutput
 	var err error
 	for i := 0; i < 5; i++ {
-		resp, err = o.ec2.RunInstances(context.Background(), &ec2.RunInstancesInput{
-			MinCount:     aws.Int32(1),
-			MaxCount:     aws.Int32(1),
-			EbsOptimized: aws.Bool(true),
-			ImageId:      aws.String("ami-05fb0b8c1424f266b"), // ubuntu 22.04 from canonical
-			BlockDeviceMappings: []ec2Types.BlockDeviceMapping{
-				{
-					DeviceName: aws.String("/dev/sda1"),
-					// TODO maybe expose EBS volume eventually? for our testing it is not necessary but there are higher throughput options
-					Ebs: &ec2Types.EbsBlockDevice{
-						VolumeSize:          aws.Int32(max(o.totalObjectSizeGB+10, 32)),
-						VolumeType:          ec2Types.VolumeTypeGp3,
-						Iops:                aws.Int32(16000),
-						Throughput:          aws.Int32(1000),
-						DeleteOnTermination: aws.Bool(true),
-						Encrypted:           aws.Bool(true),
-					},
-				},
-			},
-			InstanceType: instanceType,
-			KeyName:      o.keyName,
-			NetworkInterfaces: []ec2Types.InstanceNetworkInterfaceSpecification{
-				{
-					DeviceIndex:              aws.Int32(0),
-					AssociatePublicIpAddress: aws.Bool(true),
-					Groups:                   []string{*o.sgID},
-					SubnetId:                 o.subnetID,
-					DeleteOnTermination:      aws.Bool(true),
-				},
-			},
-			IamInstanceProfile: &ec2Types.IamInstanceProfileSpecification{Name: o.insProfName},
-		})
+		// Launching isn't canceled part way through so that the instance ID is always saved for TearDown
+		resp, err = o.ec2.RunInstances(context.WithoutCancel(ctx), o.runInstancesInput(instanceType, image, spot))
 		if err == nil {
-			slog.Debug("launched instance", slog.String("instanceID", *resp.Instances[0].InstanceId))
+			slog.Debug("launched instance",
+				slog.String("instanceID", *resp.Instances[0].InstanceId),
+				slog.Bool("spot", spot),
+			)
 			return resp, err
 		}
+		if spot && o.input.SpotFallbackToOnDemand && isSpotCapacityError(err) {
+			slog.Warn("no spot capacity, falling back to on-demand", slog.String("instanceType", string(instanceType)), slog.String("error", err.Error()))
+			spot = false
+			continue
+		}
 		slog.Debug("waiting to launch instance", slog.String("error", err.Error()))
-		time.Sleep(60 * time.Second)
+		if sleepErr := util.Sleep(ctx, 60*time.Second); sleepErr != nil {
+			return nil, sleepErr
+		}
 	}
 	return nil, fmt.Errorf("failed to launch instance: %w", err)
 }
 
-func (o *ec2BenchmarkOrchestrator) getInstanceIP(instanceID *string) (*string, error) {
+func (o *ec2BenchmarkOrchestrator) runInstancesInput(instanceType ec2Types.InstanceType, image *resolvedImage, spot bool) *ec2.RunInstancesInput {
+	input := &ec2.RunInstancesInput{
+		MinCount:     aws.Int32(1),
+		MaxCount:     aws.Int32(1),
+		EbsOptimized: aws.Bool(true),
+		ImageId:      aws.String(image.id),
+		BlockDeviceMappings: []ec2Types.BlockDeviceMapping{
+			{
+				DeviceName: aws.String(image.rootDeviceName),
+				// TODO maybe expose EBS volume eventually? for our testing it is not necessary but there are higher throughput options
+				Ebs: &ec2Types.EbsBlockDevice{
+					VolumeSize:          aws.Int32(max(o.totalObjectSizeGB+10, 32)),
+					VolumeType:          ec2Types.VolumeTypeGp3,
+					Iops:                aws.Int32(16000),
+					Throughput:          aws.Int32(1000),
+					DeleteOnTermination: aws.Bool(true),
+					Encrypted:           aws.Bool(true),
+				},
+			},
+		},
+		InstanceType: instanceType,
+		KeyName:      aws.String(o.state.KeyName),
+		NetworkInterfaces: []ec2Types.InstanceNetworkInterfaceSpecification{
+			{
+				DeviceIndex:              aws.Int32(0),
+				AssociatePublicIpAddress: aws.Bool(true),
+				Groups:                   []string{o.state.SecurityGroupID},
+				SubnetId:                 aws.String(o.state.SubnetID),
+				DeleteOnTermination:      aws.Bool(true),
+			},
+		},
+		IamInstanceProfile: &ec2Types.IamInstanceProfileSpecification{Name: aws.String(o.state.InstanceProfileName)},
+		TagSpecifications: runIDTagSpecs(o.state.RunID,
+			ec2Types.ResourceTypeInstance, ec2Types.ResourceTypeVolume, ec2Types.ResourceTypeNetworkInterface),
+	}
+	if spot {
+		spotOptions := &ec2Types.SpotMarketOptions{
+			SpotInstanceType:             ec2Types.SpotInstanceTypeOneTime,
+			InstanceInterruptionBehavior: ec2Types.InstanceInterruptionBehaviorTerminate,
+		}
+		if o.input.SpotMaxPrice != "" {
+			spotOptions.MaxPrice = aws.String(o.input.SpotMaxPrice)
+		}
+		input.InstanceMarketOptions = &ec2Types.InstanceMarketOptionsRequest{
+			MarketType:  ec2Types.MarketTypeSpot,
+			SpotOptions: spotOptions,
+		}
+	}
+	if o.input.CapacityReservationID != "" {
+		input.CapacityReservationSpecification = &ec2Types.CapacityReservationSpecification{
+			CapacityReservationTarget: &ec2Types.CapacityReservationTarget{
+				CapacityReservationId: aws.String(o.input.CapacityReservationID),
+			},
+		}
+	}
+	if o.input.PlacementGroup != "" {
+		input.Placement = &ec2Types.Placement{GroupName: aws.String(o.input.PlacementGroup)}
+	}
+	return input
+}
+
+func (o *ec2BenchmarkOrchestrator) getInstanceIP(ctx context.Context, instanceID *string) (*string, error) {
 	for i := 0; i < 10; i++ {
-		resp, err := o.ec2.DescribeInstances(context.Background(), &ec2.DescribeInstancesInput{
+		resp, err := o.ec2.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
 			InstanceIds: []string{*instanceID},
 		})
 		if err != nil {
@@ -613,17 +901,23 @@ func (o *ec2BenchmarkOrchestrator) getInstanceIP(instanceID *string) (*string, e
 			return ip, nil
 		}
 
-		time.Sleep(3 * time.Second)
+		err = util.Sleep(ctx, 3*time.Second)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return nil, fmt.Errorf("failed to get instance %s IP", *instanceID)
 }
 
-func (o *ec2BenchmarkOrchestrator) waitForTargetReachable(target target.Target) error {
+func (o *ec2BenchmarkOrchestrator) waitForTargetReachable(ctx context.Context, target target.Target, user string) error {
 	for i := 0; i < 6*5; i++ {
-		buf, err := target.RunCommand("whoami")
-		if err != nil || strings.TrimSpace(string(buf)) != "ubuntu" {
-			slog.Debug("target reachability check failed", slog.String("error", err.Error()))
-			time.Sleep(10 * time.Second)
+		buf, err := target.RunCommand(ctx, "whoami")
+		if err != nil || strings.TrimSpace(string(buf)) != user {
+			slog.Debug("target reachability check failed", slog.Any("error", err), slog.String("output", string(buf)))
+			err = util.Sleep(ctx, 10*time.Second)
+			if err != nil {
+				return err
+			}
 			continue
 		}
 		return nil
@@ -632,135 +926,38 @@ func (o *ec2BenchmarkOrchestrator) waitForTargetReachable(target target.Target)
 }
 
 func (o *ec2BenchmarkOrchestrator) TearDown() error {
-	if o.keyID != nil {
-		_, err := o.ec2.DeleteKeyPair(context.Background(), &ec2.DeleteKeyPairInput{
-			KeyPairId: o.keyID,
-		})
-		if err != nil {
-			slog.Error("DeleteKeyPair failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("deleted key pair", slog.String("ID", *o.keyID))
-		}
-	}
-
-	if o.insProfName != nil {
-		_, err := o.iam.RemoveRoleFromInstanceProfile(context.Background(), &iam.RemoveRoleFromInstanceProfileInput{
-			InstanceProfileName: o.insProfName,
-			RoleName:            o.roleName,
-		})
-		if err != nil {
-			slog.Debug("RemoveRoleFromInstanceProfile failed", slog.String("error", err.Error()))
-		}
-
-		_, err = o.iam.DeleteInstanceProfile(context.Background(), &iam.DeleteInstanceProfileInput{
-			InstanceProfileName: o.insProfName,
-		})
-		if err != nil {
-			slog.Error("DeleteInstanceProfile failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("deleted instance profile", slog.String("name", *o.insProfName))
-		}
-	}
-
-	if o.roleName != nil {
-		_, err := o.iam.DeleteRolePolicy(context.Background(), &iam.DeleteRolePolicyInput{
-			RoleName:   o.roleName,
-			PolicyName: o.roleInlinePolicyName,
-		})
-		if err != nil {
-			slog.Debug("DeleteRolePolicy failed", slog.String("error", err.Error()))
-		}
-
-		_, err = o.iam.DeleteRole(context.Background(), &iam.DeleteRoleInput{
-			RoleName: o.roleName,
-		})
-		if err != nil {
-			slog.Error("DeleteRole failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("deleted role", slog.String("name", *o.roleName))
-		}
-	}
-
-	if o.sgID != nil {
-		_, err := o.ec2.DeleteSecurityGroup(context.Background(), &ec2.DeleteSecurityGroupInput{
-			GroupId: o.sgID,
-		})
-		if err != nil {
-			slog.Error("DeleteSecurityGroup failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("deleted security group", slog.String("ID", *o.sgID))
-		}
-	}
-
-	if o.igwID != nil {
-		_, err := o.ec2.DetachInternetGateway(context.Background(), &ec2.DetachInternetGatewayInput{
-			VpcId:             o.vpcID,
-			InternetGatewayId: o.igwID,
-		})
-		if err != nil {
-			slog.Error("DetachInternetGateway failed", slog.String("error", err.Error()))
-		}
-
-		_, err = o.ec2.DeleteInternetGateway(context.Background(), &ec2.DeleteInternetGatewayInput{
-			InternetGatewayId: o.igwID,
-		})
-		if err != nil {
-			slog.Error("DeleteInternetGateway failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("deleted internet gateway", slog.String("ID", *o.igwID))
-		}
-	}
-
-	if o.s3EndpointID != nil {
-		_, err := o.ec2.DeleteVpcEndpoints(context.Background(), &ec2.DeleteVpcEndpointsInput{
-			VpcEndpointIds: []string{*o.s3EndpointID},
-		})
-		if err != nil {
-			slog.Error("DeleteVpcEndpoints failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("deleted S3 endpoint", slog.String("ID", *o.s3EndpointID))
-		}
-	}
-
-	if o.subnetID != nil {
-		_, err := o.ec2.DeleteSubnet(context.Background(), &ec2.DeleteSubnetInput{
-			SubnetId: o.subnetID,
-		})
-		if err != nil {
-			slog.Error("DeleteSubnet failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("deleted subnet", slog.String("ID", *o.subnetID))
-		}
-	}
-
-	if o.vpcID != nil {
-		_, err := o.ec2.DeleteVpc(context.Background(), &ec2.DeleteVpcInput{
-			VpcId: o.vpcID,
-		})
-		if err != nil {
-			slog.Error("DeleteVpc failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("deleted VPC", slog.String("ID", *o.vpcID))
-		}
+	if o.state == nil {
+		return nil
 	}
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+	err := cleanUpEC2Resources(o.ec2, o.iam, o.state)
+	saveErr := SaveEC2State(path.Join(o.cfg.ResultDir, EC2StateFileName), o.state)
+	return errors.Join(err, saveErr)
+}
 
-	return fmt.Errorf("not implemented")
+// Applies update to the state and saves it to the result directory.
+func (o *ec2BenchmarkOrchestrator) updateState(update func(s *EC2State)) error {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+	update(o.state)
+	return SaveEC2State(path.Join(o.cfg.ResultDir, EC2StateFileName), o.state)
 }
 
-func (o *ec2BenchmarkOrchestrator) randString() *string {
+func randString() *string {
 	return aws.String(fmt.Sprintf("benchmark-%s", util.Randstring(8)))
 }
 
-func (o *ec2BenchmarkOrchestrator) configureForRootLogin(target *target.SSHTarget) error {
-	_, err := target.RunCommand("sudo sed -i 's/#PermitRootLogin prohibit-password/PermitRootLogin yes/g' /etc/ssh/sshd_config")
+func (o *ec2BenchmarkOrchestrator) configureForRootLogin(ctx context.Context, target *target.SSHTarget, sshService string) error {
+	_, err := target.RunCommand(ctx, "sudo sed -i 's/#PermitRootLogin prohibit-password/PermitRootLogin yes/g' /etc/ssh/sshd_config")
 	if err != nil {
 		return fmt.Errorf("failed to change sshd_config: %w", err)
 	}
-	_, err = target.RunCommand("sudo sed -i -e 's/.*exit 142\" \\(.*$\\)/\\1/' /root/.ssh/authorized_keys")
+	_, err = target.RunCommand(ctx, "sudo sed -i -e 's/.*exit 142\" \\(.*$\\)/\\1/' /root/.ssh/authorized_keys")
 	if err != nil {
 		return fmt.Errorf("failed to change authorized_keys: %w", err)
 	}
-	_, err = target.RunCommand("sudo systemctl restart ssh")
+	_, err = target.RunCommand(ctx, "sudo systemctl restart "+sshService)
 	if err != nil {
 		return fmt.Errorf("failed to restart ssh: %w", err)
 	}
@@ -0,0 +1,127 @@
+package benchmarkorchestrator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// An operating system to run EC2 instances with. Its latest AMI in the region is used.
+type OSImage string
+
+const (
+	Ubuntu2204      OSImage = "ubuntu-22.04"
+	Ubuntu2404      OSImage = "ubuntu-24.04"
+	AmazonLinux2023 OSImage = "al2023"
+)
+
+type osImageSpec struct {
+	owner       string
+	namePattern string                               // a DescribeImages name filter. %s is the architecture's name in the AMI name.
+	archNames   map[ec2Types.ArchitectureType]string // the name of each supported architecture in the AMI name
+	user        string                               // the default user which can log in with the key pair
+	sshService  string
+}
+
+var osImages = map[OSImage]*osImageSpec{
+	Ubuntu2204: {
+		owner:       "099720109477", // Canonical
+		namePattern: "ubuntu/images/hvm-ssd*/ubuntu-jammy-22.04-%s-server-*",
+		archNames:   map[ec2Types.ArchitectureType]string{ec2Types.ArchitectureTypeX8664: "amd64", ec2Types.ArchitectureTypeArm64: "arm64"},
+		user:        "ubuntu",
+		sshService:  "ssh",
+	},
+	Ubuntu2404: {
+		owner:       "099720109477", // Canonical
+		namePattern: "ubuntu/images/hvm-ssd-gp3/ubuntu-noble-24.04-%s-server-*",
+		archNames:   map[ec2Types.ArchitectureType]string{ec2Types.ArchitectureTypeX8664: "amd64", ec2Types.ArchitectureTypeArm64: "arm64"},
+		user:        "ubuntu",
+		sshService:  "ssh",
+	},
+	AmazonLinux2023: {
+		owner:       "amazon",
+		namePattern: "al2023-ami-2023.*-kernel-*-%s",
+		archNames:   map[ec2Types.ArchitectureType]string{ec2Types.ArchitectureTypeX8664: "x86_64", ec2Types.ArchitectureTypeArm64: "arm64"},
+		user:        "ec2-user",
+		sshService:  "sshd",
+	},
+}
+
+func ExplainOSImages() string {
+	names := []string{}
+	for image := range osImages {
+		names = append(names, fmt.Sprintf("%q", image))
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// An AMI resolved for an OSImage and architecture.
+type resolvedImage struct {
+	id             string
+	rootDeviceName string
+	spec           *osImageSpec
+}
+
+// Returns the latest AMI of the OS image for the architecture in the configured region. Images are resolved once.
+func (o *ec2BenchmarkOrchestrator) resolveImage(ctx context.Context, arch ec2Types.ArchitectureType) (*resolvedImage, error) {
+	o.imagesMu.Lock()
+	defer o.imagesMu.Unlock()
+	if image, ok := o.images[arch]; ok {
+		return image, nil
+	}
+
+	spec := osImages[o.input.OSImage]
+	archName, ok := spec.archNames[arch]
+	if !ok {
+		return nil, fmt.Errorf("%s has no image for architecture %s", o.input.OSImage, arch)
+	}
+	resp, err := o.ec2.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Owners: []string{spec.owner},
+		Filters: []ec2Types.Filter{
+			{Name: aws.String("name"), Values: []string{fmt.Sprintf(spec.namePattern, archName)}},
+			{Name: aws.String("architecture"), Values: []string{string(arch)}},
+			{Name: aws.String("state"), Values: []string{string(ec2Types.ImageStateAvailable)}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Images) == 0 {
+		return nil, fmt.Errorf("found no %s image for architecture %s in %s", o.input.OSImage, arch, o.input.AwsConfig.Region)
+	}
+	latest := slices.MaxFunc(resp.Images, func(a, b ec2Types.Image) int {
+		return strings.Compare(aws.ToString(a.CreationDate), aws.ToString(b.CreationDate))
+	})
+
+	image := &resolvedImage{
+		id:             *latest.ImageId,
+		rootDeviceName: *latest.RootDeviceName,
+		spec:           spec,
+	}
+	slog.Debug("resolved image",
+		slog.String("os", string(o.input.OSImage)),
+		slog.String("architecture", string(arch)),
+		slog.String("imageID", image.id),
+		slog.String("name", aws.ToString(latest.Name)),
+	)
+	o.images[arch] = image
+	return image, nil
+}
+
+// Returns the architecture which instances of this type run, preferring 64-bit architectures.
+func instanceArchitecture(info *ec2Types.InstanceTypeInfo) ec2Types.ArchitectureType {
+	supported := info.ProcessorInfo.SupportedArchitectures
+	for _, arch := range []ec2Types.ArchitectureType{ec2Types.ArchitectureTypeX8664, ec2Types.ArchitectureTypeArm64} {
+		if slices.Contains(supported, arch) {
+			return arch
+		}
+	}
+	return supported[0]
+}
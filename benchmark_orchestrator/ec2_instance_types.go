@@ -0,0 +1,132 @@
+package benchmarkorchestrator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/Octogonapus/S3Benchmark/benchmark"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Selects EC2 instance types by their attributes, e.g. all current-generation instances with at least 50 Gbps of
+// baseline bandwidth and at most 64 vCPUs. Zero fields don't filter.
+type InstanceTypeQuery struct {
+	Families                 []string // e.g. "c6in" or "m7*". all families if empty.
+	CurrentGenerationOnly    bool
+	MinBaselineBandwidthGbps float64
+	MinVCPUs                 int32
+	MaxVCPUs                 int32
+	Architecture             string // "x86_64" or "arm64". all architectures if empty.
+}
+
+func (q *InstanceTypeQuery) filters() []ec2Types.Filter {
+	filters := []ec2Types.Filter{}
+	if q.Architecture != "" {
+		filters = append(filters, ec2Types.Filter{Name: aws.String("processor-info.supported-architecture"), Values: []string{q.Architecture}})
+	}
+	if q.CurrentGenerationOnly {
+		filters = append(filters, ec2Types.Filter{Name: aws.String("current-generation"), Values: []string{"true"}})
+	}
+	if len(q.Families) > 0 {
+		patterns := []string{}
+		for _, family := range q.Families {
+			patterns = append(patterns, strings.TrimSuffix(family, ".")+".*")
+		}
+		filters = append(filters, ec2Types.Filter{Name: aws.String("instance-type"), Values: patterns})
+	}
+	return filters
+}
+
+func (q *InstanceTypeQuery) matches(info *ec2Types.InstanceTypeInfo) bool {
+	vcpus := aws.ToInt32(info.VCpuInfo.DefaultVCpus)
+	if q.MinVCPUs > 0 && vcpus < q.MinVCPUs {
+		return false
+	}
+	if q.MaxVCPUs > 0 && vcpus > q.MaxVCPUs {
+		return false
+	}
+	return baselineBandwidthGbps(info) >= q.MinBaselineBandwidthGbps
+}
+
+// The baseline bandwidth of the instance type's primary network card.
+func baselineBandwidthGbps(info *ec2Types.InstanceTypeInfo) float64 {
+	if info.NetworkInfo == nil || len(info.NetworkInfo.NetworkCards) == 0 {
+		return 0
+	}
+	return aws.ToFloat64(info.NetworkInfo.NetworkCards[0].BaselineBandwidthInGbps)
+}
+
+// Returns the instance types in the client's region which match the query, sorted by name.
+func findInstanceTypes(ctx context.Context, client *ec2.Client, q *InstanceTypeQuery) ([]ec2Types.InstanceType, error) {
+	found := []ec2Types.InstanceType{}
+	pages := ec2.NewDescribeInstanceTypesPaginator(client, &ec2.DescribeInstanceTypesInput{Filters: q.filters()})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range page.InstanceTypes {
+			if q.matches(&info) {
+				found = append(found, info.InstanceType)
+			}
+		}
+	}
+	slices.Sort(found)
+	slog.Debug("found instance types", slog.Any("instanceTypes", found))
+	return found, nil
+}
+
+// Resolves the instance types to run benchmarks on when they don't set their own: InstanceTypes and the matches of
+// InstanceTypeQuery, without duplicates.
+func (o *ec2BenchmarkOrchestrator) resolveInstanceTypes(ctx context.Context) error {
+	o.instanceTypes = slices.Clone(o.input.InstanceTypes)
+	if o.input.InstanceTypeQuery != nil {
+		found, err := findInstanceTypes(ctx, o.ec2, o.input.InstanceTypeQuery)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return fmt.Errorf("no instance types match the query")
+		}
+		for _, instanceType := range found {
+			if !slices.Contains(o.instanceTypes, instanceType) {
+				o.instanceTypes = append(o.instanceTypes, instanceType)
+			}
+		}
+	}
+
+	// Record every instance type which will be used, including those set by benchmarks
+	all := map[string]bool{}
+	for _, b := range o.benchmarks {
+		instanceTypes := o.instanceTypesFor(b)
+		if len(instanceTypes) == 0 {
+			return fmt.Errorf("no instance types to run benchmark %s on", b.GetName())
+		}
+		for _, instanceType := range instanceTypes {
+			all[string(instanceType)] = true
+		}
+	}
+	o.cfg.InstanceTypes = []string{}
+	for instanceType := range all {
+		o.cfg.InstanceTypes = append(o.cfg.InstanceTypes, instanceType)
+	}
+	slices.Sort(o.cfg.InstanceTypes)
+	return nil
+}
+
+// The instance types to run the benchmark on.
+func (o *ec2BenchmarkOrchestrator) instanceTypesFor(b benchmark.Benchmark) []ec2Types.InstanceType {
+	if own := benchmark.InstanceTypesOf(b); len(own) > 0 {
+		instanceTypes := []ec2Types.InstanceType{}
+		for _, instanceType := range own {
+			instanceTypes = append(instanceTypes, ec2Types.InstanceType(instanceType))
+		}
+		return instanceTypes
+	}
+	return o.instanceTypes
+}
@@ -0,0 +1,84 @@
+package benchmarkorchestrator
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+	"github.com/Octogonapus/S3Benchmark/util"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// The cause of a benchmark's context being canceled because its Spot instance is being reclaimed.
+var errSpotInterrupted = errors.New("spot instance interrupted")
+
+// How often the target is polled for a Spot interruption notice. AWS gives two minutes of notice.
+var spotPollInterval = 5 * time.Second
+
+// Returns instance metadata about a pending Spot interruption, or fails with curl's 404 error if there is none.
+const spotInstanceActionCommand = `TOKEN=$(curl -sf -X PUT http://169.254.169.254/latest/api/token -H 'X-aws-ec2-metadata-token-ttl-seconds: 60') && ` +
+	`curl -sf -H "X-aws-ec2-metadata-token: $TOKEN" http://169.254.169.254/latest/meta-data/spot/instance-action`
+
+// Returns true if the launch failed because there is no Spot capacity at the max price, so on-demand may still work.
+func isSpotCapacityError(err error) bool {
+	for _, code := range []string{
+		"InsufficientInstanceCapacity",
+		"SpotMaxPriceTooLow",
+		"MaxSpotInstanceCountExceeded",
+		"InsufficientCapacityOnHost",
+		"UnfulfillableCapacity",
+	} {
+		if hasErrorCode(err, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// Polls the target for a Spot interruption notice until ctx is done, calling interrupt if one arrives.
+func watchSpotInterruption(ctx context.Context, t target.Target, instanceID string, interrupt context.CancelCauseFunc) {
+	session, err := t.NewSession()
+	if err != nil {
+		slog.Warn("failed to watch for spot interruption", slog.String("instanceID", instanceID), slog.String("error", err.Error()))
+		return
+	}
+	defer session.Close()
+
+	for util.Sleep(ctx, spotPollInterval) == nil {
+		out, err := session.RunCommand(spotInstanceActionCommand)
+		if err == nil && strings.Contains(string(out), "action") {
+			slog.Warn("spot instance is being interrupted", slog.String("instanceID", instanceID), slog.String("notice", string(out)))
+			interrupt(errSpotInterrupted)
+			return
+		}
+	}
+}
+
+// Returns true if the Spot instance was reclaimed, either because its interruption notice was seen or because it
+// stopped without us stopping it (e.g. the connection dropped before the notice was polled).
+func (o *ec2BenchmarkOrchestrator) wasSpotInterrupted(ctx context.Context, instanceID string) bool {
+	if errors.Is(context.Cause(ctx), errSpotInterrupted) {
+		return true
+	}
+	resp, err := o.ec2.DescribeInstances(context.WithoutCancel(ctx), &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil || len(resp.Reservations) == 0 || len(resp.Reservations[0].Instances) == 0 {
+		return false
+	}
+	ins := resp.Reservations[0].Instances[0]
+	if ins.StateReason != nil && aws.ToString(ins.StateReason.Code) == "Server.SpotInstanceTermination" {
+		return true
+	}
+	switch ins.State.Name {
+	case ec2Types.InstanceStateNameShuttingDown, ec2Types.InstanceStateNameTerminated,
+		ec2Types.InstanceStateNameStopping, ec2Types.InstanceStateNameStopped:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,538 @@
+package benchmarkorchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/util"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+)
+
+// Every resource created by the EC2 orchestrator is tagged with the run ID under this key.
+const RunIDTagKey = "s3benchmark-run-id"
+
+// The file in the result directory which records the resources created by the EC2 orchestrator.
+const EC2StateFileName = "ec2-state.json"
+
+// IAM resources can't be filtered by tag, so they are also created under the path iamPathPrefix/<run ID>/.
+const iamPathPrefix = "/s3benchmark/"
+
+// The resources created by one run of the EC2 orchestrator. It is saved as each resource is created so that a run
+// which crashes or is killed can be cleaned up later.
+type EC2State struct {
+	RunID               string
+	Region              string
+	VpcID               string
+	SubnetID            string
+	InternetGatewayID   string
+	S3EndpointID        string
+	SecurityGroupID     string
+	RoleName            string
+	InstanceProfileName string
+	KeyPairID           string
+	KeyName             string
+	InstanceIDs         []string // instances which have not been confirmed terminated
+}
+
+// Returns true if the state doesn't hold any resources.
+func (s *EC2State) IsEmpty() bool {
+	return s.VpcID == "" && s.SubnetID == "" && s.InternetGatewayID == "" && s.S3EndpointID == "" &&
+		s.SecurityGroupID == "" && s.RoleName == "" && s.InstanceProfileName == "" && s.KeyPairID == "" &&
+		len(s.InstanceIDs) == 0
+}
+
+func LoadEC2State(p string) (*EC2State, error) {
+	buf, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	state := &EC2State{}
+	err = json.Unmarshal(buf, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse EC2 state file %s: %w", p, err)
+	}
+	return state, nil
+}
+
+// Saves the state to p, or removes p if the state is empty.
+func SaveEC2State(p string, state *EC2State) error {
+	if state.IsEmpty() {
+		err := os.Remove(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	buf, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so that a crash never leaves a truncated file behind
+	tmp := p + ".tmp"
+	err = os.WriteFile(tmp, buf, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func runIDTagSpecs(runID string, resourceTypes ...ec2Types.ResourceType) []ec2Types.TagSpecification {
+	specs := []ec2Types.TagSpecification{}
+	for _, rt := range resourceTypes {
+		specs = append(specs, ec2Types.TagSpecification{
+			ResourceType: rt,
+			Tags:         []ec2Types.Tag{{Key: aws.String(RunIDTagKey), Value: aws.String(runID)}},
+		})
+	}
+	return specs
+}
+
+func runIDIAMTags(runID string) []iamTypes.Tag {
+	return []iamTypes.Tag{{Key: aws.String(RunIDTagKey), Value: aws.String(runID)}}
+}
+
+func iamPath(runID string) *string {
+	return aws.String(iamPathPrefix + runID + "/")
+}
+
+func runIDFromTags(tags []ec2Types.Tag) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == RunIDTagKey {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// Finds the resources tagged with the run ID, or the resources of every run if runID is empty. Returns one state per
+// run.
+func FindEC2Resources(awsConfig aws.Config, runID string) ([]*EC2State, error) {
+	ec2Client := ec2.NewFromConfig(awsConfig)
+	iamClient := iam.NewFromConfig(awsConfig)
+	ctx := context.Background()
+
+	filters := []ec2Types.Filter{{Name: aws.String("tag-key"), Values: []string{RunIDTagKey}}}
+	pathPrefix := aws.String(iamPathPrefix)
+	if runID != "" {
+		filters = []ec2Types.Filter{{Name: aws.String("tag:" + RunIDTagKey), Values: []string{runID}}}
+		pathPrefix = iamPath(runID)
+	}
+
+	states := map[string]*EC2State{}
+	stateFor := func(id string) *EC2State {
+		s, ok := states[id]
+		if !ok {
+			s = &EC2State{RunID: id, Region: awsConfig.Region}
+			states[id] = s
+		}
+		return s
+	}
+
+	vpcs, err := ec2Client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	for _, vpc := range vpcs.Vpcs {
+		stateFor(runIDFromTags(vpc.Tags)).VpcID = *vpc.VpcId
+	}
+
+	subnets, err := ec2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	for _, subnet := range subnets.Subnets {
+		stateFor(runIDFromTags(subnet.Tags)).SubnetID = *subnet.SubnetId
+	}
+
+	igws, err := ec2Client.DescribeInternetGateways(ctx, &ec2.DescribeInternetGatewaysInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	for _, igw := range igws.InternetGateways {
+		stateFor(runIDFromTags(igw.Tags)).InternetGatewayID = *igw.InternetGatewayId
+	}
+
+	endpoints, err := ec2Client.DescribeVpcEndpoints(ctx, &ec2.DescribeVpcEndpointsInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	for _, endpoint := range endpoints.VpcEndpoints {
+		if endpoint.State == ec2Types.StateDeleted {
+			continue
+		}
+		stateFor(runIDFromTags(endpoint.Tags)).S3EndpointID = *endpoint.VpcEndpointId
+	}
+
+	sgs, err := ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	for _, sg := range sgs.SecurityGroups {
+		stateFor(runIDFromTags(sg.Tags)).SecurityGroupID = *sg.GroupId
+	}
+
+	keyPairs, err := ec2Client.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	for _, kp := range keyPairs.KeyPairs {
+		s := stateFor(runIDFromTags(kp.Tags))
+		s.KeyPairID = *kp.KeyPairId
+		s.KeyName = *kp.KeyName
+	}
+
+	instanceFilters := append(slices.Clone(filters), ec2Types.Filter{
+		Name:   aws.String("instance-state-name"),
+		Values: []string{"pending", "running", "shutting-down", "stopping", "stopped"},
+	})
+	instances := ec2.NewDescribeInstancesPaginator(ec2Client, &ec2.DescribeInstancesInput{Filters: instanceFilters})
+	for instances.HasMorePages() {
+		page, err := instances.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, res := range page.Reservations {
+			for _, ins := range res.Instances {
+				s := stateFor(runIDFromTags(ins.Tags))
+				s.InstanceIDs = append(s.InstanceIDs, *ins.InstanceId)
+			}
+		}
+	}
+
+	roles := iam.NewListRolesPaginator(iamClient, &iam.ListRolesInput{PathPrefix: pathPrefix})
+	for roles.HasMorePages() {
+		page, err := roles.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range page.Roles {
+			stateFor(runIDFromIAMPath(*role.Path)).RoleName = *role.RoleName
+		}
+	}
+
+	profiles := iam.NewListInstanceProfilesPaginator(iamClient, &iam.ListInstanceProfilesInput{PathPrefix: pathPrefix})
+	for profiles.HasMorePages() {
+		page, err := profiles.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, prof := range page.InstanceProfiles {
+			stateFor(runIDFromIAMPath(*prof.Path)).InstanceProfileName = *prof.InstanceProfileName
+		}
+	}
+
+	result := []*EC2State{}
+	for _, s := range states {
+		result = append(result, s)
+	}
+	slices.SortFunc(result, func(a, b *EC2State) int { return strings.Compare(a.RunID, b.RunID) })
+	return result, nil
+}
+
+func runIDFromIAMPath(p string) string {
+	return strings.Trim(strings.TrimPrefix(p, iamPathPrefix), "/")
+}
+
+// Deletes the resources in the state in dependency order. Resources which are deleted, or which were already gone,
+// are cleared from the state, so if an error is returned the state holds what is left.
+func CleanUpEC2Resources(awsConfig aws.Config, state *EC2State) error {
+	return cleanUpEC2Resources(ec2.NewFromConfig(awsConfig), iam.NewFromConfig(awsConfig), state)
+}
+
+func cleanUpEC2Resources(ec2Client *ec2.Client, iamClient *iam.Client, state *EC2State) error {
+	ctx := context.Background()
+	errs := []error{}
+
+	// Instances hold network interfaces in the subnet and security group, and use the instance profile
+	if len(state.InstanceIDs) > 0 {
+		terminating := []string{}
+		failed := []string{}
+		for _, id := range state.InstanceIDs {
+			// One at a time because one missing instance fails the whole request
+			_, err := ec2Client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{InstanceIds: []string{id}})
+			if err != nil && !isNotFound(err) {
+				errs = append(errs, fmt.Errorf("failed to terminate instance %s: %w", id, err))
+				failed = append(failed, id)
+				continue
+			}
+			if err == nil {
+				terminating = append(terminating, id)
+			}
+		}
+		if len(terminating) > 0 {
+			slog.Debug("waiting for instances to terminate", slog.Any("instanceIDs", terminating))
+			err := ec2.NewInstanceTerminatedWaiter(ec2Client).Wait(ctx, &ec2.DescribeInstancesInput{
+				InstanceIds: terminating,
+			}, 15*time.Minute)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed waiting for instances to terminate: %w", err))
+				return errors.Join(errs...)
+			}
+		}
+		state.InstanceIDs = failed
+		if len(failed) > 0 {
+			// Everything else depends on the instances being gone
+			return errors.Join(errs...)
+		}
+	}
+
+	if state.KeyPairID != "" {
+		_, err := ec2Client.DeleteKeyPair(ctx, &ec2.DeleteKeyPairInput{KeyPairId: aws.String(state.KeyPairID)})
+		if err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete key pair %s: %w", state.KeyPairID, err))
+		} else {
+			slog.Debug("deleted key pair", slog.String("ID", state.KeyPairID))
+			state.KeyPairID = ""
+			state.KeyName = ""
+		}
+	}
+
+	if state.InstanceProfileName != "" {
+		err := deleteInstanceProfile(ctx, iamClient, state.InstanceProfileName)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			slog.Debug("deleted instance profile", slog.String("name", state.InstanceProfileName))
+			state.InstanceProfileName = ""
+		}
+	}
+
+	if state.RoleName != "" {
+		err := deleteRole(ctx, iamClient, state.RoleName)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			slog.Debug("deleted role", slog.String("name", state.RoleName))
+			state.RoleName = ""
+		}
+	}
+
+	if state.SecurityGroupID != "" {
+		_, err := ec2Client.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(state.SecurityGroupID)})
+		if err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete security group %s: %w", state.SecurityGroupID, err))
+		} else {
+			slog.Debug("deleted security group", slog.String("ID", state.SecurityGroupID))
+			state.SecurityGroupID = ""
+		}
+	}
+
+	if state.InternetGatewayID != "" {
+		var err error
+		if state.VpcID != "" {
+			_, err = ec2Client.DetachInternetGateway(ctx, &ec2.DetachInternetGatewayInput{
+				VpcId:             aws.String(state.VpcID),
+				InternetGatewayId: aws.String(state.InternetGatewayID),
+			})
+			if isNotFound(err) || hasErrorCode(err, "Gateway.NotAttached") {
+				err = nil
+			}
+		}
+		if err == nil {
+			_, err = ec2Client.DeleteInternetGateway(ctx, &ec2.DeleteInternetGatewayInput{
+				InternetGatewayId: aws.String(state.InternetGatewayID),
+			})
+		}
+		if err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete internet gateway %s: %w", state.InternetGatewayID, err))
+		} else {
+			slog.Debug("deleted internet gateway", slog.String("ID", state.InternetGatewayID))
+			state.InternetGatewayID = ""
+		}
+	}
+
+	if state.S3EndpointID != "" {
+		resp, err := ec2Client.DeleteVpcEndpoints(ctx, &ec2.DeleteVpcEndpointsInput{
+			VpcEndpointIds: []string{state.S3EndpointID},
+		})
+		if err == nil && len(resp.Unsuccessful) > 0 && resp.Unsuccessful[0].Error != nil {
+			code := aws.ToString(resp.Unsuccessful[0].Error.Code)
+			if !strings.Contains(code, "NotFound") {
+				err = fmt.Errorf("%s: %s", code, aws.ToString(resp.Unsuccessful[0].Error.Message))
+			}
+		}
+		if err == nil {
+			// Deleting is asynchronous and the subnet and VPC can't be deleted until it finishes
+			err = waitForVpcEndpointDeleted(ctx, ec2Client, state.S3EndpointID)
+		}
+		if err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete S3 endpoint %s: %w", state.S3EndpointID, err))
+		} else {
+			slog.Debug("deleted S3 endpoint", slog.String("ID", state.S3EndpointID))
+			state.S3EndpointID = ""
+		}
+	}
+
+	if state.SubnetID != "" {
+		err := retryDependencyViolation(ctx, func() error {
+			_, err := ec2Client.DeleteSubnet(ctx, &ec2.DeleteSubnetInput{SubnetId: aws.String(state.SubnetID)})
+			return err
+		})
+		if err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete subnet %s: %w", state.SubnetID, err))
+		} else {
+			slog.Debug("deleted subnet", slog.String("ID", state.SubnetID))
+			state.SubnetID = ""
+		}
+	}
+
+	if state.VpcID != "" {
+		err := retryDependencyViolation(ctx, func() error {
+			_, err := ec2Client.DeleteVpc(ctx, &ec2.DeleteVpcInput{VpcId: aws.String(state.VpcID)})
+			return err
+		})
+		if err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete VPC %s: %w", state.VpcID, err))
+		} else {
+			slog.Debug("deleted VPC", slog.String("ID", state.VpcID))
+			state.VpcID = ""
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Polls until the VPC endpoint is deleted.
+func waitForVpcEndpointDeleted(ctx context.Context, ec2Client *ec2.Client, id string) error {
+	for range 60 {
+		resp, err := ec2Client.DescribeVpcEndpoints(ctx, &ec2.DescribeVpcEndpointsInput{VpcEndpointIds: []string{id}})
+		if err != nil {
+			return err
+		}
+		if len(resp.VpcEndpoints) == 0 || resp.VpcEndpoints[0].State == ec2Types.StateDeleted {
+			return nil
+		}
+		slog.Debug("waiting for S3 endpoint to be deleted", slog.String("ID", id), slog.String("state", string(resp.VpcEndpoints[0].State)))
+		err = util.Sleep(ctx, 5*time.Second)
+		if err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("timed out waiting for S3 endpoint %s to be deleted", id)
+}
+
+// Calls del until it doesn't fail with DependencyViolation, which EC2 returns while resources in a subnet or VPC are
+// still being deleted.
+func retryDependencyViolation(ctx context.Context, del func() error) error {
+	var err error
+	for range 12 {
+		err = del()
+		if !hasErrorCode(err, "DependencyViolation") {
+			return err
+		}
+		slog.Debug("waiting for dependent resources to be deleted", slog.String("error", err.Error()))
+		sleepErr := util.Sleep(ctx, 10*time.Second)
+		if sleepErr != nil {
+			return sleepErr
+		}
+	}
+	return err
+}
+
+// Returns the instances in the state which are pending or running, e.g. because the run is still in progress.
+func RunningInstances(awsConfig aws.Config, state *EC2State) ([]string, error) {
+	if len(state.InstanceIDs) == 0 {
+		return nil, nil
+	}
+	ec2Client := ec2.NewFromConfig(awsConfig)
+	running := []string{}
+	instances := ec2.NewDescribeInstancesPaginator(ec2Client, &ec2.DescribeInstancesInput{
+		InstanceIds: state.InstanceIDs,
+		Filters: []ec2Types.Filter{{
+			Name:   aws.String("instance-state-name"),
+			Values: []string{"pending", "running"},
+		}},
+	})
+	for instances.HasMorePages() {
+		page, err := instances.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, res := range page.Reservations {
+			for _, ins := range res.Instances {
+				running = append(running, *ins.InstanceId)
+			}
+		}
+	}
+	return running, nil
+}
+
+// Removes the roles from the instance profile, then deletes it.
+func deleteInstanceProfile(ctx context.Context, iamClient *iam.Client, name string) error {
+	prof, err := iamClient.GetInstanceProfile(ctx, &iam.GetInstanceProfileInput{InstanceProfileName: aws.String(name)})
+	if isNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get instance profile %s: %w", name, err)
+	}
+	for _, role := range prof.InstanceProfile.Roles {
+		_, err := iamClient.RemoveRoleFromInstanceProfile(ctx, &iam.RemoveRoleFromInstanceProfileInput{
+			InstanceProfileName: aws.String(name),
+			RoleName:            role.RoleName,
+		})
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to remove role %s from instance profile %s: %w", *role.RoleName, name, err)
+		}
+	}
+	_, err = iamClient.DeleteInstanceProfile(ctx, &iam.DeleteInstanceProfileInput{InstanceProfileName: aws.String(name)})
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete instance profile %s: %w", name, err)
+	}
+	return nil
+}
+
+// Deletes the role's inline policies, then the role.
+func deleteRole(ctx context.Context, iamClient *iam.Client, name string) error {
+	policies := iam.NewListRolePoliciesPaginator(iamClient, &iam.ListRolePoliciesInput{RoleName: aws.String(name)})
+	for policies.HasMorePages() {
+		page, err := policies.NextPage(ctx)
+		if isNotFound(err) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to list policies of role %s: %w", name, err)
+		}
+		for _, policyName := range page.PolicyNames {
+			_, err := iamClient.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{
+				RoleName:   aws.String(name),
+				PolicyName: aws.String(policyName),
+			})
+			if err != nil && !isNotFound(err) {
+				return fmt.Errorf("failed to delete policy %s of role %s: %w", policyName, name, err)
+			}
+		}
+	}
+	_, err := iamClient.DeleteRole(ctx, &iam.DeleteRoleInput{RoleName: aws.String(name)})
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete role %s: %w", name, err)
+	}
+	return nil
+}
+
+// Returns true if the error means the resource doesn't exist, e.g. because an earlier cleanup deleted it.
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		return strings.HasSuffix(code, ".NotFound") || code == "NoSuchEntity"
+	}
+	return false
+}
+
+func hasErrorCode(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
+}
@@ -0,0 +1,305 @@
+package benchmarkorchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/benchmark"
+	objectprovider "github.com/Octogonapus/S3Benchmark/object_provider"
+	"github.com/Octogonapus/S3Benchmark/profile"
+	"github.com/Octogonapus/S3Benchmark/report"
+	"github.com/Octogonapus/S3Benchmark/target"
+	"golang.org/x/crypto/ssh"
+)
+
+type staticHostBenchmarkOrchestrator struct {
+	input      *StaticHostBenchmarkOrchestratorInput
+	benchmarks []benchmark.Benchmark
+	cfg        *BenchmarkConfig
+	targets    []target.Target
+}
+
+// A pre-provisioned machine reachable over SSH, or this machine if LocalDir is set. The user must be root because
+// benchmarks install software and commands aren't run with sudo.
+type StaticHost struct {
+	Address               string
+	Port                  int // 22 by default
+	User                  string
+	KeyPath               string
+	LocalDir              string // run commands on this machine in this directory instead of over SSH. Address only names the host in reports.
+	Tags                  map[string]string
+	BaselineBandwidthGbps float64 // overrides StaticHostBenchmarkOrchestratorInput.DesiredThroughput for this host
+}
+
+type staticHostMetadata struct {
+	Host string
+	Tags map[string]string
+}
+
+type StaticHostBenchmarkOrchestratorInput struct {
+	Hosts             []*StaticHost
+	Bucket            string
+	Region            string
+	Endpoint          objectprovider.S3Endpoint // AWS S3 by default
+	DesiredThroughput float64                   // in Gbps. used for hosts which do not set BaselineBandwidthGbps.
+	S3Prefixes        []netip.Prefix            // used to count connections to S3. optional.
+	RunOnEveryHost    bool                      // run every benchmark on every host instead of once on whichever host is free
+	ProfilerKind      profile.ProfilerKind
+	ProfileSaveDir    string
+	BenchmarkRuns     int                // number of times to run each benchmark. 1 = run the benchmark once. 1 by default.
+	Timeouts          benchmark.Timeouts // defaults for benchmarks which don't set their own. no timeouts by default.
+	Collectors        []string           // the system monitor's collectors to run. the default collectors if empty.
+	SampleInterval    time.Duration      // how often the system monitor samples the target. 1s by default and at least 100ms.
+}
+
+// Loads a JSON list of StaticHost.
+func LoadStaticHostsFromBuf(buf []byte) ([]*StaticHost, error) {
+	hosts := []*StaticHost{}
+	err := json.Unmarshal(buf, &hosts)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		if host.LocalDir != "" {
+			if host.Address == "" {
+				host.Address = "localhost"
+			}
+			continue
+		}
+		if host.Address == "" {
+			return nil, fmt.Errorf("host is missing an address")
+		}
+		if host.User == "" {
+			return nil, fmt.Errorf("host %s is missing a user", host.Address)
+		}
+		if host.KeyPath == "" {
+			return nil, fmt.Errorf("host %s is missing a key path", host.Address)
+		}
+		if host.Port == 0 {
+			host.Port = 22
+		}
+	}
+	return hosts, nil
+}
+
+func NewStaticHostBenchmarkOrchestrator(input *StaticHostBenchmarkOrchestratorInput) (*staticHostBenchmarkOrchestrator, error) {
+	if len(input.Hosts) == 0 {
+		return nil, fmt.Errorf("at least one host is required")
+	}
+	return &staticHostBenchmarkOrchestrator{input: input}, nil
+}
+
+func (o *staticHostBenchmarkOrchestrator) AddBenchmark(b benchmark.Benchmark) error {
+	o.benchmarks = append(o.benchmarks, b)
+	return nil
+}
+
+func (o *staticHostBenchmarkOrchestrator) SetUp(ctx context.Context, cfg *BenchmarkConfig) error {
+	o.cfg = cfg
+
+	err := validateWarmUp(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(o.cfg.ResultDir, fs.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	o.targets = []target.Target{}
+	for _, host := range o.input.Hosts {
+		t, err := newStaticHostTarget(host)
+		if err != nil {
+			return fmt.Errorf("host %s: %w", host.Address, err)
+		}
+
+		buf, err := t.RunCommand(ctx, "whoami")
+		if err != nil {
+			return fmt.Errorf("host %s is not reachable: %w", host.Address, err)
+		}
+		if user := strings.TrimSpace(string(buf)); user != "root" {
+			return fmt.Errorf("host %s: commands must run as root but ran as %s", host.Address, user)
+		}
+		slog.Debug("host is reachable", slog.String("host", host.Address))
+
+		o.targets = append(o.targets, t)
+	}
+
+	return nil
+}
+
+func newStaticHostTarget(host *StaticHost) (target.Target, error) {
+	if host.LocalDir != "" {
+		return target.NewLocalTarget(host.LocalDir)
+	}
+	keyPath := host.KeyPath
+	if strings.HasPrefix(keyPath, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		keyPath = path.Join(home, keyPath[2:])
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	return &target.SSHTarget{
+		User:    &host.User,
+		IP:      &host.Address,
+		SSHPort: host.Port,
+		Auths:   []ssh.AuthMethod{ssh.PublicKeys(signer)},
+	}, nil
+}
+
+func (o *staticHostBenchmarkOrchestrator) runBenchmark(ctx context.Context, keys []string, b benchmark.Benchmark, i int) *report.BenchmarkReport {
+	host := o.input.Hosts[i]
+	meta := staticHostMetadata{
+		Host: host.Address,
+		Tags: host.Tags,
+	}
+	fail := func(err error) *report.BenchmarkReport {
+		slog.Error("benchmark failed",
+			slog.String("error", err.Error()),
+			slog.String("benchmark", b.GetName()),
+			slog.String("host", host.Address),
+		)
+		return &report.BenchmarkReport{
+			Name:     b.GetName(),
+			Metadata: []any{meta},
+			Error:    err.Error(),
+		}
+	}
+	if ctx.Err() != nil {
+		return fail(ctx.Err())
+	}
+
+	desiredThroughput := host.BaselineBandwidthGbps
+	if desiredThroughput == 0 {
+		desiredThroughput = o.input.DesiredThroughput
+	}
+
+	bctx := &benchmark.BenchmarkContext{
+		Target:            o.targets[i],
+		DesiredThroughput: desiredThroughput,
+		Bucket:            o.input.Bucket,
+		Keys:              keys,
+		Objects:           o.cfg.ObjectSpecs,
+		Region:            o.input.Region,
+		Endpoint:          o.input.Endpoint,
+	}
+
+	br := benchmark.NewBenchmarkRunner(&benchmark.BenchmarkRunnerInput{
+		Benchmark:      b,
+		ProfilerKind:   o.input.ProfilerKind,
+		ProfileSaveDir: o.input.ProfileSaveDir,
+		Runs:           o.input.BenchmarkRuns,
+		Timeouts:       o.input.Timeouts,
+		Collectors:     o.input.Collectors,
+		SampleInterval: o.input.SampleInterval,
+	})
+	err := br.SetUp(ctx, bctx, o.input.S3Prefixes)
+	if err != nil {
+		return fail(err)
+	}
+
+	rep := br.Run(ctx)
+	rep.Metadata = append(rep.Metadata, meta)
+	return rep
+}
+
+type queuedBenchmark struct {
+	b    benchmark.Benchmark
+	lock *sync.Mutex // held while running b if it is shared with other hosts. nil if it isn't shared.
+}
+
+func (o *staticHostBenchmarkOrchestrator) RunBenchmarks(ctx context.Context) (*Report, error) {
+	// If this is interrupted, the benchmarks fail right away so the partial report is still returned
+	warmUp, err := prepareObjects(ctx, o.cfg, nil)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, obj := range o.cfg.ObjectSpecs {
+		keys = append(keys, obj.Key)
+	}
+
+	// Each host works through its own queue, so a host only ever runs one benchmark at a time.
+	// Unless every benchmark must run on every host, all hosts share one queue.
+	queues := make([]chan queuedBenchmark, len(o.targets))
+	if o.input.RunOnEveryHost {
+		// Each host gets its own copy of each benchmark because setting one up on a host overwrites what it knows
+		// about the last host. Benchmarks which can't be copied run on one host at a time instead.
+		locks := make([]*sync.Mutex, len(o.benchmarks))
+		for i := range queues {
+			queues[i] = make(chan queuedBenchmark, len(o.benchmarks))
+			for j, b := range o.benchmarks {
+				clone, ok := benchmark.CloneOf(b)
+				if !ok && locks[j] == nil {
+					slog.Warn("benchmark can't be copied, so it will run on one host at a time", slog.String("benchmark", b.GetName()))
+					locks[j] = &sync.Mutex{}
+				}
+				queues[i] <- queuedBenchmark{b: clone, lock: locks[j]}
+			}
+			close(queues[i])
+		}
+	} else {
+		shared := make(chan queuedBenchmark, len(o.benchmarks))
+		for _, b := range o.benchmarks {
+			shared <- queuedBenchmark{b: b}
+		}
+		close(shared)
+		for i := range queues {
+			queues[i] = shared
+		}
+	}
+
+	mu := &sync.Mutex{}
+	rep := &Report{
+		Config:  o.cfg,
+		WarmUp:  warmUp,
+		Reports: []*report.BenchmarkReport{},
+	}
+	wg := &sync.WaitGroup{}
+	for i := range o.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for qb := range queues[i] {
+				if qb.lock != nil {
+					qb.lock.Lock()
+				}
+				r := o.runBenchmark(ctx, keys, qb.b, i)
+				if qb.lock != nil {
+					qb.lock.Unlock()
+				}
+				mu.Lock()
+				rep.Reports = append(rep.Reports, r)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return rep, nil
+}
+
+// The hosts are not owned by this orchestrator so there is nothing to tear down.
+func (o *staticHostBenchmarkOrchestrator) TearDown() error {
+	return nil
+}
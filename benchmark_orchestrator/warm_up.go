@@ -0,0 +1,157 @@
+package benchmarkorchestrator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	objectprovider "github.com/Octogonapus/S3Benchmark/object_provider"
+	"github.com/Octogonapus/S3Benchmark/util"
+)
+
+type WarmUpSource string
+
+const (
+	WarmUpLocal    WarmUpSource = "local"    // the machine running the orchestrator
+	WarmUpInstance WarmUpSource = "instance" // a dedicated EC2 instance. only supported by the EC2 orchestrator.
+)
+
+// Reads the objects before benchmarking so that benchmarks don't measure S3 scaling up for a new prefix.
+type WarmUpConfig struct {
+	Source         WarmUpSource // local by default
+	Passes         int          // how many times each object is read. 1 by default.
+	SampleFraction float64      // read a random sample of this fraction of the objects. all objects if zero.
+	Concurrency    int          // how many objects are read at once. 32 by default.
+	InstanceType   string       `json:",omitempty"` // for WarmUpInstance. the first instance type by default.
+}
+
+type WarmUpReport struct {
+	Source         WarmUpSource
+	InstanceType   string `json:",omitempty"`
+	Passes         int
+	ObjectCount    int // distinct objects read
+	BytesRead      int64
+	DurationSec    float64
+	ThroughputGbps float64
+}
+
+func (c *WarmUpConfig) withDefaults() *WarmUpConfig {
+	out := *c
+	if out.Source == "" {
+		out.Source = WarmUpLocal
+	}
+	out.Passes = max(out.Passes, 1)
+	if out.Concurrency <= 0 {
+		out.Concurrency = 32
+	}
+	return &out
+}
+
+// Returns an error if the warm-up can't be done by an orchestrator. Orchestrators which can't launch instances can only
+// warm up locally.
+func validateWarmUp(cfg *BenchmarkConfig, canUseInstance bool) error {
+	if cfg.WarmUp == nil {
+		return nil
+	}
+	if cfg.WarmUp.SampleFraction < 0 || cfg.WarmUp.SampleFraction > 1 {
+		return fmt.Errorf("warm-up sample fraction must be between 0 and 1")
+	}
+	switch cfg.WarmUp.withDefaults().Source {
+	case WarmUpLocal:
+		if cfg.Objects == nil {
+			return fmt.Errorf("warming up locally needs an object provider")
+		}
+	case WarmUpInstance:
+		if !canUseInstance {
+			return fmt.Errorf("this orchestrator can't warm up from an instance")
+		}
+	default:
+		return fmt.Errorf("unknown warm-up source: %s", cfg.WarmUp.Source)
+	}
+	return nil
+}
+
+// Returns a random sample of the objects, or all of them if fraction is zero.
+func sampleObjects(objects []*objectprovider.ObjectSpec, fraction float64) []*objectprovider.ObjectSpec {
+	if fraction == 0 || fraction >= 1 {
+		return objects
+	}
+	n := max(int(math.Round(float64(len(objects))*fraction)), 1)
+	sample := []*objectprovider.ObjectSpec{}
+	for _, i := range rand.Perm(len(objects))[:n] {
+		sample = append(sample, objects[i])
+	}
+	return sample
+}
+
+// Reads the objects from this machine.
+func warmUpLocally(ctx context.Context, cfg *BenchmarkConfig, warmUp *WarmUpConfig, objects []*objectprovider.ObjectSpec) (*WarmUpReport, error) {
+	start := time.Now()
+	bytesRead, err := cfg.Objects.ReadObjects(ctx, objects, warmUp.Passes, warmUp.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	return newWarmUpReport(warmUp, objects, bytesRead, time.Since(start).Seconds()), nil
+}
+
+func newWarmUpReport(warmUp *WarmUpConfig, objects []*objectprovider.ObjectSpec, bytesRead int64, durationSec float64) *WarmUpReport {
+	rep := &WarmUpReport{
+		Source:      warmUp.Source,
+		Passes:      warmUp.Passes,
+		ObjectCount: len(objects),
+		BytesRead:   bytesRead,
+		DurationSec: durationSec,
+	}
+	if durationSec > 0 {
+		rep.ThroughputGbps = float64(bytesRead) * 8 / 1e9 / durationSec
+	}
+	return rep
+}
+
+// Warms up the objects if the config asks to, then waits until DelayAfterUpload has passed. warmUpOnInstance is nil
+// for orchestrators which can't warm up from an instance.
+func prepareObjects(
+	ctx context.Context,
+	cfg *BenchmarkConfig,
+	warmUpOnInstance func(ctx context.Context, warmUp *WarmUpConfig, objects []*objectprovider.ObjectSpec) (*WarmUpReport, error),
+) (*WarmUpReport, error) {
+	var rep *WarmUpReport
+	if cfg.WarmUp != nil {
+		warmUp := cfg.WarmUp.withDefaults()
+		objects := sampleObjects(cfg.ObjectSpecs, warmUp.SampleFraction)
+		slog.Info("warming up objects",
+			slog.String("source", string(warmUp.Source)),
+			slog.Int("objects", len(objects)),
+			slog.Int("passes", warmUp.Passes),
+		)
+		var err error
+		if warmUp.Source == WarmUpInstance {
+			rep, err = warmUpOnInstance(ctx, warmUp, objects)
+		} else {
+			rep, err = warmUpLocally(ctx, cfg, warmUp, objects)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("warming up objects failed: %w", err)
+		}
+		slog.Info("finished warming up objects",
+			slog.Float64("durationSec", rep.DurationSec),
+			slog.Float64("throughputGbps", rep.ThroughputGbps),
+		)
+	}
+
+	if cfg.DelayAfterUpload > 0 {
+		if cfg.UploadedAt.IsZero() {
+			slog.Warn("not waiting after upload because the objects weren't uploaded by this run")
+		} else if wait := time.Until(cfg.UploadedAt.Add(cfg.DelayAfterUpload)); wait > 0 {
+			slog.Info("waiting after upload", slog.Duration("wait", wait))
+			err := util.Sleep(ctx, wait)
+			if err != nil {
+				return rep, err
+			}
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"path"
+
+	benchmarkorchestrator "github.com/Octogonapus/S3Benchmark/benchmark_orchestrator"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Deletes the AWS resources of EC2 runs which didn't tear down, e.g. because they were killed.
+func cleanupMain(args []string) {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	stateFile := fs.String("state-file", path.Join("results", benchmarkorchestrator.EC2StateFileName), "The state file written by the run to clean up.")
+	runID := fs.String("run-id", "", "Find the resources to clean up by this run ID tag instead of reading -state-file.")
+	all := fs.Bool("all", false, "Find the resources of every run by their run ID tags instead of reading -state-file. "+
+		"Runs with pending or running instances may still be in progress, so they are skipped unless -include-running is set.")
+	includeRunning := fs.Bool("include-running", false, "With -all, also clean up runs whose instances are still pending or running.")
+	region := fs.String("region", "", "The region to clean up. Read from -state-file or the environment if empty.")
+	fs.Parse(args)
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithEC2IMDSRegion())
+	if err != nil {
+		panic(err)
+	}
+	if *region != "" {
+		cfg.Region = *region
+	}
+
+	var states []*benchmarkorchestrator.EC2State
+	fromFile := *runID == "" && !*all
+	if fromFile {
+		state, err := benchmarkorchestrator.LoadEC2State(*stateFile)
+		if err != nil {
+			panic(err)
+		}
+		if *region == "" && state.Region != "" {
+			cfg.Region = state.Region
+		}
+		states = append(states, state)
+	} else {
+		states, err = benchmarkorchestrator.FindEC2Resources(cfg, *runID)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	failed := false
+	for _, state := range states {
+		if *all && !*includeRunning {
+			running, err := benchmarkorchestrator.RunningInstances(cfg, state)
+			if err != nil {
+				slog.Error("failed to check for running instances", slog.String("runID", state.RunID), slog.String("error", err.Error()))
+				failed = true
+				continue
+			}
+			if len(running) > 0 {
+				slog.Warn("skipping run with running instances because it may still be in progress; "+
+					"clean it up with -run-id or -include-running",
+					slog.String("runID", state.RunID),
+					slog.Any("instanceIDs", running),
+				)
+				continue
+			}
+		}
+		slog.Info("cleaning up", slog.String("runID", state.RunID), slog.String("region", cfg.Region))
+		err := benchmarkorchestrator.CleanUpEC2Resources(cfg, state)
+		if err != nil {
+			slog.Error("cleanup failed", slog.String("runID", state.RunID), slog.String("error", err.Error()))
+			failed = true
+		}
+		if fromFile {
+			// Keep only what is left so that the cleanup can be retried
+			err = benchmarkorchestrator.SaveEC2State(*stateFile, state)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
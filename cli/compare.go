@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	benchmarkorchestrator "github.com/Octogonapus/S3Benchmark/benchmark_orchestrator"
+	reportcompare "github.com/Octogonapus/S3Benchmark/report_compare"
+)
+
+// Compares two report.json files and exits non-zero if the candidate regressed.
+func compareMain(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	baselinePath := fs.String("baseline", "", "The baseline report. Required.")
+	candidatePath := fs.String("candidate", "", "The candidate report. Required.")
+	threshold := fs.Float64("threshold", 5, "A drop in median throughput larger than this percentage is a regression, if it is statistically significant.")
+	alpha := fs.Float64("alpha", 0.05, "The significance level of the Mann-Whitney U test across repetitions. At least 4 repetitions on each side are needed to reach 0.05.")
+	fs.Parse(args)
+
+	if *baselinePath == "" || *candidatePath == "" {
+		panic(fmt.Errorf("baseline and candidate are required flags"))
+	}
+
+	baseline := loadReport(*baselinePath)
+	candidate := loadReport(*candidatePath)
+
+	comparisons, err := reportcompare.Compare(baseline, candidate, &reportcompare.CompareInput{
+		RegressionThresholdPct: *threshold,
+		Alpha:                  *alpha,
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = reportcompare.WriteTable(os.Stdout, comparisons)
+	if err != nil {
+		panic(err)
+	}
+	if reportcompare.HasRegression(comparisons) {
+		os.Exit(1)
+	}
+}
+
+func loadReport(p string) *benchmarkorchestrator.Report {
+	buf, err := os.ReadFile(p)
+	if err != nil {
+		panic(err)
+	}
+	rep := &benchmarkorchestrator.Report{}
+	err = json.Unmarshal(buf, rep)
+	if err != nil {
+		panic(err)
+	}
+	return rep
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+
+	fakes3 "github.com/Octogonapus/S3Benchmark/fake_s3"
+)
+
+// Serves an in-memory fake S3 until killed. Use with -endpoint-url and -path-style.
+func fakeS3Main(args []string) {
+	fs := flag.NewFlagSet("fake-s3", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:9000", "The address to listen on.")
+	latency := fs.Duration("latency", 0, "Added to the time to first byte of every response.")
+	bandwidthMbit := fs.Float64("bandwidth-mbit", 0, "Bandwidth shared by all uploads, and separately by all downloads. Unlimited if zero.")
+	slowDownRate := fs.Float64("slowdown-rate", 0, "The fraction of requests which fail with 503 SlowDown at random.")
+	prefixReads := fs.Int("prefix-reads-per-sec", 0, "GET and HEAD requests per second per prefix before 503 SlowDown. S3 allows 5500. Unlimited if zero.")
+	prefixWrites := fs.Int("prefix-writes-per-sec", 0, "Other requests per second per prefix before 503 SlowDown. S3 allows 3500. Unlimited if zero.")
+	fs.Parse(args)
+
+	fake := fakes3.NewFakeS3(&fakes3.FakeS3Input{
+		Latency:              *latency,
+		BandwidthBytesPerSec: int64(*bandwidthMbit * 1e6 / 8),
+		SlowDownRate:         *slowDownRate,
+		PrefixReadsPerSec:    *prefixReads,
+		PrefixWritesPerSec:   *prefixWrites,
+	})
+	slog.Info("serving fake S3", slog.String("addr", *addr))
+	err := http.ListenAndServe(*addr, fake)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -7,13 +7,19 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"os"
+	"os/signal"
 	"path"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Octogonapus/S3Benchmark/benchmark"
 	benchmarkorchestrator "github.com/Octogonapus/S3Benchmark/benchmark_orchestrator"
 	objectprovider "github.com/Octogonapus/S3Benchmark/object_provider"
 	"github.com/Octogonapus/S3Benchmark/profile"
+	systemmonitor "github.com/Octogonapus/S3Benchmark/system_monitor"
 	"github.com/aws/aws-sdk-go-v2/config"
 	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
@@ -29,7 +35,35 @@ func (bfs *benchmarkFiles) Set(value string) error {
 	return nil
 }
 
+// Splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "report":
+			reportMain(os.Args[2:])
+			return
+		case "compare":
+			compareMain(os.Args[2:])
+			return
+		case "fake-s3":
+			fakeS3Main(os.Args[2:])
+			return
+		case "cleanup":
+			cleanupMain(os.Args[2:])
+			return
+		}
+	}
+
 	bucketName := flag.String("bucket-name", "benchmark-bucket-qoizxbnks", "The bucket name.")
 	uploadOnly := flag.Bool("upload-only", false, "Only upload objects to a bucket. Creates the bucket if it does not exist. Does not destroy the bucket.")
 	skipUpload := flag.Bool("skip-upload", false, "Skip uploading objects. The selected objects must already exist.")
@@ -42,6 +76,47 @@ func main() {
 	bfiles := benchmarkFiles{}
 	flag.Var(&bfiles, "benchmark-file", "The benchmark configuration file containing all the benchmark specifications. Can be used multiple times; all benchmarks will be loaded. At least one is required.")
 	benchmarkConcurrency := flag.Int("benchmark-concurrency", 0, "How many benchmarks can be run concurrently. Unlimited by default.")
+	benchmarkRuns := flag.Int("benchmark-runs", 1, "How many times to run each benchmark.")
+	benchmarkTimeout := flag.Duration("benchmark-timeout", 0, "How long each benchmark may take, including setup and every run. Unlimited if zero. Overridden by Timeouts in benchmark files.")
+	setUpTimeout := flag.Duration("setup-timeout", 0, "How long each benchmark's setup may take. Unlimited if zero. Overridden by Timeouts in benchmark files.")
+	runTimeout := flag.Duration("run-timeout", 0, "How long each run of a benchmark command may take. Unlimited if zero. Overridden by Timeouts in benchmark files.")
+	endpointURL := flag.String("endpoint-url", "", "The URL of an S3-compatible service (e.g. http://minio:9000) to use instead of AWS S3.")
+	pathStyle := flag.Bool("path-style", false, "Address buckets as <endpoint-url>/<bucket> instead of <bucket>.<endpoint-url>. Most S3-compatible services need this.")
+	accessKeyID := flag.String("access-key-id", "", "A static access key ID used locally and by the benchmarks. The default credential chain is used if empty.")
+	secretAccessKey := flag.String("secret-access-key", "", "The secret access key for -access-key-id.")
+	sessionToken := flag.String("session-token", "", "The optional session token for -access-key-id.")
+	region := flag.String("region", "", "The S3 region. Determined from the environment or EC2 instance metadata if empty.")
+	hostsFile := flag.String("hosts-file", "", "A path to a JSON file listing pre-provisioned SSH hosts (Address, Port, User, KeyPath, LocalDir, Tags, BaselineBandwidthGbps). When set, benchmarks run on these hosts instead of on new EC2 instances.")
+	localDir := flag.String("local-dir", "", "Run benchmarks on this machine, as root, in this directory instead of on new EC2 instances.")
+	runOnEveryHost := flag.Bool("run-on-every-host", false, "With -hosts-file, run every benchmark on every host instead of once on whichever host is free.")
+	desiredThroughput := flag.Float64("desired-throughput-gbps", 0, "With -hosts-file or -local-dir, the baseline network bandwidth of hosts which don't set BaselineBandwidthGbps. Throughput is reported as a fraction of it.")
+	s3Prefixes := flag.String("s3-prefixes", "", "With -hosts-file, -local-dir, or -docker-image, a comma-separated list of S3's IP ranges (e.g. 52.216.0.0/15) used to count connections to S3. EC2 runs look them up.")
+	dockerImage := flag.String("docker-image", "", "Run each benchmark in local Docker containers of this image (e.g. ubuntu:22.04) instead of on new EC2 instances. Requires -container-sizes-file.")
+	containerSizesFile := flag.String("container-sizes-file", "", "A path to a JSON file listing container sizes (Name, CPUs, MemoryBytes, NetworkBandwidthMbit) for -docker-image. Each benchmark runs once per size.")
+	dockerNetwork := flag.String("docker-network", "", "The Docker network to attach containers to, e.g. one shared with a local S3 stand-in.")
+	spot := flag.Bool("spot", false, "Run EC2 benchmarks on Spot instances. Benchmarks whose instance is reclaimed are rerun on a new instance.")
+	spotMaxPrice := flag.String("spot-max-price", "", "The max price per Spot instance hour in USD. The on-demand price if empty.")
+	spotFallback := flag.Bool("spot-fallback", false, "Launch an on-demand instance when there is no Spot capacity.")
+	spotMaxInterruptions := flag.Int("spot-max-interruptions", 3, "How many times a benchmark is rerun after its Spot instance is reclaimed.")
+	capacityReservationID := flag.String("capacity-reservation-id", "", "Launch EC2 instances into this capacity reservation. Can't be used with -spot.")
+	osImage := flag.String("os", string(benchmarkorchestrator.Ubuntu2204), fmt.Sprintf("The OS to run EC2 instances with. Its latest AMI in the region is used. Must be one of: %s.", benchmarkorchestrator.ExplainOSImages()))
+	placementGroup := flag.String("placement-group", "", "Launch EC2 instances into this existing placement group.")
+	instanceTypes := flag.String("instance-types", "", "A comma-separated list of EC2 instance types to run each benchmark on. m6i.8xlarge if neither this nor a query flag is set. Overridden by InstanceTypes in benchmark files.")
+	instanceFamilies := flag.String("instance-families", "", "Query: select instance types in these comma-separated families (e.g. c6in,m7i*). The instance types matching every query flag are added to -instance-types.")
+	currentGeneration := flag.Bool("current-generation", false, "Query: select current-generation instance types.")
+	minBandwidth := flag.Float64("min-bandwidth-gbps", 0, "Query: select instance types with at least this baseline network bandwidth.")
+	minVCPUs := flag.Int("min-vcpus", 0, "Query: select instance types with at least this many vCPUs.")
+	maxVCPUs := flag.Int("max-vcpus", 0, "Query: select instance types with at most this many vCPUs.")
+	architecture := flag.String("architecture", "", "Query: select instance types with this architecture (x86_64 or arm64).")
+	warmUp := flag.Bool("warm-up", false, "Read the objects before benchmarking. The warm-up's duration and throughput are recorded in the report.")
+	warmUpSource := flag.String("warm-up-source", string(benchmarkorchestrator.WarmUpLocal), "Where to read the objects from when warming up: \"local\" (this machine) or \"instance\" (a dedicated EC2 instance).")
+	warmUpPasses := flag.Int("warm-up-passes", 1, "How many times each object is read when warming up.")
+	warmUpSample := flag.Float64("warm-up-sample", 0, "Only read a random sample of this fraction of the objects when warming up. All objects if zero.")
+	warmUpConcurrency := flag.Int("warm-up-concurrency", 32, "How many objects are read at once when warming up.")
+	warmUpInstanceType := flag.String("warm-up-instance-type", "", "The EC2 instance type to warm up from. The first instance type if empty.")
+	delayAfterUpload := flag.Duration("delay-after-upload", 0, "Start benchmarking at least this long after the objects finished uploading (e.g. 30m), after any warm-up.")
+	collectors := flag.String("collectors", strings.Join(systemmonitor.DefaultCollectors, ","), fmt.Sprintf("A comma-separated list of the system monitor's collectors to run during each benchmark. Each must be one of: %s.", systemmonitor.ExplainCollectors()))
+	sampleInterval := flag.Duration("sample-interval", time.Second, "How often the system monitor samples each target. At least 100ms.")
 	flag.Parse()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
@@ -52,11 +127,26 @@ func main() {
 	if len(bfiles) == 0 {
 		panic(fmt.Errorf("benchmark-file is a required flag"))
 	}
+	err := systemmonitor.ValidateCollectors(splitList(*collectors))
+	if err != nil {
+		panic(err)
+	}
 
 	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithEC2IMDSRegion())
 	if err != nil {
 		panic(err)
 	}
+	if *region != "" {
+		cfg.Region = *region
+	}
+
+	endpoint := objectprovider.S3Endpoint{
+		URL:             *endpointURL,
+		UsePathStyle:    *pathStyle,
+		AccessKeyID:     *accessKeyID,
+		SecretAccessKey: *secretAccessKey,
+		SessionToken:    *sessionToken,
+	}
 
 	var objectSpecs []*objectprovider.ObjectSpec
 	if *objectsPath != "" {
@@ -77,11 +167,13 @@ func main() {
 
 	objProvider := objectprovider.NewS3ObjectProvider(&objectprovider.S3ObjectProviderInput{
 		AwsConfig:         cfg,
+		Endpoint:          endpoint,
 		Bucket:            *bucketName,
 		UploadConcurrency: *uploadConcurrency,
 	})
 	objProvider.SetObjects(objectSpecs)
 
+	var uploadedAt time.Time
 	if *uploadOnly {
 		err = objProvider.SetUp()
 		if err != nil {
@@ -107,21 +199,140 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
+		uploadedAt = time.Now()
 	}
 
-	orch, err := benchmarkorchestrator.NewEC2BenchmarkOrchestrator(&benchmarkorchestrator.EC2BenchmarkOrchestratorInput{
-		AwsConfig: cfg,
-		InstanceTypes: []ec2Types.InstanceType{
-			ec2Types.InstanceTypeM6i8xlarge,
-		},
-		WaitToInitialize:     false, // TODO make flag and set true by default
-		Bucket:               objProvider.GetBucket(),
-		ProfilerKind:         profile.ProfilerKind(*profiler),
-		ProfileSaveDir:       *profileSaveDir,
-		BenchmarkConcurrency: *benchmarkConcurrency,
-	})
-	if err != nil {
-		panic(err)
+	timeouts := benchmark.Timeouts{
+		Benchmark: *benchmarkTimeout,
+		SetUp:     *setUpTimeout,
+		Run:       *runTimeout,
+	}
+
+	var instanceTypeQuery *benchmarkorchestrator.InstanceTypeQuery
+	if *instanceFamilies != "" || *currentGeneration || *minBandwidth > 0 || *minVCPUs > 0 || *maxVCPUs > 0 || *architecture != "" {
+		instanceTypeQuery = &benchmarkorchestrator.InstanceTypeQuery{
+			Families:                 splitList(*instanceFamilies),
+			CurrentGenerationOnly:    *currentGeneration,
+			MinBaselineBandwidthGbps: *minBandwidth,
+			MinVCPUs:                 int32(*minVCPUs),
+			MaxVCPUs:                 int32(*maxVCPUs),
+			Architecture:             *architecture,
+		}
+	}
+	ec2InstanceTypes := []ec2Types.InstanceType{}
+	for _, instanceType := range splitList(*instanceTypes) {
+		ec2InstanceTypes = append(ec2InstanceTypes, ec2Types.InstanceType(instanceType))
+	}
+	if len(ec2InstanceTypes) == 0 && instanceTypeQuery == nil {
+		ec2InstanceTypes = append(ec2InstanceTypes, ec2Types.InstanceTypeM6i8xlarge)
+	}
+
+	prefixes := []netip.Prefix{}
+	for _, p := range splitList(*s3Prefixes) {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			panic(fmt.Errorf("invalid s3-prefixes: %w", err))
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	var orch benchmarkorchestrator.BenchmarkOrchestrator
+	platforms := 0
+	for _, flagValue := range []string{*hostsFile, *dockerImage, *localDir} {
+		if flagValue != "" {
+			platforms++
+		}
+	}
+	if platforms > 1 {
+		panic(fmt.Errorf("only one of hosts-file, docker-image, and local-dir can be used"))
+	}
+	if *dockerImage != "" {
+		if *containerSizesFile == "" {
+			panic(fmt.Errorf("container-sizes-file is required with docker-image"))
+		}
+		buf, err := os.ReadFile(*containerSizesFile)
+		if err != nil {
+			panic(err)
+		}
+		sizes, err := benchmarkorchestrator.LoadContainerSizesFromBuf(buf)
+		if err != nil {
+			panic(err)
+		}
+		orch, err = benchmarkorchestrator.NewDockerBenchmarkOrchestrator(&benchmarkorchestrator.DockerBenchmarkOrchestratorInput{
+			Image:                *dockerImage,
+			Network:              *dockerNetwork,
+			ContainerSizes:       sizes,
+			Bucket:               objProvider.GetBucket(),
+			Region:               cfg.Region,
+			Endpoint:             endpoint,
+			S3Prefixes:           prefixes,
+			ProfilerKind:         profile.ProfilerKind(*profiler),
+			ProfileSaveDir:       *profileSaveDir,
+			BenchmarkConcurrency: *benchmarkConcurrency,
+			BenchmarkRuns:        *benchmarkRuns,
+			Timeouts:             timeouts,
+			Collectors:           splitList(*collectors),
+			SampleInterval:       *sampleInterval,
+		})
+		if err != nil {
+			panic(err)
+		}
+	} else if *hostsFile != "" || *localDir != "" {
+		hosts := []*benchmarkorchestrator.StaticHost{{Address: "localhost", LocalDir: *localDir}}
+		if *hostsFile != "" {
+			buf, err := os.ReadFile(*hostsFile)
+			if err != nil {
+				panic(err)
+			}
+			hosts, err = benchmarkorchestrator.LoadStaticHostsFromBuf(buf)
+			if err != nil {
+				panic(err)
+			}
+		}
+		orch, err = benchmarkorchestrator.NewStaticHostBenchmarkOrchestrator(&benchmarkorchestrator.StaticHostBenchmarkOrchestratorInput{
+			Hosts:             hosts,
+			Bucket:            objProvider.GetBucket(),
+			Region:            cfg.Region,
+			Endpoint:          endpoint,
+			DesiredThroughput: *desiredThroughput,
+			S3Prefixes:        prefixes,
+			RunOnEveryHost:    *runOnEveryHost,
+			ProfilerKind:      profile.ProfilerKind(*profiler),
+			ProfileSaveDir:    *profileSaveDir,
+			BenchmarkRuns:     *benchmarkRuns,
+			Timeouts:          timeouts,
+			Collectors:        splitList(*collectors),
+			SampleInterval:    *sampleInterval,
+		})
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		orch, err = benchmarkorchestrator.NewEC2BenchmarkOrchestrator(&benchmarkorchestrator.EC2BenchmarkOrchestratorInput{
+			AwsConfig:              cfg,
+			InstanceTypes:          ec2InstanceTypes,
+			InstanceTypeQuery:      instanceTypeQuery,
+			WaitToInitialize:       false, // TODO make flag and set true by default
+			Bucket:                 objProvider.GetBucket(),
+			Endpoint:               endpoint,
+			ProfilerKind:           profile.ProfilerKind(*profiler),
+			ProfileSaveDir:         *profileSaveDir,
+			BenchmarkConcurrency:   *benchmarkConcurrency,
+			BenchmarkRuns:          *benchmarkRuns,
+			Timeouts:               timeouts,
+			Collectors:             splitList(*collectors),
+			SampleInterval:         *sampleInterval,
+			Spot:                   *spot,
+			SpotMaxPrice:           *spotMaxPrice,
+			SpotFallbackToOnDemand: *spotFallback,
+			SpotMaxInterruptions:   *spotMaxInterruptions,
+			CapacityReservationID:  *capacityReservationID,
+			PlacementGroup:         *placementGroup,
+			OSImage:                benchmarkorchestrator.OSImage(*osImage),
+		})
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	for _, bf := range bfiles {
@@ -134,11 +345,11 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
-		for _, sb := range benchmarks {
-			b, err := benchmark.DeserializeBenchmark(&sb)
-			if err != nil {
-				panic(err)
-			}
+		bs, err := benchmark.DeserializeBenchmarkFile(benchmarks)
+		if err != nil {
+			panic(err)
+		}
+		for _, b := range bs {
 			err = orch.AddBenchmark(b)
 			if err != nil {
 				panic(err)
@@ -156,20 +367,56 @@ func main() {
 		objectsDesc = objectprovider.AllObjectsWithDescriptions[objectprovider.Objects(*objects)]
 	}
 
+	// Interrupting kills the running benchmarks, writes a partial report, and tears down. Interrupting again exits
+	// immediately.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		signal.Stop(sigCh)
+		slog.Warn("interrupted, stopping benchmarks. Interrupt again to exit without tearing down.")
+		cancel()
+	}()
+
+	var warmUpConfig *benchmarkorchestrator.WarmUpConfig
+	if *warmUp {
+		warmUpConfig = &benchmarkorchestrator.WarmUpConfig{
+			Source:         benchmarkorchestrator.WarmUpSource(*warmUpSource),
+			Passes:         *warmUpPasses,
+			SampleFraction: *warmUpSample,
+			Concurrency:    *warmUpConcurrency,
+			InstanceType:   *warmUpInstanceType,
+		}
+	}
+
 	resultDir := "results"
-	err = orch.SetUp(&benchmarkorchestrator.BenchmarkConfig{
-		ObjectsName:   objectsName,
-		ObjectsDesc:   objectsDesc,
-		ObjectSpecs:   objProvider.GetObjects(),
-		ResultDir:     resultDir,
-		WarmUpObjects: false,
+	err = orch.SetUp(ctx, &benchmarkorchestrator.BenchmarkConfig{
+		ObjectsName:      objectsName,
+		ObjectsDesc:      objectsDesc,
+		ObjectSpecs:      objProvider.GetObjects(),
+		Objects:          objProvider,
+		ResultDir:        resultDir,
+		WarmUp:           warmUpConfig,
+		UploadedAt:       uploadedAt,
+		DelayAfterUpload: *delayAfterUpload,
 	})
-	defer orch.TearDown()
+	defer func() {
+		err := orch.TearDown()
+		if err != nil {
+			slog.Error("teardown failed; retry with the cleanup command", slog.String("error", err.Error()))
+		}
+	}()
 	if err != nil {
+		if ctx.Err() != nil {
+			slog.Error("interrupted during setup", slog.String("error", err.Error()))
+			return
+		}
 		panic(err)
 	}
 
-	report, err := orch.RunBenchmarks()
+	report, err := orch.RunBenchmarks(ctx)
 	if err != nil {
 		panic(err)
 	}
@@ -182,4 +429,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if ctx.Err() != nil {
+		slog.Warn("wrote a partial report because the run was interrupted")
+	}
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	reporthtml "github.com/Octogonapus/S3Benchmark/report_html"
+)
+
+// Renders a report.json file as a static HTML page.
+func reportMain(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	input := fs.String("input", "results/report.json", "The report to render.")
+	output := fs.String("output", "results/report.html", "Where to write the HTML page.")
+	fs.Parse(args)
+
+	rep := loadReport(*input)
+
+	f, err := os.Create(*output)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	err = reporthtml.Render(f, rep)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,92 @@
+package fakes3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Returns true if the request body uses aws-chunked encoding, which SDKs use for streaming uploads and trailing
+// checksums.
+func isAwsChunked(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") ||
+		strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked")
+}
+
+// Decodes an aws-chunked body. Each chunk is "<hex size>[;chunk-signature=...]\r\n<data>\r\n" and the body ends
+// with a zero-size chunk followed by optional trailers and an empty line. Signatures and checksums are not checked.
+type awsChunkedReader struct {
+	body      io.ReadCloser
+	r         *bufio.Reader
+	remaining int64 // bytes left in the current chunk
+	done      bool
+}
+
+func newAwsChunkedReader(body io.ReadCloser) *awsChunkedReader {
+	return &awsChunkedReader{body: body, r: bufio.NewReader(body)}
+}
+
+func (c *awsChunkedReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		err := c.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := c.r.Read(p[:min(int64(len(p)), c.remaining)])
+	c.remaining -= int64(n)
+	if c.remaining == 0 && err == nil {
+		// Consume the CRLF after the chunk data
+		_, err = c.readLine()
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (c *awsChunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeStr, _, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid aws-chunked chunk size %q: %w", line, err)
+	}
+	if size > 0 {
+		c.remaining = size
+		return nil
+	}
+
+	// The last chunk. Skip the trailers up to the empty line, which may be missing at the end of the body.
+	c.done = true
+	for {
+		line, err := c.readLine()
+		if err == io.EOF || (err == nil && line == "") {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *awsChunkedReader) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (c *awsChunkedReader) Close() error {
+	return c.body.Close()
+}
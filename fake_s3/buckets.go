@@ -0,0 +1,234 @@
+package fakes3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+func (f *FakeS3) createBucket(w http.ResponseWriter, r *http.Request, bucketName string) {
+	// The body may hold a CreateBucketConfiguration, but there is only one region
+	io.Copy(io.Discard, r.Body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.buckets[bucketName]; ok {
+		writeError(w, r, errBucketAlreadyOwnedByYou)
+		return
+	}
+	f.buckets[bucketName] = &bucket{objects: map[string]*object{}}
+	w.Header().Set("Location", "/"+bucketName)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FakeS3) deleteBucket(w http.ResponseWriter, r *http.Request, bucketName string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.buckets[bucketName]
+	if !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	if len(b.objects) > 0 {
+		writeError(w, r, errBucketNotEmpty)
+		return
+	}
+	delete(f.buckets, bucketName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeS3) headBucket(w http.ResponseWriter, r *http.Request, bucketName string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.buckets[bucketName]; !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+}
+
+func (f *FakeS3) getBucketLocation(w http.ResponseWriter, r *http.Request, bucketName string) {
+	f.mu.Lock()
+	_, ok := f.buckets[bucketName]
+	f.mu.Unlock()
+	if !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	// An empty location constraint means us-east-1
+	writeXML(w, http.StatusOK, &locationConstraint{Xmlns: s3Namespace})
+}
+
+type listContents struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	EncodingType          string `xml:",omitempty"`
+	Contents              []listContents
+	CommonPrefixes        []commonPrefix
+}
+
+func (f *FakeS3) listObjectsV2(w http.ResponseWriter, r *http.Request, bucketName string) {
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	delimiter := q.Get("delimiter")
+	encodeKey := func(k string) string { return k }
+	if q.Get("encoding-type") == "url" {
+		encodeKey = func(k string) string { return strings.ReplaceAll(url.QueryEscape(k), "+", "%20") }
+	}
+	maxKeys := 1000
+	if s := q.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err == nil && n >= 0 && n < maxKeys {
+			maxKeys = n
+		}
+	}
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		buf, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			writeError(w, r, &s3Error{http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect."})
+			return
+		}
+		after = max(after, string(buf))
+	}
+
+	f.mu.Lock()
+	b, ok := f.buckets[bucketName]
+	if !ok {
+		f.mu.Unlock()
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	keys := []string{}
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	res := &listBucketResult{
+		Xmlns:             s3Namespace,
+		Name:              bucketName,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		MaxKeys:           maxKeys,
+		EncodingType:      q.Get("encoding-type"),
+	}
+	lastPrefix := ""
+	for _, key := range keys {
+		if res.KeyCount == maxKeys {
+			res.IsTruncated = true
+			break
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				// Keys under the same common prefix are adjacent because they're sorted
+				cp := key[:len(prefix)+i+len(delimiter)]
+				if cp != lastPrefix {
+					res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: encodeKey(cp)})
+					res.KeyCount++
+					lastPrefix = cp
+				}
+				res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(cp + "\xff"))
+				continue
+			}
+		}
+		obj := b.objects[key]
+		res.Contents = append(res.Contents, listContents{
+			Key:          encodeKey(key),
+			LastModified: obj.lastModified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         obj.etag,
+			Size:         len(obj.data),
+			StorageClass: "STANDARD",
+		})
+		res.KeyCount++
+		res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	f.mu.Unlock()
+
+	if !res.IsTruncated {
+		res.NextContinuationToken = ""
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+type deleteRequest struct {
+	Quiet   bool
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+type deletedObject struct {
+	Key string
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Deleted []deletedObject
+}
+
+func (f *FakeS3) deleteObjects(w http.ResponseWriter, r *http.Request, bucketName string) {
+	req := deleteRequest{}
+	err := xml.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, r, errMalformedXML)
+		return
+	}
+
+	f.mu.Lock()
+	b, ok := f.buckets[bucketName]
+	if !ok {
+		f.mu.Unlock()
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	res := &deleteResult{Xmlns: s3Namespace}
+	for _, obj := range req.Objects {
+		// Deleting a key which doesn't exist succeeds
+		delete(b.objects, obj.Key)
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, deletedObject{Key: obj.Key})
+		}
+	}
+	f.mu.Unlock()
+
+	writeXML(w, http.StatusOK, res)
+}
@@ -0,0 +1,62 @@
+package fakes3
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+type s3Error struct {
+	status  int
+	code    string
+	message string
+}
+
+var (
+	errNoSuchBucket            = &s3Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist."}
+	errNoSuchKey               = &s3Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errNoSuchUpload            = &s3Error{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist."}
+	errBucketAlreadyOwnedByYou = &s3Error{http.StatusConflict, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it."}
+	errBucketNotEmpty          = &s3Error{http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty."}
+	errInvalidRange            = &s3Error{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable."}
+	errInvalidPart             = &s3Error{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found."}
+	errInvalidPartOrder        = &s3Error{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order."}
+	errEntityTooSmall          = &s3Error{http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size."}
+	errMalformedXML            = &s3Error{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed."}
+	errIncompleteBody          = &s3Error{http.StatusBadRequest, "IncompleteBody", "The request body could not be read."}
+	errSlowDown                = &s3Error{http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate."}
+	errNotImplemented          = &s3Error{http.StatusNotImplemented, "NotImplemented", "FakeS3 does not implement this request."}
+)
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string
+	RequestId string
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, e *s3Error) {
+	if r.Method == http.MethodHead {
+		// HEAD responses have no body, so clients only see the status
+		w.WriteHeader(e.status)
+		return
+	}
+	writeXML(w, e.status, &errorResponse{
+		Code:      e.code,
+		Message:   e.message,
+		Resource:  r.URL.Path,
+		RequestId: w.Header().Get("x-amz-request-id"),
+	})
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	buf, err := xml.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(buf)
+}
@@ -0,0 +1,181 @@
+package fakes3
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An in-memory S3 server for testing without AWS. It implements enough of the S3 API for the S3ObjectProvider, the Go
+// SDK, and the AWS CLI: buckets, PutObject, GetObject (with Range), HeadObject, ListObjectsV2, DeleteObject(s), and
+// multipart uploads. Only path-style addressing is supported and signatures are not checked.
+// Use it with httptest.NewServer or serve it with the fake-s3 CLI subcommand.
+type FakeS3 struct {
+	input    *FakeS3Input
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	uploads  map[string]*multipartUpload
+	ingress  *bandwidthLimiter // nil if unlimited
+	egress   *bandwidthLimiter // nil if unlimited
+	prefixes *prefixLimiter
+	random   *rand.Rand
+	randomMu sync.Mutex
+
+	requests  atomic.Int64
+	slowDowns atomic.Int64
+}
+
+// Knobs for simulating a loaded or distant S3. The zero value is a fast, reliable server.
+type FakeS3Input struct {
+	Latency              time.Duration // added to the time to first byte of every response
+	BandwidthBytesPerSec int64         // shared by all request bodies, and separately by all response bodies. unlimited if zero.
+	SlowDownRate         float64       // the fraction of requests which fail with 503 SlowDown at random
+	PrefixReadsPerSec    int           // GET and HEAD requests per second per prefix before 503 SlowDown. unlimited if zero.
+	PrefixWritesPerSec   int           // other requests per second per prefix before 503 SlowDown. unlimited if zero.
+}
+
+type Stats struct {
+	Requests  int64
+	SlowDowns int64 // requests rejected by SlowDownRate or a prefix limit
+}
+
+type bucket struct {
+	objects map[string]*object
+}
+
+type object struct {
+	data         []byte
+	etag         string // quoted, as in the ETag header
+	lastModified time.Time
+}
+
+func NewFakeS3(input *FakeS3Input) *FakeS3 {
+	f := &FakeS3{
+		input:    input,
+		buckets:  map[string]*bucket{},
+		uploads:  map[string]*multipartUpload{},
+		prefixes: newPrefixLimiter(input.PrefixReadsPerSec, input.PrefixWritesPerSec),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if input.BandwidthBytesPerSec > 0 {
+		f.ingress = newBandwidthLimiter(input.BandwidthBytesPerSec)
+		f.egress = newBandwidthLimiter(input.BandwidthBytesPerSec)
+	}
+	return f
+}
+
+func (f *FakeS3) Stats() Stats {
+	return Stats{Requests: f.requests.Load(), SlowDowns: f.slowDowns.Load()}
+}
+
+func (f *FakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := f.requests.Add(1)
+	w.Header().Set("x-amz-request-id", fmt.Sprintf("%016X", n))
+	w.Header().Set("Server", "FakeS3")
+
+	bucketName, key := splitPath(r.URL.Path)
+	if bucketName == "" {
+		writeError(w, r, errNotImplemented)
+		return
+	}
+
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if f.randomSlowDown() || !f.prefixes.allow(prefixOf(bucketName, key), read) {
+		f.slowDowns.Add(1)
+		writeError(w, r, errSlowDown)
+		return
+	}
+
+	if f.input.Latency > 0 {
+		time.Sleep(f.input.Latency)
+	}
+
+	if isAwsChunked(r) {
+		r.Body = newAwsChunkedReader(r.Body)
+	}
+	if f.ingress != nil {
+		r.Body = &limitedReadCloser{ReadCloser: r.Body, limiter: f.ingress}
+	}
+	if f.egress != nil {
+		w = &limitedResponseWriter{ResponseWriter: w, limiter: f.egress}
+	}
+
+	if key == "" {
+		f.serveBucket(w, r, bucketName)
+	} else {
+		f.serveObject(w, r, bucketName, key)
+	}
+}
+
+func (f *FakeS3) randomSlowDown() bool {
+	if f.input.SlowDownRate <= 0 {
+		return false
+	}
+	f.randomMu.Lock()
+	defer f.randomMu.Unlock()
+	return f.random.Float64() < f.input.SlowDownRate
+}
+
+func (f *FakeS3) serveBucket(w http.ResponseWriter, r *http.Request, bucketName string) {
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut:
+		f.createBucket(w, r, bucketName)
+	case r.Method == http.MethodDelete:
+		f.deleteBucket(w, r, bucketName)
+	case r.Method == http.MethodHead:
+		f.headBucket(w, r, bucketName)
+	case r.Method == http.MethodPost && q.Has("delete"):
+		f.deleteObjects(w, r, bucketName)
+	case r.Method == http.MethodGet && q.Has("location"):
+		f.getBucketLocation(w, r, bucketName)
+	case r.Method == http.MethodGet && q.Get("list-type") == "2":
+		f.listObjectsV2(w, r, bucketName)
+	default:
+		writeError(w, r, errNotImplemented)
+	}
+}
+
+func (f *FakeS3) serveObject(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		f.uploadPart(w, r, bucketName, key)
+	case r.Method == http.MethodPut && r.Header.Get("x-amz-copy-source") != "":
+		writeError(w, r, errNotImplemented)
+	case r.Method == http.MethodPut:
+		f.putObject(w, r, bucketName, key)
+	case r.Method == http.MethodGet && !q.Has("uploadId"):
+		f.getObject(w, r, bucketName, key, true)
+	case r.Method == http.MethodHead:
+		f.getObject(w, r, bucketName, key, false)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		f.abortMultipartUpload(w, r, bucketName, key)
+	case r.Method == http.MethodDelete:
+		f.deleteObject(w, r, bucketName, key)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.createMultipartUpload(w, r, bucketName, key)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		f.completeMultipartUpload(w, r, bucketName, key)
+	default:
+		writeError(w, r, errNotImplemented)
+	}
+}
+
+// Splits a path-style request path into the bucket and the object key.
+func splitPath(p string) (string, string) {
+	p = strings.TrimPrefix(p, "/")
+	bucketName, key, _ := strings.Cut(p, "/")
+	return bucketName, key
+}
+
+// Returns the prefix used for request rate limits: the bucket and the key up to and including its last slash.
+// Real S3 partitions prefixes dynamically, so this is only an approximation.
+func prefixOf(bucketName, key string) string {
+	i := strings.LastIndex(key, "/")
+	return bucketName + "/" + key[:i+1]
+}
@@ -0,0 +1,216 @@
+package fakes3_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	fakes3 "github.com/Octogonapus/S3Benchmark/fake_s3"
+	objectprovider "github.com/Octogonapus/S3Benchmark/object_provider"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const testBucket = "test-bucket"
+
+func newServer(t *testing.T, input *fakes3.FakeS3Input) (*fakes3.FakeS3, *httptest.Server) {
+	fake := fakes3.NewFakeS3(input)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return fake, srv
+}
+
+func endpointFor(srv *httptest.Server) objectprovider.S3Endpoint {
+	return objectprovider.S3Endpoint{
+		URL:             srv.URL,
+		UsePathStyle:    true,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	_, srv := newServer(t, &fakes3.FakeS3Input{})
+	ctx := context.Background()
+	cfg := aws.Config{Region: "us-east-1"}
+	endpoint := endpointFor(srv)
+	client := s3.NewFromConfig(cfg, endpoint.Apply)
+
+	provider := objectprovider.NewS3ObjectProvider(&objectprovider.S3ObjectProviderInput{
+		AwsConfig:         cfg,
+		Endpoint:          endpoint,
+		Bucket:            testBucket,
+		UploadConcurrency: 4,
+	})
+	if err := provider.SetUp(); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+
+	// The provider uploads in 10 MiB parts, so the large object is a multipart upload
+	objects := []*objectprovider.ObjectSpec{
+		{Key: "a/small", SizeBytes: 1024},
+		{Key: "a/large", SizeBytes: 12 * 1024 * 1024},
+	}
+	provider.SetObjects(objects)
+	if err := provider.MakeObjects(); err != nil {
+		t.Fatalf("MakeObjects failed: %v", err)
+	}
+
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("a/large")})
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if got := aws.ToInt64(head.ContentLength); got != 12*1024*1024 {
+		t.Errorf("large object has %d bytes, want %d", got, 12*1024*1024)
+	}
+	if etag := aws.ToString(head.ETag); !strings.HasSuffix(etag, `-2"`) {
+		t.Errorf("large object ETag %s isn't a two part multipart ETag", etag)
+	}
+
+	bytesRead, err := provider.ReadObjects(ctx, objects, 2, 2)
+	if err != nil {
+		t.Fatalf("ReadObjects failed: %v", err)
+	}
+	if want := int64(2 * (1024 + 12*1024*1024)); bytesRead != want {
+		t.Errorf("ReadObjects read %d bytes, want %d", bytesRead, want)
+	}
+
+	data := []byte("0123456789abcdef")
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("b/known"),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	get, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("b/known"),
+		Range:  aws.String("bytes=4-9"),
+	})
+	if err != nil {
+		t.Fatalf("ranged GetObject failed: %v", err)
+	}
+	body, err := io.ReadAll(get.Body)
+	get.Body.Close()
+	if err != nil {
+		t.Fatalf("reading the ranged GetObject body failed: %v", err)
+	}
+	if string(body) != "456789" {
+		t.Errorf("ranged GetObject returned %q, want %q", body, "456789")
+	}
+
+	list, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(testBucket), Prefix: aws.String("a/")})
+	if err != nil {
+		t.Fatalf("ListObjectsV2 failed: %v", err)
+	}
+	keys := []string{}
+	for _, obj := range list.Contents {
+		keys = append(keys, aws.ToString(obj.Key))
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"a/large", "a/small"}) {
+		t.Errorf("ListObjectsV2 returned %v", keys)
+	}
+
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String("b/known")})
+	if err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	_, err = client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("b/known")})
+	if err == nil {
+		t.Errorf("HeadObject found a deleted object")
+	}
+
+	if err := provider.TearDown(); err != nil {
+		t.Fatalf("TearDown failed: %v", err)
+	}
+	_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(testBucket)})
+	if err == nil {
+		t.Errorf("HeadBucket found the bucket after TearDown")
+	}
+}
+
+// Sends an unsigned request. The fake doesn't check signatures, and the SDK would retry 503s.
+func do(t *testing.T, method, url string, body []byte) *http.Response {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestSlowDownRate(t *testing.T) {
+	fake, srv := newServer(t, &fakes3.FakeS3Input{SlowDownRate: 0.5})
+	const n = 1000
+	slowDowns := 0
+	for range n {
+		if do(t, http.MethodHead, srv.URL+"/"+testBucket, nil).StatusCode == http.StatusServiceUnavailable {
+			slowDowns++
+		}
+	}
+	if slowDowns < n*35/100 || slowDowns > n*65/100 {
+		t.Errorf("%d of %d requests were slowed down, want about half", slowDowns, n)
+	}
+	if stats := fake.Stats(); stats.Requests != n || stats.SlowDowns != int64(slowDowns) {
+		t.Errorf("stats are %+v, want %d requests and %d slow downs", stats, n, slowDowns)
+	}
+}
+
+func TestPrefixLimit(t *testing.T) {
+	_, srv := newServer(t, &fakes3.FakeS3Input{PrefixReadsPerSec: 5})
+	do(t, http.MethodPut, srv.URL+"/"+testBucket, nil)
+	do(t, http.MethodPut, srv.URL+"/"+testBucket+"/hot/obj", []byte("data"))
+
+	allowed := 0
+	for range 20 {
+		if do(t, http.MethodGet, srv.URL+"/"+testBucket+"/hot/obj", nil).StatusCode == http.StatusOK {
+			allowed++
+		}
+	}
+	// The requests may straddle a second, which gives them two windows
+	if allowed < 5 || allowed > 10 {
+		t.Errorf("%d of 20 reads from one prefix were allowed, want 5 per second", allowed)
+	}
+
+	// Other prefixes have their own limit
+	if resp := do(t, http.MethodHead, srv.URL+"/"+testBucket+"/cold/obj", nil); resp.StatusCode == http.StatusServiceUnavailable {
+		t.Errorf("a read from another prefix was slowed down")
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	const bytesPerSec = 1024 * 1024
+	_, srv := newServer(t, &fakes3.FakeS3Input{BandwidthBytesPerSec: bytesPerSec})
+	do(t, http.MethodPut, srv.URL+"/"+testBucket, nil)
+	data := make([]byte, bytesPerSec/4)
+
+	start := time.Now()
+	if resp := do(t, http.MethodPut, srv.URL+"/"+testBucket+"/obj", data); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT returned %s", resp.Status)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("uploading a quarter second of bandwidth took %v", elapsed)
+	}
+
+	start = time.Now()
+	if resp := do(t, http.MethodGet, srv.URL+"/"+testBucket+"/obj", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET returned %s", resp.Status)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("downloading a quarter second of bandwidth took %v", elapsed)
+	}
+}
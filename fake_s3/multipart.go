@@ -0,0 +1,183 @@
+package fakes3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every part except the last must be at least this large, like in S3.
+const minPartSize = 5 * 1024 * 1024
+
+type multipartUpload struct {
+	bucket string
+	key    string
+	parts  map[int]*object
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+func (f *FakeS3) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	uploadID := hex.EncodeToString(id)
+
+	f.mu.Lock()
+	_, ok := f.buckets[bucketName]
+	if ok {
+		f.uploads[uploadID] = &multipartUpload{bucket: bucketName, key: key, parts: map[int]*object{}}
+	}
+	f.mu.Unlock()
+	if !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   bucketName,
+		Key:      key,
+		UploadId: uploadID,
+	})
+}
+
+func (f *FakeS3) uploadPart(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	q := r.URL.Query()
+	partNumber, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > 10000 {
+		writeError(w, r, &s3Error{http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive."})
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, errIncompleteBody)
+		return
+	}
+	sum := md5.Sum(data)
+	part := &object{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		lastModified: time.Now(),
+	}
+
+	f.mu.Lock()
+	upload, ok := f.uploads[q.Get("uploadId")]
+	if ok && upload.bucket == bucketName && upload.key == key {
+		upload.parts[partNumber] = part
+	}
+	f.mu.Unlock()
+	if !ok {
+		writeError(w, r, errNoSuchUpload)
+		return
+	}
+
+	w.Header().Set("ETag", part.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+func (f *FakeS3) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	req := completeMultipartUpload{}
+	err := xml.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.Parts) == 0 {
+		writeError(w, r, errMalformedXML)
+		return
+	}
+	uploadID := r.URL.Query().Get("uploadId")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	upload, ok := f.uploads[uploadID]
+	if !ok || upload.bucket != bucketName || upload.key != key {
+		writeError(w, r, errNoSuchUpload)
+		return
+	}
+	b, ok := f.buckets[bucketName]
+	if !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+
+	data := &bytes.Buffer{}
+	sums := []byte{}
+	for i, p := range req.Parts {
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(w, r, errInvalidPartOrder)
+			return
+		}
+		part, ok := upload.parts[p.PartNumber]
+		if !ok || strings.Trim(part.etag, `"`) != strings.Trim(p.ETag, `"`) {
+			writeError(w, r, errInvalidPart)
+			return
+		}
+		if i < len(req.Parts)-1 && len(part.data) < minPartSize {
+			writeError(w, r, errEntityTooSmall)
+			return
+		}
+		data.Write(part.data)
+		sum, _ := hex.DecodeString(strings.Trim(part.etag, `"`))
+		sums = append(sums, sum...)
+	}
+
+	// Multipart ETags are the MD5 of the part MD5s followed by the number of parts
+	sum := md5.Sum(sums)
+	obj := &object{
+		data:         data.Bytes(),
+		etag:         fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(req.Parts)),
+		lastModified: time.Now(),
+	}
+	b.objects[key] = obj
+	delete(f.uploads, uploadID)
+
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/" + bucketName + "/" + key,
+		Bucket:   bucketName,
+		Key:      key,
+		ETag:     obj.etag,
+	})
+}
+
+func (f *FakeS3) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	uploadID := r.URL.Query().Get("uploadId")
+	f.mu.Lock()
+	upload, ok := f.uploads[uploadID]
+	if ok && upload.bucket == bucketName && upload.key == key {
+		delete(f.uploads, uploadID)
+	}
+	f.mu.Unlock()
+	if !ok {
+		writeError(w, r, errNoSuchUpload)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
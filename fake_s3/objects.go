@@ -0,0 +1,144 @@
+package fakes3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (f *FakeS3) putObject(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, errIncompleteBody)
+		return
+	}
+	sum := md5.Sum(data)
+	obj := &object{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		lastModified: time.Now(),
+	}
+
+	f.mu.Lock()
+	b, ok := f.buckets[bucketName]
+	if ok {
+		b.objects[key] = obj
+	}
+	f.mu.Unlock()
+	if !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+
+	w.Header().Set("ETag", obj.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FakeS3) getObject(w http.ResponseWriter, r *http.Request, bucketName, key string, withBody bool) {
+	obj, s3Err := f.lookUpObject(bucketName, key)
+	if s3Err != nil {
+		writeError(w, r, s3Err)
+		return
+	}
+
+	size := int64(len(obj.data))
+	start, end, partial, ok := parseRange(r.Header.Get("Range"), size)
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		writeError(w, r, errInvalidRange)
+		return
+	}
+
+	h := w.Header()
+	h.Set("ETag", obj.etag)
+	h.Set("Last-Modified", obj.lastModified.UTC().Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Length", strconv.FormatInt(end-start, 10))
+	status := http.StatusOK
+	if partial {
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	if withBody {
+		w.Write(obj.data[start:end])
+	}
+}
+
+func (f *FakeS3) deleteObject(w http.ResponseWriter, r *http.Request, bucketName, key string) {
+	f.mu.Lock()
+	b, ok := f.buckets[bucketName]
+	if ok {
+		// Deleting a key which doesn't exist succeeds
+		delete(b.objects, key)
+	}
+	f.mu.Unlock()
+	if !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeS3) lookUpObject(bucketName, key string) (*object, *s3Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.buckets[bucketName]
+	if !ok {
+		return nil, errNoSuchBucket
+	}
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, errNoSuchKey
+	}
+	return obj, nil
+}
+
+// Parses a Range header into the half-open byte range [start, end). partial is false if the whole object should be
+// sent, which is also what S3 does for headers it doesn't support (e.g. multiple ranges). ok is false if the range
+// can't be satisfied.
+func parseRange(header string, size int64) (start, end int64, partial bool, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if header == "" || !found || strings.Contains(spec, ",") {
+		return 0, size, false, true
+	}
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, size, false, true
+	}
+
+	if first == "" {
+		// A suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, size, false, true
+		}
+		if n == 0 {
+			return 0, 0, false, false
+		}
+		return max(0, size-n), size, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, size, false, true
+	}
+	end = size
+	if last != "" {
+		l, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || l < start {
+			return 0, size, false, true
+		}
+		end = min(size, l+1)
+	}
+	if start >= size {
+		return 0, 0, false, false
+	}
+	return start, end, true, true
+}
@@ -0,0 +1,113 @@
+package fakes3
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Bodies are throttled in chunks of this size so that concurrent transfers share bandwidth smoothly.
+const throttleChunkSize = 64 * 1024
+
+// Limits the total rate of bytes passed through it by delaying callers.
+type bandwidthLimiter struct {
+	mu          sync.Mutex
+	bytesPerSec float64
+	next        time.Time // when the bandwidth is free again
+}
+
+func newBandwidthLimiter(bytesPerSec int64) *bandwidthLimiter {
+	return &bandwidthLimiter{bytesPerSec: float64(bytesPerSec)}
+}
+
+// Blocks until n bytes may be sent.
+func (l *bandwidthLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.bytesPerSec * float64(time.Second)))
+	done := l.next
+	l.mu.Unlock()
+	time.Sleep(time.Until(done))
+}
+
+type limitedReadCloser struct {
+	io.ReadCloser
+	limiter *bandwidthLimiter
+}
+
+func (r *limitedReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p[:min(len(p), throttleChunkSize)])
+	r.limiter.wait(n)
+	return n, err
+}
+
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	limiter *bandwidthLimiter
+}
+
+func (w *limitedResponseWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), throttleChunkSize)]
+		w.limiter.wait(len(chunk))
+		n, err := w.ResponseWriter.Write(chunk)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Limits the number of requests per second to each prefix, like S3 does before it scales a prefix out.
+type prefixLimiter struct {
+	mu           sync.Mutex
+	readsPerSec  int
+	writesPerSec int
+	windows      map[string]*prefixWindow
+}
+
+type prefixWindow struct {
+	second int64
+	reads  int
+	writes int
+}
+
+func newPrefixLimiter(readsPerSec, writesPerSec int) *prefixLimiter {
+	return &prefixLimiter{readsPerSec: readsPerSec, writesPerSec: writesPerSec, windows: map[string]*prefixWindow{}}
+}
+
+// Returns true if the request is within the limits, and counts it if so.
+func (l *prefixLimiter) allow(prefix string, read bool) bool {
+	if l.readsPerSec <= 0 && l.writesPerSec <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now().Unix()
+	win, ok := l.windows[prefix]
+	if !ok || win.second != now {
+		win = &prefixWindow{second: now}
+		l.windows[prefix] = win
+	}
+
+	if read {
+		if l.readsPerSec > 0 && win.reads >= l.readsPerSec {
+			return false
+		}
+		win.reads++
+	} else {
+		if l.writesPerSec > 0 && win.writes >= l.writesPerSec {
+			return false
+		}
+		win.writes++
+	}
+	return true
+}
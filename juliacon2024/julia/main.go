@@ -105,19 +105,18 @@ func main() {
 	}
 
 	resultDir := "results"
-	err = orch.SetUp(&benchmarkorchestrator.BenchmarkConfig{
-		ObjectsName:   string(objects),
-		ObjectsDesc:   objectprovider.AllObjectsWithDescriptions[objects],
-		ObjectSpecs:   objProvider.GetObjects(),
-		ResultDir:     resultDir,
-		WarmUpObjects: false,
+	err = orch.SetUp(context.Background(), &benchmarkorchestrator.BenchmarkConfig{
+		ObjectsName: string(objects),
+		ObjectsDesc: objectprovider.AllObjectsWithDescriptions[objects],
+		ObjectSpecs: objProvider.GetObjects(),
+		ResultDir:   resultDir,
 	})
 	defer orch.TearDown()
 	if err != nil {
 		panic(err)
 	}
 
-	report, err := orch.RunBenchmarks()
+	report, err := orch.RunBenchmarks(context.Background())
 	if err != nil {
 		panic(err)
 	}
@@ -1,6 +1,7 @@
 package objectprovider
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"slices"
@@ -55,6 +56,10 @@ type ObjectProvider interface {
 
 	GetObjects() []*ObjectSpec
 
+	// Read the objects from this machine, each one passes times, with concurrency objects read at once. Returns the
+	// total bytes read.
+	ReadObjects(ctx context.Context, objects []*ObjectSpec, passes int, concurrency int) (int64, error)
+
 	GetBucket() string
 }
 
@@ -0,0 +1,33 @@
+package objectprovider
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Where and how to connect to S3. The zero value is AWS S3 with the default credential chain.
+// Set URL to use an S3-compatible service like MinIO or Ceph RGW.
+type S3Endpoint struct {
+	URL             string // e.g. http://minio:9000. the AWS S3 endpoint for the region if empty.
+	UsePathStyle    bool   // address buckets as URL/bucket instead of bucket.URL. most S3-compatible services need this.
+	AccessKeyID     string // static credentials. the default credential chain is used if empty.
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Returns true if static credentials were given.
+func (e *S3Endpoint) HasStaticCredentials() bool {
+	return e.AccessKeyID != ""
+}
+
+// Configures an S3 client to use the endpoint, e.g. s3.NewFromConfig(cfg, endpoint.Apply).
+func (e *S3Endpoint) Apply(o *s3.Options) {
+	if e.URL != "" {
+		o.BaseEndpoint = aws.String(e.URL)
+	}
+	o.UsePathStyle = e.UsePathStyle
+	if e.HasStaticCredentials() {
+		o.Credentials = credentials.NewStaticCredentialsProvider(e.AccessKeyID, e.SecretAccessKey, e.SessionToken)
+	}
+}
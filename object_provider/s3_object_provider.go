@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"sync/atomic"
 
 	"github.com/alitto/pond"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -24,6 +25,7 @@ type s3ObjectProvider struct {
 
 type S3ObjectProviderInput struct {
 	AwsConfig         aws.Config
+	Endpoint          S3Endpoint // AWS S3 by default
 	Bucket            string
 	UploadConcurrency int
 }
@@ -31,7 +33,7 @@ type S3ObjectProviderInput struct {
 func NewS3ObjectProvider(input *S3ObjectProviderInput) ObjectProvider {
 	return &s3ObjectProvider{
 		input: input,
-		s3:    s3.NewFromConfig(input.AwsConfig),
+		s3:    s3.NewFromConfig(input.AwsConfig, input.Endpoint.Apply),
 	}
 }
 
@@ -45,7 +47,7 @@ func (o *s3ObjectProvider) GetObjects() []*ObjectSpec {
 
 func (o *s3ObjectProvider) MakeObjects() error {
 	slog.Info("uploading objects", slog.String("bucket", o.input.Bucket))
-	uploader := manager.NewUploader(s3.NewFromConfig(o.input.AwsConfig), func(u *manager.Uploader) {
+	uploader := manager.NewUploader(o.s3, func(u *manager.Uploader) {
 		u.PartSize = 1024 * 1024 * 10
 	})
 	errChan := make(chan error, len(o.objects))
@@ -111,6 +113,47 @@ func (o *s3ObjectProvider) MakeObjects() error {
 	}
 }
 
+func (o *s3ObjectProvider) ReadObjects(ctx context.Context, objects []*ObjectSpec, passes int, concurrency int) (int64, error) {
+	var bytesRead atomic.Int64
+	errChan := make(chan error, len(objects)*passes)
+	pool := pond.New(concurrency, 0, pond.MinWorkers(concurrency))
+	p := progressbar.Default(int64(len(objects)*passes), "Reading objects:")
+	for range passes {
+		for _, obj := range objects {
+			pool.Submit(func() {
+				defer p.Add(1)
+				if ctx.Err() != nil {
+					errChan <- ctx.Err()
+					return
+				}
+				resp, err := o.s3.GetObject(ctx, &s3.GetObjectInput{
+					Bucket: &o.input.Bucket,
+					Key:    &obj.Key,
+				})
+				if err != nil {
+					errChan <- err
+					return
+				}
+				defer resp.Body.Close()
+				n, err := io.Copy(io.Discard, resp.Body)
+				bytesRead.Add(n)
+				if err != nil {
+					errChan <- err
+				}
+			})
+		}
+	}
+	pool.StopAndWait()
+	p.Finish()
+
+	select {
+	case err := <-errChan:
+		return bytesRead.Load(), fmt.Errorf("some S3 objects failed to read: %w", err)
+	default:
+		return bytesRead.Load(), nil
+	}
+}
+
 func (o *s3ObjectProvider) SetUp() error {
 	_, err := o.s3.CreateBucket(context.Background(), &s3.CreateBucketInput{
 		Bucket: &o.input.Bucket,
@@ -1,6 +1,7 @@
 package profile
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -8,8 +9,8 @@ import (
 )
 
 type Profiler interface {
-	SetUp() error
-	ProfileCommand(cmd string) (string, error)
+	SetUp(ctx context.Context) error
+	ProfileCommand(ctx context.Context, cmd string) (string, error)
 }
 
 type ProfilerKind string
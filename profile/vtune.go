@@ -1,6 +1,7 @@
 package profile
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -21,30 +22,36 @@ func NewVTune(target target.Target) Profiler {
 	return &vtune{target: target}
 }
 
-func (v *vtune) SetUp() error {
-	out, err := v.target.RunCommand("apt update -y && apt install -y gpg-agent wget")
+func (v *vtune) SetUp(ctx context.Context) error {
+	arch, err := target.DetectArch(ctx, v.target)
 	if err != nil {
-		slog.Error("VTune: installing deps failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
-		return fmt.Errorf("installing deps failed: %w", err)
+		return err
 	}
-	out, err = v.target.RunCommand("wget -O- https://apt.repos.intel.com/intel-gpg-keys/GPG-PUB-KEY-INTEL-SW-PRODUCTS.PUB | gpg --dearmor | tee /usr/share/keyrings/oneapi-archive-keyring.gpg > /dev/null")
+	if arch != target.X8664 {
+		return fmt.Errorf("VTune only supports x86_64, not %s", arch)
+	}
+
+	os, err := target.DetectOS(ctx, v.target)
 	if err != nil {
-		slog.Error("VTune: installing intel gpg key failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
-		return fmt.Errorf("installing intel gpg key failed: %w", err)
+		return err
+	}
+	switch os.PackageManager {
+	case target.Apt:
+		err = v.addAptRepo(ctx)
+	case target.Dnf:
+		err = v.addDnfRepo(ctx)
 	}
-	out, err = v.target.RunCommand("echo 'deb [signed-by=/usr/share/keyrings/oneapi-archive-keyring.gpg] https://apt.repos.intel.com/oneapi all main' | tee /etc/apt/sources.list.d/oneAPI.list")
 	if err != nil {
-		slog.Error("VTune: adding intel repo failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
-		return fmt.Errorf("adding intel repo failed: %w", err)
+		return err
 	}
-	out, err = v.target.RunCommand("apt update -y && apt install -y intel-oneapi-vtune")
+	out, err := v.target.RunCommand(ctx, os.PackageManager.InstallCommand("intel-oneapi-vtune"))
 	if err != nil {
 		slog.Error("VTune: installing vtune failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
 		return fmt.Errorf("installing vtune failed: %w", err)
 	}
 
 	// Not sure if the sampling drivers are needed but this would do it
-	// out, err = v.target.RunCommand("cd /opt/intel/oneapi/vtune/latest/sepdk/src && ./build-driver -ni && ./insmod-sep -r -g root")
+	// out, err = v.target.RunCommand(ctx, "cd /opt/intel/oneapi/vtune/latest/sepdk/src && ./build-driver -ni && ./insmod-sep -r -g root")
 	// if err != nil {
 	// 	slog.Error("VTune: installing sampling drivers failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
 	// 	return fmt.Errorf("installing sampling drivers failed: %w", err)
@@ -55,18 +62,48 @@ func (v *vtune) SetUp() error {
 	return nil
 }
 
-func (v *vtune) ProfileCommand(cmd string) (string, error) {
+func (v *vtune) addAptRepo(ctx context.Context) error {
+	out, err := v.target.RunCommand(ctx, target.Apt.InstallCommand("gpg-agent", "wget"))
+	if err != nil {
+		slog.Error("VTune: installing deps failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
+		return fmt.Errorf("installing deps failed: %w", err)
+	}
+	out, err = v.target.RunCommand(ctx, "wget -O- https://apt.repos.intel.com/intel-gpg-keys/GPG-PUB-KEY-INTEL-SW-PRODUCTS.PUB | gpg --dearmor | tee /usr/share/keyrings/oneapi-archive-keyring.gpg > /dev/null")
+	if err != nil {
+		slog.Error("VTune: installing intel gpg key failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
+		return fmt.Errorf("installing intel gpg key failed: %w", err)
+	}
+	out, err = v.target.RunCommand(ctx, "echo 'deb [signed-by=/usr/share/keyrings/oneapi-archive-keyring.gpg] https://apt.repos.intel.com/oneapi all main' | tee /etc/apt/sources.list.d/oneAPI.list")
+	if err != nil {
+		slog.Error("VTune: adding intel repo failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
+		return fmt.Errorf("adding intel repo failed: %w", err)
+	}
+	return nil
+}
+
+func (v *vtune) addDnfRepo(ctx context.Context) error {
+	out, err := v.target.RunCommand(ctx, "printf '%s\\n' '[oneAPI]' 'name=Intel oneAPI repository' 'baseurl=https://yum.repos.intel.com/oneapi' "+
+		"'enabled=1' 'gpgcheck=1' 'repo_gpgcheck=1' 'gpgkey=https://yum.repos.intel.com/intel-gpg-keys/GPG-PUB-KEY-INTEL-SW-PRODUCTS.PUB' "+
+		"> /etc/yum.repos.d/oneAPI.repo")
+	if err != nil {
+		slog.Error("VTune: adding intel repo failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
+		return fmt.Errorf("adding intel repo failed: %w", err)
+	}
+	return nil
+}
+
+func (v *vtune) ProfileCommand(ctx context.Context, cmd string) (string, error) {
 	cmd = strings.ReplaceAll(cmd, "\\", "\\\\")
 	cmd = strings.ReplaceAll(cmd, "\"", "\\\"")
 
 	resultDir := fmt.Sprintf("r%s", util.Randstring(8))
-	out, err := v.target.RunCommand(fmt.Sprintf("source /opt/intel/oneapi/vtune/latest/env/vars.sh && vtune -collect hotspots -knob sampling-mode=sw -knob enable-stack-collection=true -result-dir=%s -- %s", resultDir, cmd))
+	out, err := v.target.RunCommand(ctx, fmt.Sprintf("source /opt/intel/oneapi/vtune/latest/env/vars.sh && vtune -collect hotspots -knob sampling-mode=sw -knob enable-stack-collection=true -result-dir=%s -- %s", resultDir, cmd))
 	if err != nil {
 		slog.Error("VTune: reporting failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
 		return "", fmt.Errorf("collection failed: %w", err)
 	}
 	resultFile := fmt.Sprintf("/root/%s.tar.xz", resultDir)
-	out, err = v.target.RunCommand(fmt.Sprintf("tar -czf %s %s", resultFile, resultDir))
+	out, err = v.target.RunCommand(ctx, fmt.Sprintf("tar -czf %s %s", resultFile, resultDir))
 	if err != nil {
 		slog.Error("VTune: compressing result dir failed", slog.String("command output", string(out)), slog.String("error", err.Error()))
 		return "", fmt.Errorf("compressing result dir failed: %w", err)
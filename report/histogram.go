@@ -0,0 +1,128 @@
+package report
+
+import (
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// Each power of two is split into this many linear sub-buckets, bounding the relative error of any recorded value
+// to 1/64 (about 1.6%).
+const subBucketBits = 7
+const subBucketHalf = 1 << (subBucketBits - 1)
+
+// A log-linear histogram in the style of HdrHistogram. Memory is bounded by the range of recorded values, not by the
+// number of values, so it can absorb millions of requests. Values are non-negative integers; use a unit such as
+// microseconds for latencies.
+type Histogram struct {
+	counts map[int]int64
+	count  int64
+	min    int64
+	max    int64
+	sum    float64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{counts: map[int]int64{}, min: math.MaxInt64}
+}
+
+func bucketIndex(v int64) int {
+	if v < 2*subBucketHalf {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits
+	return shift*subBucketHalf + int(v>>shift)
+}
+
+// The midpoint of the values which fall into the bucket.
+func bucketValue(idx int) int64 {
+	if idx < 2*subBucketHalf {
+		return int64(idx)
+	}
+	shift := idx/subBucketHalf - 1
+	m := int64(idx - shift*subBucketHalf)
+	return m<<shift + (int64(1)<<shift)/2
+}
+
+func (h *Histogram) Record(v int64) {
+	v = max(v, 0)
+	h.counts[bucketIndex(v)]++
+	h.count++
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+	h.sum += float64(v)
+}
+
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// Returns the value at quantile q (0 <= q <= 1), or 0 if the histogram is empty.
+func (h *Histogram) ValueAtQuantile(q float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(h.count)))
+	target = min(max(target, 1), h.count)
+	// The extremes are known exactly, rather than to within a bucket
+	if target == 1 {
+		return h.min
+	}
+	if target == h.count {
+		return h.max
+	}
+
+	indices := make([]int, 0, len(h.counts))
+	for idx := range h.counts {
+		indices = append(indices, idx)
+	}
+	slices.Sort(indices)
+
+	var seen int64
+	for _, idx := range indices {
+		seen += h.counts[idx]
+		if seen >= target {
+			return min(max(bucketValue(idx), h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// Summarizes a histogram whose values were recorded in microseconds.
+func (h *Histogram) SummarizeMicros() *LatencySummary {
+	if h.count == 0 {
+		return &LatencySummary{}
+	}
+	sec := func(v int64) float64 { return float64(v) / 1e6 }
+	return &LatencySummary{
+		Count:   h.count,
+		MinSec:  sec(h.min),
+		MeanSec: h.sum / float64(h.count) / 1e6,
+		P50Sec:  sec(h.ValueAtQuantile(0.5)),
+		P90Sec:  sec(h.ValueAtQuantile(0.9)),
+		P99Sec:  sec(h.ValueAtQuantile(0.99)),
+		P999Sec: sec(h.ValueAtQuantile(0.999)),
+		MaxSec:  sec(h.max),
+	}
+}
+
+type LatencySummary struct {
+	Count   int64
+	MinSec  float64
+	MeanSec float64
+	P50Sec  float64
+	P90Sec  float64
+	P99Sec  float64
+	P999Sec float64
+	MaxSec  float64
+}
+
+// Per-request statistics aggregated over every repetition of a benchmark.
+type RequestLatency struct {
+	Requests     int64
+	Retries      int64
+	Bytes        int64
+	StatusCounts map[int]int64 // HTTP status code -> number of requests
+	TTFB         *LatencySummary
+	Duration     *LatencySummary
+}
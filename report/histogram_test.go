@@ -0,0 +1,91 @@
+package report
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestBucketRoundTrip(t *testing.T) {
+	values := []int64{0, 1, 127, 128, 129, 255, 256, 1000, 65_535, 1_000_000, math.MaxInt64 / 2}
+	for i := range 1000 {
+		values = append(values, rand.Int63n(int64(1)<<(i%62+1)))
+	}
+	for _, v := range values {
+		got := bucketValue(bucketIndex(v))
+		if v < 2*subBucketHalf && got != v {
+			t.Errorf("small value %d is stored as %d, want it exactly", v, got)
+		}
+		if relErr := math.Abs(float64(got-v)) / float64(max(v, 1)); relErr > 1.0/64 {
+			t.Errorf("%d is stored as %d, a relative error of %g", v, got, relErr)
+		}
+	}
+
+	// Indices increase with the value so quantiles can walk them in order
+	for v := int64(1); v < 1<<20; v++ {
+		if bucketIndex(v) < bucketIndex(v-1) {
+			t.Fatalf("bucketIndex(%d) = %d is less than bucketIndex(%d) = %d", v, bucketIndex(v), v-1, bucketIndex(v-1))
+		}
+	}
+}
+
+func TestHistogramQuantiles(t *testing.T) {
+	h := NewHistogram()
+	if h.ValueAtQuantile(0.5) != 0 || h.Count() != 0 {
+		t.Errorf("an empty histogram has a median of %d and a count of %d", h.ValueAtQuantile(0.5), h.Count())
+	}
+	if s := h.SummarizeMicros(); *s != (LatencySummary{}) {
+		t.Errorf("an empty histogram summarizes to %+v", s)
+	}
+
+	values := []int64{}
+	for v := int64(1); v <= 100_000; v++ {
+		values = append(values, v)
+	}
+	rand.Shuffle(len(values), func(i, j int) { values[i], values[j] = values[j], values[i] })
+	for _, v := range values {
+		h.Record(v)
+	}
+	h.Record(-5) // negative values are clamped to zero
+	values = append(values, 0)
+	slices.Sort(values)
+
+	if h.Count() != int64(len(values)) {
+		t.Errorf("count is %d, want %d", h.Count(), len(values))
+	}
+	for _, q := range []float64{0, 0.01, 0.5, 0.9, 0.99, 0.999, 1} {
+		want := values[max(int(math.Ceil(q*float64(len(values))))-1, 0)]
+		got := h.ValueAtQuantile(q)
+		if relErr := math.Abs(float64(got-want)) / float64(max(want, 1)); relErr > 1.0/64 {
+			t.Errorf("quantile %g is %d, want %d within 1/64", q, got, want)
+		}
+	}
+	if h.ValueAtQuantile(0) != 0 || h.ValueAtQuantile(1) != 100_000 {
+		t.Errorf("the extreme quantiles are %d and %d, want the exact min and max", h.ValueAtQuantile(0), h.ValueAtQuantile(1))
+	}
+}
+
+func TestSummarizeMicros(t *testing.T) {
+	h := NewHistogram()
+	for _, us := range []int64{1000, 2000, 3000, 4000, 90_000} {
+		h.Record(us)
+	}
+	s := h.SummarizeMicros()
+	want := LatencySummary{
+		Count:   5,
+		MinSec:  0.001,
+		MeanSec: 0.02,
+		P50Sec:  0.003,
+		P90Sec:  0.09,
+		P99Sec:  0.09,
+		P999Sec: 0.09,
+		MaxSec:  0.09,
+	}
+	near := func(got, want float64) bool { return math.Abs(got-want) <= want/64 }
+	if s.Count != want.Count || s.MinSec != want.MinSec || s.MaxSec != want.MaxSec || !near(s.MeanSec, want.MeanSec) ||
+		!near(s.P50Sec, want.P50Sec) || !near(s.P90Sec, want.P90Sec) || !near(s.P99Sec, want.P99Sec) ||
+		!near(s.P999Sec, want.P999Sec) {
+		t.Errorf("summary is %+v, want %+v", *s, want)
+	}
+}
@@ -1,64 +1,105 @@
 package report
 
 type Measurement[T any] struct {
-	Time  int64
+	Time  float64 // Unix seconds, with sub-second precision
 	Value T
 }
 
 type DeviceMeasurement[T any] struct {
-	DeviceName  string
+	DeviceName  string `json:",omitempty"` // empty for series which aren't per device
 	Measurement Measurement[T]
 }
 
+// Measurements of the target taken while a benchmark ran, keyed by series name (e.g. "cpu.user_pct"). See the system
+// monitor's collectors for the series each one records. Per-device series (e.g. "net.bytes_recv") hold one
+// measurement for each device in each sample.
 type SystemMeasurements struct {
-	CpuUsageUser      []Measurement[float64]
-	CpuUsageSystem    []Measurement[float64]
-	CpuUsageIdle      []Measurement[float64]
-	CpuUsageNice      []Measurement[float64]
-	CpuUsageIowait    []Measurement[float64]
-	CpuUsageIrq       []Measurement[float64]
-	CpuUsageSoftIrq   []Measurement[float64]
-	CpuUsageSteal     []Measurement[float64]
-	CpuUsageGuest     []Measurement[float64]
-	CpuUsageGuestNice []Measurement[float64]
+	Series map[string][]DeviceMeasurement[float64]
+}
+
+func (sm *SystemMeasurements) Append(name string, device string, m Measurement[float64]) {
+	if sm.Series == nil {
+		sm.Series = map[string][]DeviceMeasurement[float64]{}
+	}
+	sm.Series[name] = append(sm.Series[name], DeviceMeasurement[float64]{DeviceName: device, Measurement: m})
+}
 
-	MemTotalBytes  []Measurement[int]
-	MemUsedBytes   []Measurement[int]
-	MemUsedPct     []Measurement[float64]
-	MemAvailBytes  []Measurement[int]
-	MemAvailPct    []Measurement[float64]
-	SwapTotalBytes []Measurement[int]
-	SwapUsedBytes  []Measurement[int]
-	SwapUsedPct    []Measurement[float64]
+// Returns the measurements of a series which isn't per device.
+func (sm *SystemMeasurements) Measurements(name string) []Measurement[float64] {
+	out := []Measurement[float64]{}
+	for _, m := range sm.Series[name] {
+		out = append(out, m.Measurement)
+	}
+	return out
+}
+
+// The utilization of one core over a benchmark.
+type CoreUtilization struct {
+	Core           string // e.g. "cpu3"
+	MeanBusyPct    float64
+	MaxBusyPct     float64
+	MeanSoftIrqPct float64
+}
 
-	DiskReads            []DeviceMeasurement[int]
-	DiskReadsMerged      []DeviceMeasurement[int]
-	DiskReadBytes        []DeviceMeasurement[int]
-	DiskReadTimeMs       []DeviceMeasurement[int]
-	DiskWrites           []DeviceMeasurement[int]
-	DiskWritesMerged     []DeviceMeasurement[int]
-	DiskWriteBytes       []DeviceMeasurement[int]
-	DiskWriteTimeMs      []DeviceMeasurement[int]
-	DiskIOTimeMs         []DeviceMeasurement[int]
-	DiskWeightedIOTimeMs []DeviceMeasurement[int]
-	DiskFlushes          []DeviceMeasurement[int]
-	DiskFlushTimeMs      []DeviceMeasurement[int]
-	DiskIopsInProgress   []DeviceMeasurement[int]
+// Returns the core with the highest mean utilization, or nil if per-core utilization wasn't recorded.
+func (sm *SystemMeasurements) HottestCore() *CoreUtilization {
+	type stats struct {
+		sum   float64
+		max   float64
+		count int
+	}
+	busy := map[string]*stats{}
+	for _, m := range sm.Series["cpu.core_busy_pct"] {
+		st, ok := busy[m.DeviceName]
+		if !ok {
+			st = &stats{}
+			busy[m.DeviceName] = st
+		}
+		st.sum += m.Measurement.Value
+		st.max = max(st.max, m.Measurement.Value)
+		st.count++
+	}
 
-	NetBytesSent   []DeviceMeasurement[int]
-	NetBytesRecv   []DeviceMeasurement[int]
-	NetPacketsSent []DeviceMeasurement[int]
-	NetPacketsRecv []DeviceMeasurement[int]
+	var hottest *CoreUtilization
+	for core, st := range busy {
+		mean := st.sum / float64(st.count)
+		// Break ties by name so that the result doesn't depend on map order
+		if hottest == nil || mean > hottest.MeanBusyPct || mean == hottest.MeanBusyPct && core < hottest.Core {
+			hottest = &CoreUtilization{Core: core, MeanBusyPct: mean, MaxBusyPct: st.max}
+		}
+	}
+	if hottest == nil {
+		return nil
+	}
 
-	S3IPs      []Measurement[int]
-	S3Networks []Measurement[int]
+	sum := 0.0
+	count := 0
+	for _, m := range sm.Series["cpu.core_softirq_pct"] {
+		if m.DeviceName == hottest.Core {
+			sum += m.Measurement.Value
+			count++
+		}
+	}
+	if count > 0 {
+		hottest.MeanSoftIrqPct = sum / float64(count)
+	}
+	return hottest
 }
 
 type BenchmarkReport struct {
-	Name               string
-	Metadata           []any // one entry for each repetition
-	Input              map[string]any
-	Error              string    // non-empty iff the benchmark failed
-	TotalTimeSec       []float64 // one entry for each repetition
-	SystemMeasurements *SystemMeasurements
+	Name                         string
+	Metadata                     []any // one entry for each repetition
+	Input                        map[string]any
+	Error                        string          // non-empty iff the benchmark failed
+	TotalTimeSec                 []float64       // one entry for each repetition
+	BytesTransferred             []int64         // one entry for each repetition
+	ObjectCount                  []int           // one entry for each repetition
+	RequestCount                 []int           // one entry for each repetition. zero if the benchmark doesn't count requests.
+	ThroughputGbps               []float64       // one entry for each repetition
+	BaselineThroughputGbps       float64         // the target's baseline network bandwidth. zero if unknown.
+	ThroughputFractionOfBaseline []float64       // one entry for each repetition. empty if the baseline is unknown.
+	CPUUserSec                   []float64       // one entry for each repetition. the user CPU time of the benchmark command's processes.
+	CPUSysSec                    []float64       // one entry for each repetition. the system CPU time of the benchmark command's processes.
+	Latency                      *RequestLatency `json:",omitempty"` // only set if the benchmark recorded its requests
+	SystemMeasurements           *SystemMeasurements
 }
@@ -0,0 +1,36 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Metadata keys which name the machine a benchmark ran on, in order of preference.
+// These match the metadata added by the EC2, static host, and Docker orchestrators.
+var targetNameKeys = []string{"InstanceType", "ContainerSize", "Host"}
+
+// Returns the name of the machine the benchmark ran on (e.g. the EC2 instance type), or an empty string if the
+// metadata doesn't say. Works for both in-memory reports and reports loaded from JSON.
+func (r *BenchmarkReport) TargetName() string {
+	for _, key := range targetNameKeys {
+		for _, meta := range r.Metadata {
+			fields, ok := meta.(map[string]any)
+			if !ok {
+				// Orchestrators add typed structs; round-trip them through JSON to read their fields
+				buf, err := json.Marshal(meta)
+				if err != nil {
+					continue
+				}
+				fields = map[string]any{}
+				err = json.Unmarshal(buf, &fields)
+				if err != nil {
+					continue
+				}
+			}
+			if value, ok := fields[key]; ok && value != nil && value != "" {
+				return fmt.Sprint(value)
+			}
+		}
+	}
+	return ""
+}
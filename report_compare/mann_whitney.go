@@ -0,0 +1,119 @@
+package reportcompare
+
+import (
+	"math"
+	"slices"
+)
+
+// Samples at least this large (in total) use the normal approximation instead of the exact distribution of U.
+const exactMaxSamples = 30
+
+// Returns the two-sided p-value of the Mann-Whitney U test for whether a and b come from the same distribution.
+// Returns 1 if either sample is empty.
+func mannWhitneyPValue(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type sample struct {
+		value float64
+		fromA bool
+	}
+	all := make([]sample, 0, n1+n2)
+	for _, v := range a {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range b {
+		all = append(all, sample{v, false})
+	}
+	slices.SortFunc(all, func(x, y sample) int {
+		switch {
+		case x.value < y.value:
+			return -1
+		case x.value > y.value:
+			return 1
+		}
+		return 0
+	})
+
+	// Assign average ranks to ties and accumulate the tie correction term
+	rankSumA := 0.0
+	tieTerm := 0.0
+	hasTies := false
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // ranks are 1-based
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankSumA += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			hasTies = true
+			tieTerm += t*t*t - t
+		}
+		i = j
+	}
+
+	u := rankSumA - float64(n1*(n1+1))/2
+	if !hasTies && n1+n2 < exactMaxSamples {
+		return exactPValue(u, n1, n2)
+	}
+
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	// Continuity correction
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// Computes the two-sided p-value of U from its exact distribution under the null hypothesis.
+func exactPValue(u float64, n1, n2 int) float64 {
+	// counts[i][j][k] would be the number of orderings of i a's and j b's with U = k; only two rows are needed at once
+	maxU := n1 * n2
+	prev := make([][]float64, n2+1)
+	for j := range prev {
+		prev[j] = make([]float64, maxU+1)
+		prev[j][0] = 1 // zero a's always gives U = 0
+	}
+	for i := 1; i <= n1; i++ {
+		curr := make([][]float64, n2+1)
+		curr[0] = make([]float64, maxU+1)
+		curr[0][0] = 1
+		for j := 1; j <= n2; j++ {
+			curr[j] = make([]float64, maxU+1)
+			for k := 0; k <= i*j; k++ {
+				// The largest element is either an a, which beats all j b's, or a b, which beats nothing
+				if k >= j {
+					curr[j][k] += prev[j][k-j]
+				}
+				curr[j][k] += curr[j-1][k]
+			}
+		}
+		prev = curr
+	}
+
+	dist := prev[n2]
+	total := 0.0
+	for _, c := range dist {
+		total += c
+	}
+	// The distribution is symmetric about n1*n2/2, so take the smaller tail and double it
+	lo := min(u, float64(maxU)-u)
+	tail := 0.0
+	for k := 0; float64(k) <= lo; k++ {
+		tail += dist[k]
+	}
+	return math.Min(1, 2*tail/total)
+}
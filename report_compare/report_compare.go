@@ -0,0 +1,189 @@
+package reportcompare
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	benchmarkorchestrator "github.com/Octogonapus/S3Benchmark/benchmark_orchestrator"
+	"github.com/Octogonapus/S3Benchmark/report"
+)
+
+type Status string
+
+const (
+	StatusUnchanged        Status = "unchanged"
+	StatusImproved         Status = "improved"
+	StatusRegressed        Status = "REGRESSED"
+	StatusInconclusive     Status = "inconclusive" // the change exceeds the threshold but isn't significant
+	StatusFailed           Status = "FAILED"       // the candidate failed but the baseline didn't
+	StatusFixed            Status = "fixed"        // the baseline failed but the candidate didn't
+	StatusMissingBaseline  Status = "missing in baseline"
+	StatusMissingCandidate Status = "missing in candidate"
+)
+
+type CompareInput struct {
+	RegressionThresholdPct float64 // a throughput drop larger than this is a regression, if it is significant
+	Alpha                  float64 // the significance level of the Mann-Whitney U test
+}
+
+type Comparison struct {
+	Name          string
+	Target        string
+	BaselineGbps  float64 // median over repetitions. see throughputs.
+	CandidateGbps float64 // median over repetitions. see throughputs.
+	Relative      bool    // BaselineGbps and CandidateGbps are 1/TotalTimeSec rather than Gbps. see throughputs.
+	DeltaPct      float64
+	PValue        float64
+	Status        Status
+}
+
+type reportKey struct{ name, target string }
+
+// Matches the benchmarks in two reports by name and target and compares their throughput. Returns an error if either
+// report has more than one benchmark with the same name and target, since they can't be matched.
+func Compare(baseline, candidate *benchmarkorchestrator.Report, input *CompareInput) ([]*Comparison, error) {
+	baseReports, err := reportsByKey(baseline)
+	if err != nil {
+		return nil, fmt.Errorf("baseline: %w", err)
+	}
+	candReports, err := reportsByKey(candidate)
+	if err != nil {
+		return nil, fmt.Errorf("candidate: %w", err)
+	}
+
+	out := []*Comparison{}
+	for k, base := range baseReports {
+		c := &Comparison{Name: k.name, Target: k.target}
+		out = append(out, c)
+
+		cand, ok := candReports[k]
+		if !ok {
+			c.Status = StatusMissingCandidate
+			continue
+		}
+		if cand.Error != "" && base.Error == "" {
+			c.Status = StatusFailed
+			continue
+		}
+		if base.Error != "" && cand.Error == "" {
+			c.Status = StatusFixed
+			continue
+		}
+		baseThroughputs, candThroughputs, relative := throughputs(base, cand)
+		c.Relative = relative
+		compare(c, baseThroughputs, candThroughputs, input)
+	}
+	for k := range candReports {
+		if _, ok := baseReports[k]; !ok {
+			out = append(out, &Comparison{Name: k.name, Target: k.target, Status: StatusMissingBaseline})
+		}
+	}
+
+	slices.SortFunc(out, func(a, b *Comparison) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Target, b.Target)
+	})
+	return out, nil
+}
+
+func reportsByKey(rep *benchmarkorchestrator.Report) (map[reportKey]*report.BenchmarkReport, error) {
+	out := map[reportKey]*report.BenchmarkReport{}
+	for _, r := range rep.Reports {
+		k := reportKey{r.Name, r.TargetName()}
+		if _, ok := out[k]; ok {
+			return nil, fmt.Errorf("more than one benchmark is named %q on target %q", k.name, k.target)
+		}
+		out[k] = r
+	}
+	return out, nil
+}
+
+func compare(c *Comparison, base, cand []float64, input *CompareInput) {
+	c.BaselineGbps = median(base)
+	c.CandidateGbps = median(cand)
+	c.PValue = mannWhitneyPValue(base, cand)
+	if c.BaselineGbps > 0 {
+		c.DeltaPct = 100 * (c.CandidateGbps/c.BaselineGbps - 1)
+	}
+
+	significant := c.PValue < input.Alpha
+	switch {
+	case -c.DeltaPct > input.RegressionThresholdPct && significant:
+		c.Status = StatusRegressed
+	case -c.DeltaPct > input.RegressionThresholdPct:
+		c.Status = StatusInconclusive
+	case c.DeltaPct > input.RegressionThresholdPct && significant:
+		c.Status = StatusImproved
+	default:
+		c.Status = StatusUnchanged
+	}
+}
+
+// Returns the throughput of each repetition of the baseline and the candidate, in the same metric. Reports from before
+// throughput was recorded only have TotalTimeSec. Unless both reports have ThroughputGbps, the throughput of both is
+// relative (1/TotalTimeSec), which is still comparable when both reports used the same objects.
+func throughputs(base, cand *report.BenchmarkReport) ([]float64, []float64, bool) {
+	if hasThroughput(base) && hasThroughput(cand) {
+		return base.ThroughputGbps, cand.ThroughputGbps, false
+	}
+	return relativeThroughputs(base), relativeThroughputs(cand), true
+}
+
+func hasThroughput(r *report.BenchmarkReport) bool {
+	return len(r.ThroughputGbps) == len(r.TotalTimeSec) && slices.ContainsFunc(r.ThroughputGbps, func(v float64) bool { return v > 0 })
+}
+
+func relativeThroughputs(r *report.BenchmarkReport) []float64 {
+	out := []float64{}
+	for _, t := range r.TotalTimeSec {
+		if t > 0 {
+			out = append(out, 1/t)
+		}
+	}
+	return out
+}
+
+func median(vs []float64) float64 {
+	if len(vs) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(vs)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Returns true if any comparison is a regression or a new failure.
+func HasRegression(comparisons []*Comparison) bool {
+	return slices.ContainsFunc(comparisons, func(c *Comparison) bool {
+		return c.Status == StatusRegressed || c.Status == StatusFailed
+	})
+}
+
+// Prints the comparisons as a table.
+func WriteTable(w io.Writer, comparisons []*Comparison) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BENCHMARK\tTARGET\tBASELINE\tCANDIDATE\tDELTA\tP-VALUE\tSTATUS")
+	for _, c := range comparisons {
+		switch c.Status {
+		case StatusMissingBaseline, StatusMissingCandidate, StatusFailed, StatusFixed:
+			fmt.Fprintf(tw, "%s\t%s\t\t\t\t\t%s\n", c.Name, c.Target, c.Status)
+			continue
+		}
+		status := string(c.Status)
+		if c.Relative {
+			status += " (relative, 1/TotalTimeSec)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.3f\t%.3f\t%+.1f%%\t%.3f\t%s\n",
+			c.Name, c.Target, c.BaselineGbps, c.CandidateGbps, c.DeltaPct, c.PValue, status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,171 @@
+package reportcompare
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	benchmarkorchestrator "github.com/Octogonapus/S3Benchmark/benchmark_orchestrator"
+	"github.com/Octogonapus/S3Benchmark/report"
+)
+
+func TestMannWhitneyPValue(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		// Exact distribution. The p-values are those of R's wilcox.test(a, b, exact = TRUE).
+		{"exact separated 3x3", []float64{1, 2, 3}, []float64{4, 5, 6}, 2.0 / 20},
+		{"exact separated 5x5", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{"exact interleaved 3x3", []float64{1, 3, 5}, []float64{2, 4, 6}, 14.0 / 20},
+		{"exact reversed", []float64{4, 5, 6}, []float64{1, 2, 3}, 2.0 / 20},
+		{"exact unequal sizes", []float64{1, 2}, []float64{3, 4, 5, 6}, 2.0 / 15},
+		// Normal approximation with continuity correction. The p-values are those of R's
+		// wilcox.test(a, b, exact = FALSE, correct = TRUE).
+		{"normal separated 15x15", seq(1, 15), seq(16, 30), 3.391821e-06},
+		{"normal with ties", []float64{1, 2, 2, 3}, []float64{2, 3, 3, 4}, 0.1720},
+		{"normal identical", []float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+		{"empty", nil, []float64{1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mannWhitneyPValue(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 1e-3*tt.want {
+				t.Errorf("p-value is %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func seq(from, to int) []float64 {
+	out := []float64{}
+	for i := from; i <= to; i++ {
+		out = append(out, float64(i))
+	}
+	return out
+}
+
+func benchmarkReport(name string, throughputs ...float64) *report.BenchmarkReport {
+	r := &report.BenchmarkReport{
+		Name:     name,
+		Metadata: []any{map[string]any{"InstanceType": "c7gn.large"}},
+	}
+	for _, tp := range throughputs {
+		r.ThroughputGbps = append(r.ThroughputGbps, tp)
+		r.TotalTimeSec = append(r.TotalTimeSec, 100/tp)
+	}
+	return r
+}
+
+func failedReport(name string) *report.BenchmarkReport {
+	r := benchmarkReport(name)
+	r.Error = "exit status 1"
+	return r
+}
+
+// Only has TotalTimeSec, like reports from before throughput was recorded.
+func timedReport(name string, totalTimes ...float64) *report.BenchmarkReport {
+	r := benchmarkReport(name)
+	r.TotalTimeSec = totalTimes
+	return r
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &benchmarkorchestrator.Report{Reports: []*report.BenchmarkReport{
+		benchmarkReport("unchanged", 10, 10.1, 9.9, 10.2, 9.8),
+		benchmarkReport("improved", 10, 10.1, 9.9, 10.2, 9.8),
+		benchmarkReport("regressed", 10, 10.1, 9.9, 10.2, 9.8),
+		benchmarkReport("inconclusive", 10, 10.1),
+		benchmarkReport("failed", 10, 10.1, 9.9),
+		failedReport("fixed"),
+		timedReport("relative", 10, 10.1, 9.9, 10.2, 9.8),
+		benchmarkReport("removed", 10),
+	}}
+	candidate := &benchmarkorchestrator.Report{Reports: []*report.BenchmarkReport{
+		benchmarkReport("unchanged", 10.05, 9.95, 10.15, 9.85, 10),
+		benchmarkReport("improved", 12, 12.1, 11.9, 12.2, 11.8),
+		benchmarkReport("regressed", 8, 8.1, 7.9, 8.2, 7.8),
+		benchmarkReport("inconclusive", 8, 8.1), // 2 repetitions each can't be significant at 5%
+		failedReport("failed"),
+		benchmarkReport("fixed", 10),
+		timedReport("relative", 20, 20.1, 19.9, 20.2, 19.8), // twice the time is half the throughput
+		benchmarkReport("added", 10),
+	}}
+	comparisons, err := Compare(baseline, candidate, &CompareInput{RegressionThresholdPct: 5, Alpha: 0.05})
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+
+	want := map[string]Status{
+		"unchanged":    StatusUnchanged,
+		"improved":     StatusImproved,
+		"regressed":    StatusRegressed,
+		"inconclusive": StatusInconclusive,
+		"failed":       StatusFailed,
+		"fixed":        StatusFixed,
+		"relative":     StatusRegressed,
+		"removed":      StatusMissingCandidate,
+		"added":        StatusMissingBaseline,
+	}
+	if len(comparisons) != len(want) {
+		t.Fatalf("Compare returned %d comparisons, want %d", len(comparisons), len(want))
+	}
+	for i, c := range comparisons {
+		if i > 0 && comparisons[i-1].Name > c.Name {
+			t.Errorf("comparisons aren't sorted by name: %s before %s", comparisons[i-1].Name, c.Name)
+		}
+		if c.Target != "c7gn.large" {
+			t.Errorf("%s: target is %q", c.Name, c.Target)
+		}
+		if c.Status != want[c.Name] {
+			t.Errorf("%s: status is %s, want %s", c.Name, c.Status, want[c.Name])
+		}
+		if c.Relative != (c.Name == "relative") {
+			t.Errorf("%s: relative is %t", c.Name, c.Relative)
+		}
+		if c.Name == "regressed" && math.Abs(c.DeltaPct-(-20)) > 1e-9 {
+			t.Errorf("regressed: delta is %g%%, want -20%%", c.DeltaPct)
+		}
+		if c.Name == "relative" && math.Abs(c.DeltaPct-(-50)) > 1e-9 {
+			t.Errorf("relative: delta is %g%%, want -50%%", c.DeltaPct)
+		}
+	}
+	if !HasRegression(comparisons) {
+		t.Errorf("HasRegression returned false")
+	}
+
+	out := &bytes.Buffer{}
+	if err := WriteTable(out, comparisons); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"REGRESSED", "FAILED", "fixed", "missing in baseline", "(relative, 1/TotalTimeSec)"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("the table doesn't contain %q:\n%s", s, out)
+		}
+	}
+}
+
+func TestCompareNoRegression(t *testing.T) {
+	baseline := &benchmarkorchestrator.Report{Reports: []*report.BenchmarkReport{failedReport("a")}}
+	candidate := &benchmarkorchestrator.Report{Reports: []*report.BenchmarkReport{benchmarkReport("a", 10)}}
+	comparisons, err := Compare(baseline, candidate, &CompareInput{RegressionThresholdPct: 5, Alpha: 0.05})
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if HasRegression(comparisons) {
+		t.Errorf("a fixed benchmark is a regression")
+	}
+}
+
+func TestCompareDuplicates(t *testing.T) {
+	dup := &benchmarkorchestrator.Report{Reports: []*report.BenchmarkReport{benchmarkReport("a", 1), benchmarkReport("a", 2)}}
+	ok := &benchmarkorchestrator.Report{Reports: []*report.BenchmarkReport{benchmarkReport("a", 1)}}
+	if _, err := Compare(dup, ok, &CompareInput{}); err == nil || !strings.Contains(err.Error(), "baseline") {
+		t.Errorf("Compare returned %v, want an error about the baseline", err)
+	}
+	if _, err := Compare(ok, dup, &CompareInput{}); err == nil || !strings.Contains(err.Error(), "candidate") {
+		t.Errorf("Compare returned %v, want an error about the candidate", err)
+	}
+}
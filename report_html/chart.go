@@ -0,0 +1,116 @@
+package reporthtml
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+)
+
+const (
+	chartWidth        = 720
+	chartHeight       = 240
+	chartMarginLeft   = 56
+	chartMarginRight  = 16
+	chartMarginTop    = 16
+	chartMarginBottom = 36
+	chartTicks        = 5
+)
+
+// Colors for successive series, chosen to be distinguishable when printed.
+var chartColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf"}
+
+type point struct {
+	X float64 // seconds since the start of the benchmark
+	Y float64
+}
+
+type series struct {
+	Name   string
+	Points []point
+}
+
+type chart struct {
+	Title  string
+	YLabel string
+	Series []series
+}
+
+// Renders the chart as an inline SVG element. Returns an empty string if there is nothing to plot.
+func (c *chart) svg() template.HTML {
+	maxX, maxY := 0.0, 0.0
+	empty := true
+	for _, s := range c.Series {
+		for _, p := range s.Points {
+			empty = false
+			maxX = math.Max(maxX, p.X)
+			maxY = math.Max(maxY, p.Y)
+		}
+	}
+	if empty {
+		return ""
+	}
+	maxX = niceCeil(maxX)
+	maxY = niceCeil(maxY)
+
+	plotWidth := float64(chartWidth - chartMarginLeft - chartMarginRight)
+	plotHeight := float64(chartHeight - chartMarginTop - chartMarginBottom)
+	px := func(x float64) float64 { return chartMarginLeft + x/maxX*plotWidth }
+	py := func(y float64) float64 { return chartMarginTop + plotHeight - y/maxY*plotHeight }
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+
+	// Grid and axis labels
+	for i := 0; i <= chartTicks; i++ {
+		y := maxY * float64(i) / chartTicks
+		fmt.Fprintf(sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`, px(0), py(y), px(maxX), py(y))
+		fmt.Fprintf(sb, `<text x="%.1f" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`, px(0)-4, py(y), formatTick(y))
+		x := maxX * float64(i) / chartTicks
+		fmt.Fprintf(sb, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, px(x), py(0)+14, formatTick(x))
+	}
+	fmt.Fprintf(sb, `<text x="%.1f" y="%d" text-anchor="middle">time (s)</text>`, px(maxX/2), chartHeight-4)
+	fmt.Fprintf(sb, `<text transform="translate(12 %.1f) rotate(-90)" text-anchor="middle">%s</text>`, py(maxY/2), html.EscapeString(c.YLabel))
+	fmt.Fprintf(sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="none" stroke="#888"/>`, px(0), py(maxY), plotWidth, plotHeight)
+
+	for i, s := range c.Series {
+		color := chartColors[i%len(chartColors)]
+		points := make([]string, 0, len(s.Points))
+		for _, p := range s.Points {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", px(p.X), py(p.Y)))
+		}
+		fmt.Fprintf(sb, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, color, strings.Join(points, " "))
+
+		// Legend in the top right corner of the plot
+		ly := float64(chartMarginTop + 12 + 14*i)
+		lx := float64(chartWidth - chartMarginRight - 150)
+		fmt.Fprintf(sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="3"/>`, lx, ly, lx+16, ly, color)
+		fmt.Fprintf(sb, `<text x="%.1f" y="%.1f" dominant-baseline="middle">%s</text>`, lx+20, ly, html.EscapeString(s.Name))
+	}
+
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
+
+// Rounds v up to 1, 2, or 5 times a power of ten so that axis ticks land on readable values.
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*exp {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+func formatTick(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2g", v)
+}
@@ -0,0 +1,320 @@
+package reporthtml
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"slices"
+	"strings"
+
+	benchmarkorchestrator "github.com/Octogonapus/S3Benchmark/benchmark_orchestrator"
+	"github.com/Octogonapus/S3Benchmark/report"
+)
+
+//go:embed report.html.tmpl
+var reportTemplateText string
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"f1": func(v float64) string { return fmt.Sprintf("%.1f", v) },
+	"f2": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+}).Parse(reportTemplateText))
+
+type summaryRow struct {
+	Name          string
+	Target        string
+	Runs          int
+	MeanTimeSec   float64
+	MeanGbps      float64
+	MaxGbps       float64
+	BaselineGbps  float64 // zero if unknown
+	PctOfBaseline float64
+	GB            float64
+	Objects       int
+	Requests      int // zero if the benchmark doesn't count requests
+	HasLatency    bool
+	TTFBP50Ms     float64
+	TTFBP99Ms     float64
+	HotCore       *report.CoreUtilization // nil if per-core utilization wasn't recorded
+	CPUSecPerGB   float64                 // the benchmark command's CPU time per GB transferred. zero if unknown.
+	Error         string
+}
+
+type renderedChart struct {
+	Title string
+	SVG   template.HTML
+}
+
+type benchmarkSection struct {
+	Title  string
+	Charts []renderedChart
+}
+
+type page struct {
+	Config     *benchmarkorchestrator.BenchmarkConfig
+	WarmUp     *benchmarkorchestrator.WarmUpReport
+	ObjectsGB  float64
+	Rows       []summaryRow
+	Benchmarks []benchmarkSection
+}
+
+// Writes a self-contained HTML page summarizing the report, with charts of the system measurements of each benchmark.
+func Render(w io.Writer, rep *benchmarkorchestrator.Report) error {
+	reports := slices.Clone(rep.Reports)
+	slices.SortStableFunc(reports, func(a, b *report.BenchmarkReport) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.TargetName(), b.TargetName())
+	})
+
+	p := page{Config: rep.Config, WarmUp: rep.WarmUp}
+	if rep.Config != nil {
+		for _, spec := range rep.Config.ObjectSpecs {
+			p.ObjectsGB += float64(spec.SizeBytes) / 1e9
+		}
+	}
+
+	for _, r := range reports {
+		p.Rows = append(p.Rows, summarize(r))
+
+		title := r.Name
+		if target := r.TargetName(); target != "" {
+			title += " on " + target
+		}
+		section := benchmarkSection{Title: title}
+		if r.SystemMeasurements != nil {
+			for _, c := range systemCharts(r.SystemMeasurements) {
+				if svg := c.svg(); svg != "" {
+					section.Charts = append(section.Charts, renderedChart{Title: c.Title, SVG: svg})
+				}
+			}
+		}
+		p.Benchmarks = append(p.Benchmarks, section)
+	}
+
+	err := reportTemplate.Execute(w, &p)
+	if err != nil {
+		return fmt.Errorf("rendering report failed: %w", err)
+	}
+	return nil
+}
+
+func summarize(r *report.BenchmarkReport) summaryRow {
+	row := summaryRow{
+		Name:         r.Name,
+		Target:       r.TargetName(),
+		Runs:         len(r.TotalTimeSec),
+		MeanTimeSec:  mean(r.TotalTimeSec),
+		MeanGbps:     mean(r.ThroughputGbps),
+		BaselineGbps: r.BaselineThroughputGbps,
+		Error:        r.Error,
+	}
+	if len(r.ThroughputGbps) > 0 {
+		row.MaxGbps = slices.Max(r.ThroughputGbps)
+	}
+	if row.BaselineGbps > 0 {
+		row.PctOfBaseline = 100 * row.MeanGbps / row.BaselineGbps
+	}
+	for _, b := range r.BytesTransferred {
+		row.GB += float64(b) / 1e9
+	}
+	for _, n := range r.ObjectCount {
+		row.Objects += n
+	}
+	for _, n := range r.RequestCount {
+		row.Requests += n
+	}
+	if r.SystemMeasurements != nil {
+		row.HotCore = r.SystemMeasurements.HottestCore()
+	}
+	if len(r.CPUUserSec) == len(r.BytesTransferred) && row.GB > 0 {
+		cpuSec := 0.0
+		for i := range r.CPUUserSec {
+			cpuSec += r.CPUUserSec[i] + r.CPUSysSec[i]
+		}
+		row.CPUSecPerGB = cpuSec / row.GB
+	}
+	if r.Latency != nil {
+		row.HasLatency = true
+		row.TTFBP50Ms = r.Latency.TTFB.P50Sec * 1000
+		row.TTFBP99Ms = r.Latency.TTFB.P99Sec * 1000
+	}
+	return row
+}
+
+func mean(vs []float64) float64 {
+	if len(vs) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range vs {
+		sum += v
+	}
+	return sum / float64(len(vs))
+}
+
+func systemCharts(sm *report.SystemMeasurements) []*chart {
+	start := startTime(sm)
+
+	busy := series{Name: "busy"}
+	for _, m := range sm.Measurements("cpu.idle_pct") {
+		busy.Points = append(busy.Points, point{X: m.Time - start, Y: 100 - m.Value})
+	}
+	cpu := &chart{
+		Title:  "CPU usage",
+		YLabel: "%",
+		Series: []series{
+			busy,
+			measurementSeries("user", sm.Measurements("cpu.user_pct"), start),
+			measurementSeries("system", sm.Measurements("cpu.system_pct"), start),
+			measurementSeries("softirq", sm.Measurements("cpu.softirq_pct"), start),
+			measurementSeries("iowait", sm.Measurements("cpu.iowait_pct"), start),
+		},
+	}
+
+	nic := &chart{Title: "NIC receive rate", YLabel: "Gbps", Series: recvRateSeries(sm.Series["net.bytes_recv"], start)}
+
+	ips := &chart{
+		Title:  "Unique S3 IPs",
+		YLabel: "IPs",
+		Series: []series{
+			measurementSeries("S3 IPs", sm.Measurements("s3.ips"), start),
+			measurementSeries("returned by DNS", sm.Measurements("dns.s3_ips_returned"), start),
+		},
+	}
+
+	perIP := &chart{Title: "Receive rate per S3 IP", YLabel: "Gbps", Series: recvRateSeries(sm.Series["s3.bytes_recv"], start)}
+
+	retrans := &chart{
+		Title:  "TCP retransmits",
+		YLabel: "segments/s",
+		Series: []series{
+			rateSeries("retransmitted", sm.Measurements("tcp.retrans_segs"), start, 1),
+			rateSeries("RTO timeouts", sm.Measurements("tcp.rto_timeouts"), start, 1),
+		},
+	}
+
+	allowance := &chart{
+		Title:  "Network allowance exceeded",
+		YLabel: "packets/s",
+		Series: []series{
+			rateSeries("bandwidth in", sumDevices(sm.Series["ena.bw_in_allowance_exceeded"]), start, 1),
+			rateSeries("bandwidth out", sumDevices(sm.Series["ena.bw_out_allowance_exceeded"]), start, 1),
+			rateSeries("PPS", sumDevices(sm.Series["ena.pps_allowance_exceeded"]), start, 1),
+			rateSeries("conntrack", sumDevices(sm.Series["ena.conntrack_allowance_exceeded"]), start, 1),
+		},
+	}
+
+	hotCore := &chart{Title: "Hottest core", YLabel: "%"}
+	if hottest := sm.HottestCore(); hottest != nil {
+		hotCore.Title = "Hottest core (" + hottest.Core + ")"
+		hotCore.Series = []series{
+			measurementSeries("busy", deviceMeasurements(sm.Series["cpu.core_busy_pct"], hottest.Core), start),
+			measurementSeries("softirq", deviceMeasurements(sm.Series["cpu.core_softirq_pct"], hottest.Core), start),
+		}
+	}
+
+	process := &chart{
+		Title:  "Benchmark process CPU",
+		YLabel: "cores",
+		Series: []series{
+			rateSeries("user", sm.Measurements("proc.cpu_user_sec"), start, 1),
+			rateSeries("system", sm.Measurements("proc.cpu_sys_sec"), start, 1),
+		},
+	}
+
+	// Skip the charts of collectors which didn't run
+	charts := []*chart{}
+	for _, c := range []*chart{cpu, hotCore, process, nic, ips, perIP, retrans, allowance} {
+		if slices.ContainsFunc(c.Series, func(s series) bool { return len(s.Points) > 0 }) {
+			charts = append(charts, c)
+		}
+	}
+	return charts
+}
+
+func measurementSeries[T int | float64](name string, ms []report.Measurement[T], start float64) series {
+	s := series{Name: name}
+	for _, m := range ms {
+		s.Points = append(s.Points, point{X: m.Time - start, Y: float64(m.Value)})
+	}
+	return s
+}
+
+// Converts cumulative per-device byte counters into one rate series per device. The loopback device is skipped
+// because it never carries S3 traffic.
+func recvRateSeries(ms []report.DeviceMeasurement[float64], start float64) []series {
+	byDevice := map[string][]report.Measurement[float64]{}
+	devices := []string{}
+	for _, m := range ms {
+		if m.DeviceName == "lo" {
+			continue
+		}
+		if _, ok := byDevice[m.DeviceName]; !ok {
+			devices = append(devices, m.DeviceName)
+		}
+		byDevice[m.DeviceName] = append(byDevice[m.DeviceName], m.Measurement)
+	}
+	slices.Sort(devices)
+
+	out := []series{}
+	for _, device := range devices {
+		out = append(out, rateSeries(device, byDevice[device], start, 8/1e9))
+	}
+	return out
+}
+
+// Converts a cumulative counter into its rate per second, multiplied by scale.
+func rateSeries(name string, samples []report.Measurement[float64], start float64, scale float64) series {
+	s := series{Name: name}
+	for i := 1; i < len(samples); i++ {
+		dt := samples[i].Time - samples[i-1].Time
+		delta := samples[i].Value - samples[i-1].Value
+		if dt <= 0 || delta < 0 {
+			// Samples at the same time or a counter reset; there's no meaningful rate here
+			continue
+		}
+		s.Points = append(s.Points, point{X: samples[i].Time - start, Y: delta * scale / dt})
+	}
+	return s
+}
+
+// Returns the measurements of one device in a per-device series.
+func deviceMeasurements(ms []report.DeviceMeasurement[float64], device string) []report.Measurement[float64] {
+	out := []report.Measurement[float64]{}
+	for _, m := range ms {
+		if m.DeviceName == device {
+			out = append(out, m.Measurement)
+		}
+	}
+	return out
+}
+
+// Sums a per-device series over the devices at each time, e.g. the counters of every network interface.
+func sumDevices(ms []report.DeviceMeasurement[float64]) []report.Measurement[float64] {
+	out := []report.Measurement[float64]{}
+	for _, m := range ms {
+		if len(out) > 0 && out[len(out)-1].Time == m.Measurement.Time {
+			out[len(out)-1].Value += m.Measurement.Value
+		} else {
+			out = append(out, m.Measurement)
+		}
+	}
+	return out
+}
+
+// Returns the time of the earliest measurement so that charts start at zero.
+func startTime(sm *report.SystemMeasurements) float64 {
+	start := math.Inf(1)
+	for _, ms := range sm.Series {
+		for _, m := range ms {
+			start = min(start, m.Measurement.Time)
+		}
+	}
+	if math.IsInf(start, 1) {
+		return 0
+	}
+	return start
+}
@@ -0,0 +1,98 @@
+package systemmonitor
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+//go:embed agent/*
+var agentProject embed.FS
+
+// Where the agent is installed on targets, relative to the root user's home.
+const agentPath = "s3benchmark-agent"
+
+// A sample written by the agent. Mirrors Sample in agent/main.go.
+type agentSample struct {
+	Source int
+	Time   int64
+	Output string
+}
+
+var agentBuilds = map[target.Arch][]byte{}
+var agentBuildsMu sync.Mutex
+
+// Builds the agent for Linux on the architecture with the local Go toolchain. Each architecture is built once.
+func buildAgent(ctx context.Context, arch target.Arch) ([]byte, error) {
+	agentBuildsMu.Lock()
+	defer agentBuildsMu.Unlock()
+	if bin, ok := agentBuilds[arch]; ok {
+		return bin, nil
+	}
+
+	dir, err := os.MkdirTemp("", "s3benchmark-agent-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	entries, err := agentProject.ReadDir("agent")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		buf, err := agentProject.ReadFile(path.Join("agent", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(entry.Name(), ".txt") // go mod files must have .txt to allow embedding so remove it here
+		err = os.WriteFile(path.Join(dir, name), buf, 0o644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c := exec.CommandContext(ctx, "go", "build", "-trimpath", "-ldflags=-s -w", "-o", agentPath)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch.GoArch(), "CGO_ENABLED=0", "GOWORK=off", "GOFLAGS=")
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the monitoring agent: %w: %s", err, string(out))
+	}
+	bin, err := os.ReadFile(path.Join(dir, agentPath))
+	if err != nil {
+		return nil, err
+	}
+	agentBuilds[arch] = bin
+	return bin, nil
+}
+
+// Copies the agent built for the target's architecture to the target.
+func installAgent(ctx context.Context, t target.Target, arch target.Arch) error {
+	bin, err := buildAgent(ctx, arch)
+	if err != nil {
+		return err
+	}
+	err = t.CopyFileTo(bytes.NewReader(bin), agentPath)
+	if err != nil {
+		return fmt.Errorf("failed to copy the monitoring agent: %w", err)
+	}
+	out, err := t.RunCommand(ctx, "chmod +x "+agentPath)
+	if err != nil {
+		return fmt.Errorf("failed to make the monitoring agent executable: %w: %s", err, string(out))
+	}
+	return nil
+}
+
+// Quotes s for use as a single word in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
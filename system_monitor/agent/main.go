@@ -0,0 +1,180 @@
+// Samples the machine it runs on so that the system monitor doesn't have to poll it over SSH.
+//
+// Usage: s3benchmark-agent [-interval 1s] [-flush 1s] <command>...
+//
+//	s3benchmark-agent -proc <pid file>
+//	s3benchmark-agent -follow <path>
+//
+// Each command is a source which is sampled once per interval. Commands of the form "cat <path>..." are read directly
+// instead of starting a process, as are the agent's own -proc and -follow commands. Each sample is written to stdout as a line of
+// JSON. Samples are buffered and flushed once per flush interval. The agent exits when stdout is closed (i.e. when the
+// system monitor disconnects).
+//
+// With -proc, the agent prints the resource usage of the process tree rooted at the PID in the file once and exits.
+// With -follow, the agent prints the file and exits. As a source, -follow only outputs what was appended to the file
+// since the last sample.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+type Sample struct {
+	Source int    // the index of the source's command in the arguments
+	Time   int64  // when the sample was taken in Unix nanoseconds, measured with a monotonic clock
+	Output string // the file's contents or the command's stdout
+}
+
+type source struct {
+	command string
+	paths   []string // set if the command only reads these files
+	pidFile string   // set if the command is the agent's own -proc
+	follow  string   // set if the command is the agent's own -follow
+	file    *os.File // the followed file. nil until it exists.
+}
+
+func (s *source) sample() ([]byte, error) {
+	if s.follow != "" {
+		return s.readAppended()
+	}
+	if s.pidFile != "" {
+		buf := &bytes.Buffer{}
+		err := writeProcessTree(buf, s.pidFile)
+		return buf.Bytes(), err
+	}
+	if len(s.paths) == 0 {
+		return exec.Command("sh", "-c", s.command).Output()
+	}
+	out := []byte{}
+	for _, path := range s.paths {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, buf...)
+	}
+	return out, nil
+}
+
+// Returns what was appended to the followed file since the last call, or everything on the first call. Starts over
+// if the file was truncated.
+func (s *source) readAppended() ([]byte, error) {
+	if s.file == nil {
+		f, err := os.Open(s.follow)
+		if os.IsNotExist(err) {
+			return []byte{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		s.file = f
+	}
+	offset, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < offset {
+		_, err = s.file.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(s.file)
+}
+
+func parseSource(command string) *source {
+	if fields := strings.Fields(command); len(fields) == 3 && path.Base(fields[0]) == "s3benchmark-agent" {
+		switch fields[1] {
+		case "-proc":
+			return &source{command: command, pidFile: fields[2]}
+		case "-follow":
+			return &source{command: command, follow: fields[2]}
+		}
+	}
+	args, ok := strings.CutPrefix(command, "cat ")
+	if ok && !strings.ContainsAny(args, "'\"$`;&|<>*?\\") {
+		return &source{command: command, paths: strings.Fields(args)}
+	}
+	return &source{command: command}
+}
+
+func main() {
+	interval := flag.Duration("interval", time.Second, "How often each source is sampled.")
+	flush := flag.Duration("flush", time.Second, "How often buffered samples are written to stdout.")
+	pidFile := flag.String("proc", "", "Print the resource usage of the process tree rooted at the PID in this file and exit.")
+	follow := flag.String("follow", "", "Print this file and exit.")
+	flag.Parse()
+
+	if *follow != "" {
+		buf, err := (&source{follow: *follow}).readAppended()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(buf)
+		return
+	}
+
+	if *pidFile != "" {
+		err := writeProcessTree(os.Stdout, *pidFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	sources := []*source{}
+	for _, command := range flag.Args() {
+		sources = append(sources, parseSource(command))
+	}
+	if len(sources) == 0 || *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "usage: s3benchmark-agent [-interval 1s] [-flush 1s] <command>...")
+		os.Exit(2)
+	}
+
+	w := bufio.NewWriterSize(os.Stdout, 1<<20)
+	enc := json.NewEncoder(w)
+	// Timestamps are offsets from start on the monotonic clock so that they are evenly spaced even if the wall clock
+	// is adjusted while sampling
+	start := time.Now()
+	lastFlush := start
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		for i, src := range sources {
+			out, err := src.sample()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "sampling %q failed: %s\n", src.command, err)
+				continue
+			}
+			now := start.Add(time.Since(start))
+			err = enc.Encode(Sample{Source: i, Time: now.UnixNano(), Output: string(out)})
+			if err != nil {
+				os.Exit(1)
+			}
+		}
+
+		if time.Since(lastFlush) >= *flush {
+			err := w.Flush()
+			if err != nil {
+				// Nobody is listening anymore
+				os.Exit(0)
+			}
+			lastFlush = time.Now()
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Linux reports CPU time in clock ticks, which are 100 per second on every architecture we support.
+const ticksPerSecond = 100
+
+type processStat struct {
+	ppid    int
+	userSec float64 // including the children it has waited for
+	sysSec  float64 // including the children it has waited for
+	threads int
+}
+
+// Parses /proc/<pid>/stat. The command name is in parentheses and may contain spaces, so fields are counted from the
+// last parenthesis.
+func readProcessStat(pid int) (*processStat, error) {
+	buf, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	i := strings.LastIndexByte(string(buf), ')')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid stat for %d", pid)
+	}
+	// state ppid pgrp session tty_nr tpgid flags minflt cminflt majflt cmajflt utime stime cutime cstime priority nice
+	// num_threads ...
+	fields := strings.Fields(string(buf[i+1:]))
+	if len(fields) < 18 {
+		return nil, fmt.Errorf("invalid stat for %d", pid)
+	}
+	field := func(j int) float64 {
+		v, _ := strconv.ParseFloat(fields[j], 64)
+		return v
+	}
+	return &processStat{
+		ppid:    int(field(1)),
+		userSec: (field(11) + field(13)) / ticksPerSecond,
+		sysSec:  (field(12) + field(14)) / ticksPerSecond,
+		threads: int(field(17)),
+	}, nil
+}
+
+// Returns the values of the fields of a /proc status file, e.g. "VmRSS" or "voluntary_ctxt_switches". Sizes are in kB.
+func readStatus(path string) map[string]float64 {
+	status := map[string]float64{}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return status
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB"))
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			status[key] = v
+		}
+	}
+	return status
+}
+
+// Writes the resource usage of the process whose PID is in pidFile and all of its descendants, one "name value" per
+// line. Writes nothing if the process isn't running.
+func writeProcessTree(w io.Writer, pidFile string) error {
+	buf, err := os.ReadFile(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	root, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return fmt.Errorf("invalid pid file: %w", err)
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return err
+	}
+	stats := map[int]*processStat{}
+	children := map[int][]int{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := readProcessStat(pid)
+		if err != nil {
+			continue // it exited
+		}
+		stats[pid] = stat
+		children[stat.ppid] = append(children[stat.ppid], pid)
+	}
+	if _, ok := stats[root]; !ok {
+		return nil
+	}
+
+	processes := 0
+	userSec, sysSec := 0.0, 0.0
+	threads, fds := 0, 0
+	rssKB, hwmKB := 0.0, 0.0
+	voluntary, nonvoluntary := 0.0, 0.0
+	for queue := []int{root}; len(queue) > 0; queue = queue[1:] {
+		pid := queue[0]
+		queue = append(queue, children[pid]...)
+		stat := stats[pid]
+		processes++
+		userSec += stat.userSec
+		sysSec += stat.sysSec
+		threads += stat.threads
+
+		status := readStatus(fmt.Sprintf("/proc/%d/status", pid))
+		rssKB += status["VmRSS"]
+		hwmKB += status["VmHWM"]
+		// The process's status only counts the context switches of its main thread
+		tasks, _ := filepath.Glob(fmt.Sprintf("/proc/%d/task/*/status", pid))
+		for _, task := range tasks {
+			status := readStatus(task)
+			voluntary += status["voluntary_ctxt_switches"]
+			nonvoluntary += status["nonvoluntary_ctxt_switches"]
+		}
+		if open, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid)); err == nil {
+			fds += len(open)
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "processes %d\ncpu_user_sec %g\ncpu_sys_sec %g\nrss_bytes %.0f\nhwm_bytes %.0f\nthreads %d\nfds %d\n"+
+		"voluntary_ctxt_switches %.0f\nnonvoluntary_ctxt_switches %.0f\n",
+		processes, userSec, sysSec, rssKB*1024, hwmKB*1024, threads, fds, voluntary, nonvoluntary)
+	return err
+}
@@ -0,0 +1,88 @@
+package systemmonitor
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+// Collects one group of measurements by running a command on the target once per sample.
+type Collector interface {
+	Name() string
+
+	// Returns a command which installs what SampleCommand needs, or "" if nothing is needed.
+	SetUpCommand(pm target.PackageManager) string
+
+	SampleCommand() string
+
+	// Parses the output of SampleCommand, which finished at now, into samples of named series. Collectors may keep
+	// state between calls, e.g. to turn counters into rates.
+	Parse(now time.Time, out []byte) []Sample
+}
+
+// Implemented by collectors whose SetUpCommand changes the target in a way which must be undone when monitoring ends,
+// e.g. on hosts which outlive the benchmark.
+type TearDownCollector interface {
+	TearDownCommand() string
+}
+
+type Sample struct {
+	Series string // e.g. "cpu.user_pct"
+	Device string // e.g. a disk or network interface. empty if the series isn't per device.
+	Value  float64
+}
+
+// What collectors may need to know about the benchmark.
+type CollectorContext struct {
+	S3Prefixes       []netip.Prefix
+	BenchmarkPIDFile string // a file on the target holding the PID of the running benchmark command
+}
+
+type CollectorFactory func(*CollectorContext) Collector
+
+var allCollectors map[string]CollectorFactory
+
+// All collectors must register themselves at module load time so that they can be selected by name.
+func RegisterCollector(name string, factory CollectorFactory) {
+	if allCollectors == nil {
+		allCollectors = map[string]CollectorFactory{}
+	}
+	allCollectors[name] = factory
+}
+
+// The collectors used when none are selected.
+var DefaultCollectors = []string{"cpu", "cpu_cores", "memory", "disk", "network", "s3_ip", "tcp", "tcp_conn", "ena", "softirqs", "interrupts", "process"}
+
+func ExplainCollectors() string {
+	names := []string{}
+	for name := range allCollectors {
+		names = append(names, fmt.Sprintf("%q", name))
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+func newCollectors(names []string, cctx *CollectorContext) ([]Collector, error) {
+	if len(names) == 0 {
+		names = DefaultCollectors
+	}
+	collectors := []Collector{}
+	for _, name := range names {
+		factory, ok := allCollectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collector: %s. Must be one of: %s", name, ExplainCollectors())
+		}
+		collectors = append(collectors, factory(cctx))
+	}
+	return collectors, nil
+}
+
+// Returns an error if any of the names isn't a registered collector.
+func ValidateCollectors(names []string) error {
+	_, err := newCollectors(names, &CollectorContext{})
+	return err
+}
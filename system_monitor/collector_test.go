@@ -0,0 +1,212 @@
+package systemmonitor
+
+import (
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testS3Prefixes = []netip.Prefix{netip.MustParsePrefix("52.216.0.0/15"), netip.MustParsePrefix("3.5.0.0/19")}
+
+// Creates a registered collector, as the system monitor does.
+func newTestCollector(t *testing.T, name string) Collector {
+	factory, ok := allCollectors[name]
+	if !ok {
+		t.Fatalf("collector %s isn't registered", name)
+	}
+	return factory(&CollectorContext{S3Prefixes: testS3Prefixes, BenchmarkPIDFile: "/tmp/benchmark.pid"})
+}
+
+// Reads the output of a collector's sample command captured from a real machine.
+func readFixture(t *testing.T, name string) []byte {
+	buf, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// Checks that the samples are exactly want, keyed by "series" or "series/device".
+func checkSamples(t *testing.T, got []Sample, want map[string]float64) {
+	t.Helper()
+	seen := map[string]bool{}
+	for _, s := range got {
+		key := s.Series
+		if s.Device != "" {
+			key += "/" + s.Device
+		}
+		if seen[key] {
+			t.Errorf("%s was sampled more than once", key)
+		}
+		seen[key] = true
+		w, ok := want[key]
+		if !ok {
+			t.Errorf("unexpected sample %s = %g", key, s.Value)
+			continue
+		}
+		if math.Abs(s.Value-w) > 1e-9*math.Max(1, math.Abs(w)) {
+			t.Errorf("%s = %g, want %g", key, s.Value, w)
+		}
+	}
+	for key := range want {
+		if !seen[key] {
+			t.Errorf("%s wasn't sampled", key)
+		}
+	}
+}
+
+func TestDefaultCollectorsAreRegistered(t *testing.T) {
+	if err := ValidateCollectors(DefaultCollectors); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateCollectors(append(slices.Clone(DefaultCollectors), "dns")); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateCollectors([]string{"cpu", "gpu"}); err == nil {
+		t.Error("an unknown collector was accepted")
+	}
+	for name, factory := range allCollectors {
+		if c := factory(&CollectorContext{}); c.Name() != name {
+			t.Errorf("collector %s is registered as %s", c.Name(), name)
+		}
+	}
+}
+
+func TestMemoryCollector(t *testing.T) {
+	c := newTestCollector(t, "memory")
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "meminfo")), map[string]float64{
+		"mem.total_bytes":  8000000 * 1024,
+		"mem.used_bytes":   4000000 * 1024, // total - free - buffers - cached - reclaimable slab
+		"mem.used_pct":     50,
+		"mem.avail_bytes":  5000000 * 1024,
+		"mem.avail_pct":    62.5,
+		"swap.total_bytes": 0,
+		"swap.used_bytes":  0,
+		"swap.used_pct":    0, // not NaN without swap
+	})
+	if samples := c.Parse(time.Now(), nil); len(samples) != 0 {
+		t.Errorf("empty output gave %v", samples)
+	}
+}
+
+func TestDiskIOCollector(t *testing.T) {
+	c := newTestCollector(t, "disk")
+	want := map[string]float64{}
+	device := func(name string, values ...float64) {
+		series := []string{"reads", "reads_merged", "read_bytes", "read_time_ms", "writes", "writes_merged", "write_bytes",
+			"write_time_ms", "ios_in_progress", "io_time_ms", "weighted_io_time_ms", "flushes", "flush_time_ms"}
+		for i, v := range values {
+			want["disk."+series[i]+"/"+name] = v
+		}
+	}
+	device("nvme0n1", 1000, 10, 20000*512, 500, 2000, 20, 40000*512, 800, 0, 1200, 1300, 50, 60)
+	device("nvme0n1p1", 900, 10, 18000*512, 450, 2000, 20, 40000*512, 800, 0, 1100, 1250, 0, 0)
+	// Kernels before 5.5 don't report flushes
+	device("sda", 1, 2, 3*512, 4, 5, 6, 7*512, 8, 9, 10, 11)
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "diskstats")), want)
+}
+
+func TestNetworkCollector(t *testing.T) {
+	c := newTestCollector(t, "network")
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "net_dev")), map[string]float64{
+		"net.bytes_recv/lo":     1000,
+		"net.packets_recv/lo":   10,
+		"net.bytes_sent/lo":     1000,
+		"net.packets_sent/lo":   10,
+		"net.bytes_recv/ens5":   123456789,
+		"net.packets_recv/ens5": 90000,
+		"net.bytes_sent/ens5":   2345678,
+		"net.packets_sent/ens5": 30000,
+	})
+}
+
+func TestS3IPCollector(t *testing.T) {
+	c := newTestCollector(t, "s3_ip")
+	// Two connections to 52.216.0.1, one in TIME_WAIT to 52.216.0.2, and one to 3.5.0.10. The listening socket and
+	// the SSH connection aren't S3.
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "net_tcp")), map[string]float64{
+		"s3.ips":      3,
+		"s3.networks": 2,
+	})
+}
+
+func TestParseProcNetAddr(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "0100007F:0050", want: "127.0.0.1"},
+		{in: "0100D834:01BB", want: "52.216.0.1"},
+		{in: "00000000:0000", want: "0.0.0.0"},
+		{in: "0100D8:01BB", wantErr: true},
+		{in: "XYZ0D834:01BB", wantErr: true},
+	}
+	for _, tt := range tests {
+		addr, err := parseProcNetAddr(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseProcNetAddr(%s) returned %s, want an error", tt.in, addr)
+			}
+			continue
+		}
+		if err != nil || addr.String() != tt.want {
+			t.Errorf("parseProcNetAddr(%s) returned %s, %v, want %s", tt.in, addr, err, tt.want)
+		}
+	}
+}
+
+func TestENACollector(t *testing.T) {
+	c := newTestCollector(t, "ena")
+	// docker0 has no allowance counters and veth1234 isn't supported by ethtool
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "ethtool")), map[string]float64{
+		"ena.bw_in_allowance_exceeded/ens5":      12,
+		"ena.bw_out_allowance_exceeded/ens5":     0,
+		"ena.pps_allowance_exceeded/ens5":        3,
+		"ena.conntrack_allowance_exceeded/ens5":  0,
+		"ena.linklocal_allowance_exceeded/ens5":  1,
+		"ena.conntrack_allowance_available/ens5": 136000,
+	})
+}
+
+func TestSoftirqsCollector(t *testing.T) {
+	c := newTestCollector(t, "softirqs")
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "softirqs")), map[string]float64{
+		"softirq.net_rx/cpu0": 987654,
+		"softirq.net_rx/cpu1": 12345,
+	})
+}
+
+func TestInterruptsCollector(t *testing.T) {
+	c := newTestCollector(t, "interrupts")
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "interrupts")), map[string]float64{
+		"irq.ena_queue/ens5-Tx-Rx-0": 5678 + 9012,
+		"irq.ena_queue/ens5-Tx-Rx-1": 100 + 200,
+	})
+}
+
+func TestProcessCollector(t *testing.T) {
+	c := newTestCollector(t, "process")
+	if cmd := c.SampleCommand(); cmd != "./"+agentPath+" -proc /tmp/benchmark.pid" {
+		t.Errorf("sample command is %q", cmd)
+	}
+	out := "processes 3\ncpu_user_sec 1.5\ncpu_sys_sec 0.25\nrss_bytes 104857600\nhwm_bytes 209715200\nthreads 12\nfds 40\n" +
+		"voluntary_ctxt_switches 1000\nnonvoluntary_ctxt_switches 20\n"
+	checkSamples(t, c.Parse(time.Now(), []byte(out)), map[string]float64{
+		"proc.processes":                  3,
+		"proc.cpu_user_sec":               1.5,
+		"proc.cpu_sys_sec":                0.25,
+		"proc.rss_bytes":                  104857600,
+		"proc.hwm_bytes":                  209715200,
+		"proc.threads":                    12,
+		"proc.fds":                        40,
+		"proc.voluntary_ctxt_switches":    1000,
+		"proc.nonvoluntary_ctxt_switches": 20,
+	})
+	// The agent prints nothing while the benchmark command isn't running
+	checkSamples(t, c.Parse(time.Now(), nil), map[string]float64{})
+}
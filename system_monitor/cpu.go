@@ -5,7 +5,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Octogonapus/S3Benchmark/report"
+	"github.com/Octogonapus/S3Benchmark/target"
 )
 
 type cpuTimeStat struct {
@@ -25,15 +25,70 @@ func (ts *cpuTimeStat) totalCPUTime() int {
 	return ts.user + ts.system + ts.nice + ts.iowait + ts.irq + ts.softIrq + ts.steal + ts.idle
 }
 
+// Records the percentage of CPU time spent in each state across all cores, e.g. "cpu.user_pct".
+type cpuCollector struct {
+	prev *cpuTimeStat
+}
+
+func init() {
+	RegisterCollector("cpu", func(*CollectorContext) Collector { return &cpuCollector{} })
+}
+
+func (c *cpuCollector) Name() string {
+	return "cpu"
+}
+
+func (c *cpuCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *cpuCollector) SampleCommand() string {
+	return "cat /proc/stat"
+}
+
+func (c *cpuCollector) Parse(now time.Time, out []byte) []Sample {
+	curr := parseCPUTimeStat(out)
+	prev := c.prev
+	c.prev = curr
+	if prev == nil || curr == nil {
+		return nil
+	}
+
+	delta := float64(curr.totalCPUTime() - prev.totalCPUTime())
+	if delta <= 0 {
+		return nil
+	}
+	pct := func(d int) float64 { return float64(100*d) / delta }
+	return []Sample{
+		{Series: "cpu.user_pct", Value: pct(curr.user - prev.user - (curr.guest - prev.guest))},
+		{Series: "cpu.system_pct", Value: pct(curr.system - prev.system)},
+		{Series: "cpu.idle_pct", Value: pct(curr.idle - prev.idle)},
+		{Series: "cpu.nice_pct", Value: pct(curr.nice - prev.nice - (curr.guestNice - prev.guestNice))},
+		{Series: "cpu.iowait_pct", Value: pct(curr.iowait - prev.iowait)},
+		{Series: "cpu.irq_pct", Value: pct(curr.irq - prev.irq)},
+		{Series: "cpu.softirq_pct", Value: pct(curr.softIrq - prev.softIrq)},
+		{Series: "cpu.steal_pct", Value: pct(curr.steal - prev.steal)},
+		{Series: "cpu.guest_pct", Value: pct(curr.guest - prev.guest)},
+		{Series: "cpu.guest_nice_pct", Value: pct(curr.guestNice - prev.guestNice)},
+	}
+}
+
 func parseCPUTimeStat(buf []byte) *cpuTimeStat {
+	return parseCPUTimeStats(buf)["cpu"]
+}
+
+// Parses the total ("cpu") and per-core ("cpu0", "cpu1", ...) rows of /proc/stat.
+func parseCPUTimeStats(buf []byte) map[string]*cpuTimeStat {
+	stats := map[string]*cpuTimeStat{}
 	for _, line := range strings.Split(string(buf), "\n") {
-		// We only want to total CPU usage, ignore per-core metrics and other metrics
-		if !strings.HasPrefix(line, "cpu ") {
+		if !strings.HasPrefix(line, "cpu") {
 			continue
 		}
 
-		// The rest of this loop only runs one time for the one total CPU usage line
 		parts := strings.Fields(line)
+		if len(parts) < 11 {
+			continue
+		}
 		User, _ := strconv.Atoi(parts[1])
 		Nice, _ := strconv.Atoi(parts[2])
 		System, _ := strconv.Atoi(parts[3])
@@ -44,7 +99,7 @@ func parseCPUTimeStat(buf []byte) *cpuTimeStat {
 		Steal, _ := strconv.Atoi(parts[8])
 		Guest, _ := strconv.Atoi(parts[9])
 		GuestNice, _ := strconv.Atoi(parts[10])
-		return &cpuTimeStat{
+		stats[parts[0]] = &cpuTimeStat{
 			user:      User,
 			nice:      Nice,
 			system:    System,
@@ -57,52 +112,5 @@ func parseCPUTimeStat(buf []byte) *cpuTimeStat {
 			guestNice: GuestNice,
 		}
 	}
-	return nil
-}
-
-func (mon *systemMonitor) appendCPUMetrics(now time.Time, curr *cpuTimeStat, prev *cpuTimeStat) {
-	delta := float64(curr.totalCPUTime() - prev.totalCPUTime())
-	if delta < 0 {
-		return
-	}
-	mon.sm.CpuUsageUser = append(mon.sm.CpuUsageUser, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.user-prev.user-(curr.guest-prev.guest))) / delta,
-	})
-	mon.sm.CpuUsageSystem = append(mon.sm.CpuUsageSystem, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.system-prev.system)) / delta,
-	})
-	mon.sm.CpuUsageIdle = append(mon.sm.CpuUsageIdle, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.idle-prev.idle)) / delta,
-	})
-	mon.sm.CpuUsageNice = append(mon.sm.CpuUsageNice, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.nice-prev.nice-(curr.guestNice-prev.guestNice))) / delta,
-	})
-	mon.sm.CpuUsageIowait = append(mon.sm.CpuUsageIowait, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.iowait-prev.iowait)) / delta,
-	})
-	mon.sm.CpuUsageIrq = append(mon.sm.CpuUsageIrq, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.irq-prev.irq)) / delta,
-	})
-	mon.sm.CpuUsageSoftIrq = append(mon.sm.CpuUsageSoftIrq, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.softIrq-prev.softIrq)) / delta,
-	})
-	mon.sm.CpuUsageSteal = append(mon.sm.CpuUsageSteal, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.steal-prev.steal)) / delta,
-	})
-	mon.sm.CpuUsageGuest = append(mon.sm.CpuUsageGuest, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.guest-prev.guest)) / delta,
-	})
-	mon.sm.CpuUsageGuestNice = append(mon.sm.CpuUsageGuestNice, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: float64(100*(curr.guestNice-prev.guestNice)) / delta,
-	})
+	return stats
 }
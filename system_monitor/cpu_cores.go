@@ -0,0 +1,54 @@
+package systemmonitor
+
+import (
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+// Records the utilization of each core ("cpu.core_busy_pct") and the share of it spent in softirqs
+// ("cpu.core_softirq_pct"), e.g. to find one core saturated by NIC softirqs or by a single busy thread. The device is
+// the core's name in /proc/stat, e.g. "cpu3".
+type cpuCoresCollector struct {
+	prev map[string]*cpuTimeStat
+}
+
+func init() {
+	RegisterCollector("cpu_cores", func(*CollectorContext) Collector { return &cpuCoresCollector{} })
+}
+
+func (c *cpuCoresCollector) Name() string {
+	return "cpu_cores"
+}
+
+func (c *cpuCoresCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *cpuCoresCollector) SampleCommand() string {
+	return "cat /proc/stat"
+}
+
+func (c *cpuCoresCollector) Parse(now time.Time, out []byte) []Sample {
+	curr := parseCPUTimeStats(out)
+	prev := c.prev
+	c.prev = curr
+
+	samples := []Sample{}
+	for core, currCore := range curr {
+		prevCore, ok := prev[core]
+		if core == "cpu" || !ok {
+			continue
+		}
+		delta := float64(currCore.totalCPUTime() - prevCore.totalCPUTime())
+		if delta <= 0 {
+			continue
+		}
+		idle := float64((currCore.idle - prevCore.idle) + (currCore.iowait - prevCore.iowait))
+		samples = append(samples,
+			Sample{Series: "cpu.core_busy_pct", Device: core, Value: 100 * (delta - idle) / delta},
+			Sample{Series: "cpu.core_softirq_pct", Device: core, Value: float64(100*(currCore.softIrq-prevCore.softIrq)) / delta},
+		)
+	}
+	return samples
+}
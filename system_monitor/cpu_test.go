@@ -0,0 +1,55 @@
+package systemmonitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCPUCollector(t *testing.T) {
+	c := newTestCollector(t, "cpu")
+	if samples := c.Parse(time.Now(), readFixture(t, "stat.1")); len(samples) != 0 {
+		t.Errorf("the first sample gave %v, want nothing until there is a second to compare it to", samples)
+	}
+	// 1000 ticks passed, 100 of them running a guest, which /proc/stat also counts as user time
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "stat.2")), map[string]float64{
+		"cpu.user_pct":       40,
+		"cpu.system_pct":     20,
+		"cpu.idle_pct":       25,
+		"cpu.nice_pct":       0,
+		"cpu.iowait_pct":     0,
+		"cpu.irq_pct":        0,
+		"cpu.softirq_pct":    4,
+		"cpu.steal_pct":      1,
+		"cpu.guest_pct":      10,
+		"cpu.guest_nice_pct": 0,
+	})
+	if samples := c.Parse(time.Now(), readFixture(t, "stat.2")); len(samples) != 0 {
+		t.Errorf("no time passing gave %v", samples)
+	}
+	// e.g. the counters went backwards because the target rebooted
+	if samples := c.Parse(time.Now(), readFixture(t, "stat.1")); len(samples) != 0 {
+		t.Errorf("counters going backwards gave %v", samples)
+	}
+}
+
+func TestCPUCoresCollector(t *testing.T) {
+	c := newTestCollector(t, "cpu_cores")
+	if samples := c.Parse(time.Now(), readFixture(t, "stat.1")); len(samples) != 0 {
+		t.Errorf("the first sample gave %v, want nothing until there is a second to compare it to", samples)
+	}
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "stat.2")), map[string]float64{
+		"cpu.core_busy_pct/cpu0":    100,
+		"cpu.core_softirq_pct/cpu0": 8,
+		"cpu.core_busy_pct/cpu1":    50,
+		"cpu.core_softirq_pct/cpu1": 0,
+	})
+
+	// A core which came online since the last sample is skipped until it has two samples
+	third := strings.Replace(string(readFixture(t, "stat.2")), "intr", "cpu2 10 0 10 80 0 0 0 0 0 0\nintr", 1)
+	third = strings.Replace(third, "cpu0 900 5 300 4000", "cpu0 900 5 300 4100", 1)
+	checkSamples(t, c.Parse(time.Now(), []byte(third)), map[string]float64{
+		"cpu.core_busy_pct/cpu0":    0,
+		"cpu.core_softirq_pct/cpu0": 0,
+	})
+}
@@ -5,187 +5,61 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Octogonapus/S3Benchmark/report"
+	"github.com/Octogonapus/S3Benchmark/target"
 )
 
-type diskstatEntry struct {
-	major                     int
-	minor                     int
-	deviceName                string
-	readsCompleted            int
-	readsMerged               int
-	sectorsRead               int
-	timeSpentReading          int
-	writesCompleted           int
-	writesMerged              int
-	sectorsWritten            int
-	timeSpentWriting          int
-	iosInProgress             int
-	timeSpentDoingIos         int
-	weightedTimeSpentDoingIos int
-	discardsCompleted         int
-	discardsMerged            int
-	sectorsDiscarded          int
-	timeSpentDiscarding       int
-	flushesCompleted          int
-	timeSpentFlushing         int
+// Records the counters in /proc/diskstats for each device, e.g. "disk.read_bytes".
+type diskIOCollector struct{}
+
+func init() {
+	RegisterCollector("disk", func(*CollectorContext) Collector { return &diskIOCollector{} })
+}
+
+func (c *diskIOCollector) Name() string {
+	return "disk"
+}
+
+func (c *diskIOCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *diskIOCollector) SampleCommand() string {
+	return "cat /proc/diskstats"
 }
 
-func (mon *systemMonitor) appendDiskIOMetrics(now time.Time, buf []byte) {
+func (c *diskIOCollector) Parse(now time.Time, buf []byte) []Sample {
+	samples := []Sample{}
 	for _, line := range strings.Split(string(buf), "\n") {
 		parts := strings.Fields(line)
-		if len(parts) < 19 {
+		// Kernels before 4.18 don't have the discard fields and kernels before 5.5 don't have the flush fields
+		if len(parts) < 14 {
 			continue
 		}
 
-		major, _ := strconv.Atoi(parts[0])
-		minor, _ := strconv.Atoi(parts[1])
-		readsCompleted, _ := strconv.Atoi(parts[3])
-		readsMerged, _ := strconv.Atoi(parts[4])
-		sectorsRead, _ := strconv.Atoi(parts[5])
-		timeSpentReading, _ := strconv.Atoi(parts[6])
-		writesCompleted, _ := strconv.Atoi(parts[7])
-		writesMerged, _ := strconv.Atoi(parts[8])
-		sectorsWritten, _ := strconv.Atoi(parts[9])
-		timeSpentWriting, _ := strconv.Atoi(parts[10])
-		iosInProgress, _ := strconv.Atoi(parts[11])
-		timeSpentDoingIos, _ := strconv.Atoi(parts[12])
-		weightedTimeSpentDoingIos, _ := strconv.Atoi(parts[13])
-		discardsCompleted, _ := strconv.Atoi(parts[14])
-		discardsMerged, _ := strconv.Atoi(parts[15])
-		sectorsDiscarded, _ := strconv.Atoi(parts[16])
-		timeSpentDiscarding, _ := strconv.Atoi(parts[17])
-		flushesCompleted, _ := strconv.Atoi(parts[18])
-		timeSpentFlushing, _ := strconv.Atoi(parts[19])
-
-		entry := diskstatEntry{
-			major:                     major,
-			minor:                     minor,
-			readsCompleted:            readsCompleted,
-			readsMerged:               readsMerged,
-			sectorsRead:               sectorsRead,
-			timeSpentReading:          timeSpentReading,
-			writesCompleted:           writesCompleted,
-			writesMerged:              writesMerged,
-			sectorsWritten:            sectorsWritten,
-			timeSpentWriting:          timeSpentWriting,
-			iosInProgress:             iosInProgress,
-			timeSpentDoingIos:         timeSpentDoingIos,
-			weightedTimeSpentDoingIos: weightedTimeSpentDoingIos,
-			discardsCompleted:         discardsCompleted,
-			discardsMerged:            discardsMerged,
-			sectorsDiscarded:          sectorsDiscarded,
-			timeSpentDiscarding:       timeSpentDiscarding,
-			flushesCompleted:          flushesCompleted,
-			timeSpentFlushing:         timeSpentFlushing,
-			deviceName:                parts[2],
+		device := parts[2]
+		field := func(i int) float64 {
+			v, _ := strconv.Atoi(parts[i])
+			return float64(v)
+		}
+		samples = append(samples,
+			Sample{Series: "disk.reads", Device: device, Value: field(3)},
+			Sample{Series: "disk.reads_merged", Device: device, Value: field(4)},
+			Sample{Series: "disk.read_bytes", Device: device, Value: field(5) * 512},
+			Sample{Series: "disk.read_time_ms", Device: device, Value: field(6)},
+			Sample{Series: "disk.writes", Device: device, Value: field(7)},
+			Sample{Series: "disk.writes_merged", Device: device, Value: field(8)},
+			Sample{Series: "disk.write_bytes", Device: device, Value: field(9) * 512},
+			Sample{Series: "disk.write_time_ms", Device: device, Value: field(10)},
+			Sample{Series: "disk.ios_in_progress", Device: device, Value: field(11)},
+			Sample{Series: "disk.io_time_ms", Device: device, Value: field(12)},
+			Sample{Series: "disk.weighted_io_time_ms", Device: device, Value: field(13)},
+		)
+		if len(parts) >= 20 {
+			samples = append(samples,
+				Sample{Series: "disk.flushes", Device: device, Value: field(18)},
+				Sample{Series: "disk.flush_time_ms", Device: device, Value: field(19)},
+			)
 		}
-
-		readBytes := entry.sectorsRead * 512
-		writeBytes := entry.sectorsWritten * 512
-
-		mon.sm.DiskReads = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.readsCompleted,
-			},
-		})
-
-		mon.sm.DiskReadsMerged = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.readsMerged,
-			},
-		})
-
-		mon.sm.DiskReadBytes = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: readBytes,
-			},
-		})
-
-		mon.sm.DiskReadTimeMs = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.timeSpentReading,
-			},
-		})
-
-		mon.sm.DiskWrites = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.writesCompleted,
-			},
-		})
-
-		mon.sm.DiskWritesMerged = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.writesMerged,
-			},
-		})
-
-		mon.sm.DiskWriteBytes = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: writeBytes,
-			},
-		})
-
-		mon.sm.DiskWriteTimeMs = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.timeSpentWriting,
-			},
-		})
-
-		mon.sm.DiskIOTimeMs = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.timeSpentDoingIos,
-			},
-		})
-
-		mon.sm.DiskWeightedIOTimeMs = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.weightedTimeSpentDoingIos,
-			},
-		})
-
-		mon.sm.DiskFlushes = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.flushesCompleted,
-			},
-		})
-
-		mon.sm.DiskFlushTimeMs = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.timeSpentFlushing,
-			},
-		})
-
-		mon.sm.DiskIopsInProgress = append(mon.sm.DiskReads, report.DeviceMeasurement[int]{
-			DeviceName: entry.deviceName,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: entry.iosInProgress,
-			},
-		})
 	}
+	return samples
 }
@@ -0,0 +1,113 @@
+package systemmonitor
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+const (
+	dnsLogFile      = "/var/log/s3benchmark-dns.log"
+	dnsPIDFile      = "/run/s3benchmark-dnsmasq.pid"
+	dnsUpstreamFile = "/etc/s3benchmark-resolv.conf" // the original resolv.conf, which dnsmasq forwards to
+	dnsLinkFile     = "/etc/s3benchmark-resolv.link" // the original target of resolv.conf if it was a symlink
+)
+
+// Starts dnsmasq as a non-caching resolver which logs every query and answer, and points resolv.conf at it. The
+// original resolv.conf is saved once so that running this again doesn't make dnsmasq forward to itself.
+const dnsSetUpScript = `set -e
+if [ ! -e ` + dnsUpstreamFile + ` ]; then
+  cp -L /etc/resolv.conf ` + dnsUpstreamFile + `
+  if [ -L /etc/resolv.conf ]; then readlink /etc/resolv.conf > ` + dnsLinkFile + `; fi
+fi
+if [ -f ` + dnsPIDFile + ` ]; then kill $(cat ` + dnsPIDFile + `) 2>/dev/null || true; sleep 1; fi
+: > ` + dnsLogFile + `
+dnsmasq --conf-file=/dev/null --listen-address=127.0.0.1 --bind-interfaces --cache-size=0 --no-poll \
+  --resolv-file=` + dnsUpstreamFile + ` --log-queries --log-facility=` + dnsLogFile + ` --pid-file=` + dnsPIDFile + ` --user=root
+if [ -L /etc/resolv.conf ]; then rm /etc/resolv.conf; fi
+{ echo "nameserver 127.0.0.1"; grep -v '^nameserver' ` + dnsUpstreamFile + ` || true; } > /etc/resolv.conf`
+
+// Stops dnsmasq and restores resolv.conf. It's rewritten in place rather than replaced if it wasn't a symlink because
+// it may be a bind mount, e.g. in Docker.
+const dnsTearDownScript = `if [ -f ` + dnsPIDFile + ` ]; then kill $(cat ` + dnsPIDFile + `) 2>/dev/null; rm -f ` + dnsPIDFile + `; fi
+if [ -e ` + dnsUpstreamFile + ` ]; then
+  if [ -f ` + dnsLinkFile + ` ]; then ln -sfn "$(cat ` + dnsLinkFile + `)" /etc/resolv.conf; else cat ` + dnsUpstreamFile + ` > /etc/resolv.conf; fi || exit 1
+  rm -f ` + dnsUpstreamFile + ` ` + dnsLinkFile + `
+fi`
+
+// Records the DNS lookups made on the target by running a logging resolver: how many times each name was looked up
+// ("dns.lookups", per name), how many answers were S3 IPs ("dns.s3_answers"), and how many distinct S3 IPs have been
+// returned so far ("dns.s3_ips_returned"). All are cumulative. This replaces the target's resolver while the benchmark
+// runs, so it isn't a default collector.
+type dnsCollector struct {
+	s3Prefixes []netip.Prefix
+	partial    string         // the end of the log which wasn't a whole line yet
+	lookups    map[string]int // by name
+	s3Answers  int
+	s3IPs      []netip.Addr
+}
+
+func init() {
+	RegisterCollector("dns", func(cctx *CollectorContext) Collector {
+		return &dnsCollector{s3Prefixes: cctx.S3Prefixes, lookups: map[string]int{}}
+	})
+}
+
+func (c *dnsCollector) Name() string {
+	return "dns"
+}
+
+func (c *dnsCollector) SetUpCommand(pm target.PackageManager) string {
+	return pm.InstallCommand("dnsmasq-base") + " && " + dnsSetUpScript
+}
+
+func (c *dnsCollector) TearDownCommand() string {
+	return dnsTearDownScript
+}
+
+func (c *dnsCollector) SampleCommand() string {
+	return "./" + agentPath + " -follow " + dnsLogFile
+}
+
+func (c *dnsCollector) Parse(now time.Time, buf []byte) []Sample {
+	lines := strings.Split(c.partial+string(buf), "\n")
+	c.partial = lines[len(lines)-1]
+
+	// e.g. "Oct 16 12:00:00 dnsmasq[1234]: query[A] bucket.s3.amazonaws.com from 127.0.0.1" and
+	// "Oct 16 12:00:00 dnsmasq[1234]: reply s3-1-w.amazonaws.com is 52.216.1.2". Replies may also be CNAMEs.
+	for _, line := range lines[:len(lines)-1] {
+		_, msg, ok := strings.Cut(line, "]: ")
+		if !ok {
+			continue
+		}
+		parts := strings.Fields(msg)
+		if len(parts) < 4 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(parts[0], "query[A") && parts[2] == "from":
+			c.lookups[parts[1]]++
+		case parts[0] == "reply" && parts[2] == "is":
+			addr, err := netip.ParseAddr(parts[3])
+			if err != nil || !isS3(c.s3Prefixes, addr) {
+				continue
+			}
+			c.s3Answers++
+			if !slices.Contains(c.s3IPs, addr) {
+				c.s3IPs = append(c.s3IPs, addr)
+			}
+		}
+	}
+
+	samples := []Sample{
+		{Series: "dns.s3_answers", Value: float64(c.s3Answers)},
+		{Series: "dns.s3_ips_returned", Value: float64(len(c.s3IPs))},
+	}
+	for name, n := range c.lookups {
+		samples = append(samples, Sample{Series: "dns.lookups", Device: name, Value: float64(n)})
+	}
+	return samples
+}
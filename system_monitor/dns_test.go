@@ -0,0 +1,34 @@
+package systemmonitor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDNSCollector(t *testing.T) {
+	c := newTestCollector(t, "dns")
+	log := readFixture(t, "dnsmasq.log")
+
+	// The agent may sample the log part way through a line, which is held back until the rest of it arrives
+	split := bytes.Index(log, []byte("query[A] example.com")) + len("query[A] exa")
+	checkSamples(t, c.Parse(time.Now(), log[:split]), map[string]float64{
+		"dns.lookups/bucket.s3.us-east-1.amazonaws.com": 2, // the A and AAAA queries
+		"dns.s3_answers":      2,
+		"dns.s3_ips_returned": 2,
+	})
+	checkSamples(t, c.Parse(time.Now(), log[split:]), map[string]float64{
+		"dns.lookups/bucket.s3.us-east-1.amazonaws.com": 3,
+		"dns.lookups/example.com":                       1,
+		"dns.s3_answers":                                3,
+		"dns.s3_ips_returned":                           2,
+	})
+
+	// Nothing was appended
+	checkSamples(t, c.Parse(time.Now(), nil), map[string]float64{
+		"dns.lookups/bucket.s3.us-east-1.amazonaws.com": 3,
+		"dns.lookups/example.com":                       1,
+		"dns.s3_answers":                                3,
+		"dns.s3_ips_returned":                           2,
+	})
+}
@@ -0,0 +1,56 @@
+package systemmonitor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+// Prints "device <name>" and then the NIC statistics of each network interface except loopback.
+const enaSampleCommand = `for dev in $(ls /sys/class/net); do [ "$dev" = lo ] && continue; echo "device $dev"; ethtool -S "$dev" 2>/dev/null; done`
+
+// Records the ENA driver's allowance counters for each interface, e.g. "ena.bw_in_allowance_exceeded" and
+// "ena.pps_allowance_exceeded". These count the packets which were queued or dropped because the instance exceeded its
+// network allowance rather than because of the client. Interfaces which aren't ENA devices record nothing.
+type enaCollector struct{}
+
+func init() {
+	RegisterCollector("ena", func(*CollectorContext) Collector { return &enaCollector{} })
+}
+
+func (c *enaCollector) Name() string {
+	return "ena"
+}
+
+func (c *enaCollector) SetUpCommand(pm target.PackageManager) string {
+	return pm.InstallCommand("ethtool")
+}
+
+func (c *enaCollector) SampleCommand() string {
+	return enaSampleCommand
+}
+
+func (c *enaCollector) Parse(now time.Time, buf []byte) []Sample {
+	samples := []Sample{}
+	device := ""
+	for _, line := range strings.Split(string(buf), "\n") {
+		if name, ok := strings.CutPrefix(line, "device "); ok {
+			device = name
+			continue
+		}
+
+		// e.g. "     bw_in_allowance_exceeded: 0"
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || !strings.Contains(key, "allowance") {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, Sample{Series: "ena." + key, Device: device, Value: v})
+	}
+	return samples
+}
@@ -0,0 +1,59 @@
+package systemmonitor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+// Records how many interrupts each ENA queue has raised over all cores ("irq.ena_queue"). The device is the queue's
+// name in /proc/interrupts, e.g. "ens5-Tx-Rx-0". The counts are cumulative.
+type interruptsCollector struct{}
+
+func init() {
+	RegisterCollector("interrupts", func(*CollectorContext) Collector { return &interruptsCollector{} })
+}
+
+func (c *interruptsCollector) Name() string {
+	return "interrupts"
+}
+
+func (c *interruptsCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *interruptsCollector) SampleCommand() string {
+	return "cat /proc/interrupts"
+}
+
+func (c *interruptsCollector) Parse(now time.Time, buf []byte) []Sample {
+	lines := strings.Split(string(buf), "\n")
+	if len(lines) == 0 {
+		return nil
+	}
+	// The first line names the cores, e.g. "CPU0 CPU1 ...". Each row is the IRQ, one count per core, and then a
+	// description ending in the IRQ's name, e.g. "28: 5678 9012 PCI-MSI 81921-edge ens5-Tx-Rx-0".
+	cores := len(strings.Fields(lines[0]))
+
+	samples := []Sample{}
+	for _, line := range lines[1:] {
+		parts := strings.Fields(line)
+		if len(parts) < cores+2 {
+			continue
+		}
+		// The ENA driver names its queues' IRQs <interface>-Tx-Rx-<queue>
+		name := parts[len(parts)-1]
+		if !strings.Contains(name, "-Tx-Rx-") {
+			continue
+		}
+		total := 0.0
+		for _, count := range parts[1 : cores+1] {
+			v, _ := strconv.ParseFloat(count, 64)
+			total += v
+		}
+		samples = append(samples, Sample{Series: "irq.ena_queue", Device: name, Value: total})
+	}
+	return samples
+}
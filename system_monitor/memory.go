@@ -6,10 +6,29 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Octogonapus/S3Benchmark/report"
+	"github.com/Octogonapus/S3Benchmark/target"
 )
 
-func (mon *systemMonitor) appendMemoryMetrics(now time.Time, buf []byte) {
+// Records memory and swap usage, e.g. "mem.used_bytes" and "swap.used_pct".
+type memoryCollector struct{}
+
+func init() {
+	RegisterCollector("memory", func(*CollectorContext) Collector { return &memoryCollector{} })
+}
+
+func (c *memoryCollector) Name() string {
+	return "memory"
+}
+
+func (c *memoryCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *memoryCollector) SampleCommand() string {
+	return "cat /proc/meminfo"
+}
+
+func (c *memoryCollector) Parse(now time.Time, buf []byte) []Sample {
 	total := 0
 	free := 0
 	buffers := 0
@@ -47,6 +66,9 @@ func (mon *systemMonitor) appendMemoryMetrics(now time.Time, buf []byte) {
 			swapTotal = bytes
 		}
 	}
+	if total == 0 {
+		return nil
+	}
 
 	used := total - free - buffers - cached
 	usedPct := 100 * (float64(used) / (float64(total)))
@@ -57,28 +79,14 @@ func (mon *systemMonitor) appendMemoryMetrics(now time.Time, buf []byte) {
 		swapUsedPct = 0
 	}
 
-	mon.sm.MemUsedBytes = append(mon.sm.MemUsedBytes, report.Measurement[int]{
-		Time:  now.Unix(),
-		Value: used,
-	})
-	mon.sm.MemUsedPct = append(mon.sm.MemUsedPct, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: usedPct,
-	})
-	mon.sm.MemAvailBytes = append(mon.sm.MemAvailBytes, report.Measurement[int]{
-		Time:  now.Unix(),
-		Value: available,
-	})
-	mon.sm.MemAvailPct = append(mon.sm.MemAvailPct, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: availablePct,
-	})
-	mon.sm.SwapUsedBytes = append(mon.sm.SwapUsedBytes, report.Measurement[int]{
-		Time:  now.Unix(),
-		Value: swapUsed,
-	})
-	mon.sm.SwapUsedPct = append(mon.sm.SwapUsedPct, report.Measurement[float64]{
-		Time:  now.Unix(),
-		Value: swapUsedPct,
-	})
+	return []Sample{
+		{Series: "mem.total_bytes", Value: float64(total)},
+		{Series: "mem.used_bytes", Value: float64(used)},
+		{Series: "mem.used_pct", Value: usedPct},
+		{Series: "mem.avail_bytes", Value: float64(available)},
+		{Series: "mem.avail_pct", Value: availablePct},
+		{Series: "swap.total_bytes", Value: float64(swapTotal)},
+		{Series: "swap.used_bytes", Value: float64(swapUsed)},
+		{Series: "swap.used_pct", Value: swapUsedPct},
+	}
 }
@@ -5,10 +5,30 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Octogonapus/S3Benchmark/report"
+	"github.com/Octogonapus/S3Benchmark/target"
 )
 
-func (mon *systemMonitor) appendNetworkMetrics(now time.Time, buf []byte) {
+// Records the counters in /proc/net/dev for each interface, e.g. "net.bytes_recv".
+type networkCollector struct{}
+
+func init() {
+	RegisterCollector("network", func(*CollectorContext) Collector { return &networkCollector{} })
+}
+
+func (c *networkCollector) Name() string {
+	return "network"
+}
+
+func (c *networkCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *networkCollector) SampleCommand() string {
+	return "cat /proc/net/dev"
+}
+
+func (c *networkCollector) Parse(now time.Time, buf []byte) []Sample {
+	samples := []Sample{}
 	for _, line := range strings.Split(string(buf), "\n") {
 		parts := strings.Fields(line)
 		if len(parts) != 17 {
@@ -21,34 +41,12 @@ func (mon *systemMonitor) appendNetworkMetrics(now time.Time, buf []byte) {
 		sendBytes, _ := strconv.Atoi(parts[9])
 		sendPackets, _ := strconv.Atoi(parts[10])
 
-		mon.sm.NetBytesSent = append(mon.sm.NetBytesSent, report.DeviceMeasurement[int]{
-			DeviceName: iface,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: sendBytes,
-			},
-		})
-
-		mon.sm.NetBytesRecv = append(mon.sm.NetBytesRecv, report.DeviceMeasurement[int]{
-			DeviceName: iface,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: recvBytes,
-			},
-		})
-		mon.sm.NetPacketsSent = append(mon.sm.NetPacketsSent, report.DeviceMeasurement[int]{
-			DeviceName: iface,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: sendPackets,
-			},
-		})
-		mon.sm.NetPacketsRecv = append(mon.sm.NetPacketsRecv, report.DeviceMeasurement[int]{
-			DeviceName: iface,
-			Measurement: report.Measurement[int]{
-				Time:  now.Unix(),
-				Value: recvPackets,
-			},
-		})
+		samples = append(samples,
+			Sample{Series: "net.bytes_sent", Device: iface, Value: float64(sendBytes)},
+			Sample{Series: "net.bytes_recv", Device: iface, Value: float64(recvBytes)},
+			Sample{Series: "net.packets_sent", Device: iface, Value: float64(sendPackets)},
+			Sample{Series: "net.packets_recv", Device: iface, Value: float64(recvPackets)},
+		)
 	}
+	return samples
 }
@@ -0,0 +1,50 @@
+package systemmonitor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+// Records the resource usage of the benchmark command's processes, so that it isn't mixed up with e.g. sshd or the
+// monitor itself. The series are "proc.processes", "proc.cpu_user_sec" and "proc.cpu_sys_sec" (cumulative),
+// "proc.rss_bytes", "proc.hwm_bytes" (the sum of each process's peak RSS), "proc.threads", "proc.fds", and
+// "proc.voluntary_ctxt_switches" and "proc.nonvoluntary_ctxt_switches" (cumulative). Nothing is recorded while the
+// benchmark command isn't running. Each run of the command starts the cumulative series from zero again.
+type processCollector struct {
+	pidFile string
+}
+
+func init() {
+	RegisterCollector("process", func(cctx *CollectorContext) Collector { return &processCollector{pidFile: cctx.BenchmarkPIDFile} })
+}
+
+func (c *processCollector) Name() string {
+	return "process"
+}
+
+func (c *processCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *processCollector) SampleCommand() string {
+	return "./" + agentPath + " -proc " + c.pidFile
+}
+
+func (c *processCollector) Parse(now time.Time, buf []byte) []Sample {
+	samples := []Sample{}
+	for _, line := range strings.Split(string(buf), "\n") {
+		name, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, Sample{Series: "proc." + name, Value: v})
+	}
+	return samples
+}
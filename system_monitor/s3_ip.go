@@ -1,68 +1,84 @@
 package systemmonitor
 
 import (
+	"encoding/binary"
+	"fmt"
 	"log/slog"
 	"net/netip"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Octogonapus/S3Benchmark/report"
+	"github.com/Octogonapus/S3Benchmark/target"
 )
 
-func (mon *systemMonitor) appendS3IPMetrics(now time.Time, buf []byte, s3Prefixes []netip.Prefix) {
-	uniqueIPs := 0
-	uniqueNetworks := 0
-	foundIPs := []string{}
+// Records how many distinct S3 IPs ("s3.ips") and S3 networks ("s3.networks") the target has connections to.
+type s3IPCollector struct {
+	s3Prefixes []netip.Prefix
+}
+
+func init() {
+	RegisterCollector("s3_ip", func(cctx *CollectorContext) Collector { return &s3IPCollector{s3Prefixes: cctx.S3Prefixes} })
+}
+
+func (c *s3IPCollector) Name() string {
+	return "s3_ip"
+}
+
+func (c *s3IPCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *s3IPCollector) SampleCommand() string {
+	return "cat /proc/net/tcp"
+}
+
+func (c *s3IPCollector) Parse(now time.Time, buf []byte) []Sample {
+	foundIPs := []netip.Addr{}
 	foundNetworks := []netip.Prefix{}
 
 	for i, line := range strings.Split(string(buf), "\n") {
+		// sl local_address rem_address st ...
 		parts := strings.Fields(line)
-		if i < 2 || len(parts) != 6 {
+		if i < 1 || len(parts) < 4 || parts[3] == tcpListen {
 			continue
 		}
 
-		foreignAddressAndPort := parts[4]
-		foreignAddress := strings.Split(foreignAddressAndPort, ":")[0]
-		parsedForeignAddress, err := netip.ParseAddr(foreignAddress)
+		remoteAddress, err := parseProcNetAddr(parts[2])
 		if err != nil {
-			slog.Warn("SystemMonitor: failed to parse address", slog.String("address", foreignAddress), slog.String("error", err.Error()))
+			slog.Warn("SystemMonitor: failed to parse address", slog.String("address", parts[2]), slog.String("error", err.Error()))
+			continue
 		}
 
-		for _, prefix := range s3Prefixes {
-			if prefix.Contains(parsedForeignAddress) {
-				found := false
-				for _, foundIP := range foundIPs {
-					if foundIP == foreignAddress {
-						found = true
-						break
-					}
-				}
-				if !found {
-					foundIPs = append(foundIPs, foreignAddress)
-					uniqueIPs++
-
-					found := false
-					for _, foundNetwork := range foundNetworks {
-						if foundNetwork == prefix {
-							found = true
-							break
-						}
-					}
-					if !found {
-						foundNetworks = append(foundNetworks, prefix)
-						uniqueNetworks++
-					}
+		for _, prefix := range c.s3Prefixes {
+			if prefix.Contains(remoteAddress) && !slices.Contains(foundIPs, remoteAddress) {
+				foundIPs = append(foundIPs, remoteAddress)
+				if !slices.Contains(foundNetworks, prefix) {
+					foundNetworks = append(foundNetworks, prefix)
 				}
 			}
 		}
 	}
 
-	mon.sm.S3IPs = append(mon.sm.S3IPs, report.Measurement[int]{
-		Time:  now.Unix(),
-		Value: uniqueIPs,
-	})
-	mon.sm.S3Networks = append(mon.sm.S3Networks, report.Measurement[int]{
-		Time:  now.Unix(),
-		Value: uniqueNetworks,
-	})
+	return []Sample{
+		{Series: "s3.ips", Value: float64(len(foundIPs))},
+		{Series: "s3.networks", Value: float64(len(foundNetworks))},
+	}
+}
+
+// The state of a listening socket in /proc/net/tcp.
+const tcpListen = "0A"
+
+// Parses an IPv4 address in /proc/net/tcp, e.g. "0100007F:0050", which is hex in the target's byte order. Both
+// supported architectures are little-endian.
+func parseProcNetAddr(s string) (netip.Addr, error) {
+	hexAddr, _, _ := strings.Cut(s, ":")
+	v, err := strconv.ParseUint(hexAddr, 16, 32)
+	if err != nil || len(hexAddr) != 8 {
+		return netip.Addr{}, fmt.Errorf("invalid address: %s", s)
+	}
+	b := [4]byte{}
+	binary.LittleEndian.PutUint32(b[:], uint32(v))
+	return netip.AddrFrom4(b), nil
 }
@@ -0,0 +1,58 @@
+package systemmonitor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+// Records how many NET_RX softirqs each core has handled ("softirq.net_rx"), which shows whether receive processing
+// is spread across cores or stuck on a few of them. The device is the core's name as in /proc/stat, e.g. "cpu3".
+// The counts are cumulative.
+type softirqsCollector struct{}
+
+func init() {
+	RegisterCollector("softirqs", func(*CollectorContext) Collector { return &softirqsCollector{} })
+}
+
+func (c *softirqsCollector) Name() string {
+	return "softirqs"
+}
+
+func (c *softirqsCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *softirqsCollector) SampleCommand() string {
+	return "cat /proc/softirqs"
+}
+
+func (c *softirqsCollector) Parse(now time.Time, buf []byte) []Sample {
+	lines := strings.Split(string(buf), "\n")
+	if len(lines) == 0 {
+		return nil
+	}
+	// The first line names the cores, e.g. "CPU0 CPU1 ..."
+	cores := strings.Fields(lines[0])
+
+	samples := []Sample{}
+	for _, line := range lines[1:] {
+		parts := strings.Fields(line)
+		if len(parts) == 0 || parts[0] != "NET_RX:" {
+			continue
+		}
+		for i, core := range cores {
+			if i+1 >= len(parts) {
+				break
+			}
+			v, err := strconv.ParseFloat(parts[i+1], 64)
+			if err != nil {
+				continue
+			}
+			samples = append(samples, Sample{Series: "softirq.net_rx", Device: strings.ToLower(core), Value: v})
+		}
+	}
+	return samples
+}
@@ -1,76 +1,141 @@
 package systemmonitor
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/netip"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/Octogonapus/S3Benchmark/report"
 	"github.com/Octogonapus/S3Benchmark/target"
-	"golang.org/x/crypto/ssh"
+	"github.com/Octogonapus/S3Benchmark/util"
 )
 
 type SystemMonitor interface {
-	SetUp() error
-	StartMonitoring() error
+	SetUp(ctx context.Context) error
+	StartMonitoring(ctx context.Context) error // monitoring stops when ctx is canceled
 	StopMonitoring()
 	WaitUntilStopped()
 	GetSystemMeasurements() *report.SystemMeasurements
+	TearDown(ctx context.Context) error // undoes the changes SetUp made to the target. call after monitoring stops.
 }
 
 type systemMonitor struct {
-	target     target.Target
-	stop       *atomic.Bool
-	wg         *sync.WaitGroup
-	sm         *report.SystemMeasurements
-	s3Prefixes []netip.Prefix
+	target         target.Target
+	arch           target.Arch
+	sampleInterval time.Duration
+	wg             *sync.WaitGroup
+	stop           context.CancelFunc
+	sm             *report.SystemMeasurements
+	collectors     []Collector
 }
 
-func NewSystemMonitor(target target.Target, s3Prefixes []netip.Prefix) SystemMonitor {
-	return &systemMonitor{
-		target:     target,
-		stop:       &atomic.Bool{},
-		wg:         &sync.WaitGroup{},
-		sm:         &report.SystemMeasurements{},
-		s3Prefixes: s3Prefixes,
+type SystemMonitorInput struct {
+	Target         target.Target
+	Arch           target.Arch // the target's architecture, which the agent is built for
+	S3Prefixes     []netip.Prefix
+	PIDFile        string        // where the benchmark command writes its PID, for the process collector
+	Collectors     []string      // names of the collectors to run. DefaultCollectors if empty.
+	SampleInterval time.Duration // how often the collectors sample the target. 1s by default and at least 100ms.
+}
+
+var defaultSampleInterval = 1 * time.Second
+var minSampleInterval = 100 * time.Millisecond
+
+// How often the agent sends its buffered samples.
+var agentFlushInterval = 1 * time.Second
+
+func NewSystemMonitor(input *SystemMonitorInput) (SystemMonitor, error) {
+	collectors, err := newCollectors(input.Collectors, &CollectorContext{S3Prefixes: input.S3Prefixes, BenchmarkPIDFile: input.PIDFile})
+	if err != nil {
+		return nil, err
 	}
+	interval := input.SampleInterval
+	if interval == 0 {
+		interval = defaultSampleInterval
+	}
+	if interval < minSampleInterval {
+		return nil, fmt.Errorf("sample interval must be at least %s", minSampleInterval)
+	}
+	return &systemMonitor{
+		target:         input.Target,
+		arch:           input.Arch,
+		sampleInterval: interval,
+		wg:             &sync.WaitGroup{},
+		sm:             &report.SystemMeasurements{},
+		collectors:     collectors,
+	}, nil
 }
 
-func (mon *systemMonitor) SetUp() error {
-	var out []byte
-	var err error
-	for i := 0; i < 3; i++ {
-		out, err = mon.target.RunCommand("apt update -y && apt install -y net-tools")
-		if err != nil {
-			slog.Debug("failed to install dependencies, will try again", slog.String("command output", string(out)), slog.String("error", err.Error()))
-			time.Sleep(30 * time.Second)
-		} else {
-			break
+func (mon *systemMonitor) SetUp(ctx context.Context) error {
+	commands := []string{}
+	var os *target.OS
+	for _, c := range mon.collectors {
+		if os == nil {
+			var err error
+			os, err = target.DetectOS(ctx, mon.target)
+			if err != nil {
+				return err
+			}
+		}
+		if cmd := c.SetUpCommand(os.PackageManager); cmd != "" {
+			commands = append(commands, cmd)
 		}
 	}
-	if err != nil {
-		slog.Error("failed to install dependencies", slog.String("command output", string(out)), slog.String("error", err.Error()))
-		return err
+
+	for _, cmd := range commands {
+		var out []byte
+		var err error
+		for i := 0; i < 3; i++ {
+			out, err = mon.target.RunCommand(ctx, cmd)
+			if err != nil {
+				slog.Debug("failed to install dependencies, will try again", slog.String("command output", string(out)), slog.String("error", err.Error()))
+				util.Sleep(ctx, 30*time.Second)
+			} else {
+				break
+			}
+		}
+		if err != nil {
+			slog.Error("failed to install dependencies", slog.String("command output", string(out)), slog.String("error", err.Error()))
+			return err
+		}
 	}
-	return nil
+
+	return installAgent(ctx, mon.target, mon.arch)
 }
 
-func (mon *systemMonitor) StartMonitoring() error {
-	client, err := mon.target.Client()
-	if err != nil {
-		return err
+func (mon *systemMonitor) StartMonitoring(ctx context.Context) error {
+	ctx, mon.stop = context.WithCancel(ctx)
+	args := []string{"./" + agentPath, "-interval", mon.sampleInterval.String(), "-flush", agentFlushInterval.String()}
+	for _, c := range mon.collectors {
+		args = append(args, shellQuote(c.SampleCommand()))
 	}
 
-	mon.wg.Add(1)
-	go mon.runMonitor(client)
+	// The agent streams its samples over one command for as long as the monitor runs
+	r, w := io.Pipe()
+	mon.wg.Add(2)
+	go func() {
+		defer mon.wg.Done()
+		err := mon.target.StreamCommand(ctx, strings.Join(args, " "), w)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("SystemMonitor: agent stopped", slog.String("error", err.Error()))
+		}
+		w.Close()
+	}()
+	go mon.readSamples(r)
 	return nil
 }
 
 func (mon *systemMonitor) StopMonitoring() {
-	mon.stop.Store(true)
+	if mon.stop != nil {
+		mon.stop()
+	}
 }
 
 func (mon *systemMonitor) WaitUntilStopped() {
@@ -81,71 +146,42 @@ func (mon *systemMonitor) GetSystemMeasurements() *report.SystemMeasurements {
 	return mon.sm
 }
 
-var loopTime = 1 * time.Second
-var maxJitter = 1 * time.Second
+func (mon *systemMonitor) TearDown(ctx context.Context) error {
+	errs := []error{}
+	for _, c := range mon.collectors {
+		tc, ok := c.(TearDownCollector)
+		if !ok {
+			continue
+		}
+		out, err := mon.target.RunCommand(ctx, tc.TearDownCommand())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tearing down collector %s failed: %w: %s", c.Name(), err, string(out)))
+		}
+	}
+	return errors.Join(errs...)
+}
 
-func (mon *systemMonitor) runMonitor(client *ssh.Client) {
-	var prevCPU *cpuTimeStat
+func (mon *systemMonitor) readSamples(r io.ReadCloser) {
 	defer mon.wg.Done()
-	lastWakeTime := time.Now()
+	defer r.Close()
+	dec := json.NewDecoder(r)
 	for {
-		// slog.Debug("SystemMonitor: loop", slog.Bool("stop", mon.stop.Load()))
-		if mon.stop.Load() {
-			break // we deferred wg.Done
+		var s agentSample
+		err := dec.Decode(&s)
+		if err != nil {
+			if err != io.EOF {
+				slog.Warn("SystemMonitor: failed to read sample", slog.String("error", err.Error()))
+			}
+			break
 		}
-
-		jitterMs := time.Since(lastWakeTime).Milliseconds() - loopTime.Milliseconds()
-		if jitterMs > maxJitter.Milliseconds() {
-			slog.Warn("SystemMonitor: jitter exceeded maximum", slog.Int64("jitterMs", jitterMs), slog.Int64("maxJitterMs", maxJitter.Milliseconds()))
+		if s.Source < 0 || s.Source >= len(mon.collectors) {
+			continue
 		}
-		lastWakeTime = time.Now()
 
-		buf := mon.runCommand(client, "cat /proc/stat")
-		t := time.Now()
-		currCPU := parseCPUTimeStat(buf)
-		if prevCPU != nil && currCPU != nil {
-			mon.appendCPUMetrics(t, currCPU, prevCPU)
+		now := time.Unix(0, s.Time)
+		for _, sample := range mon.collectors[s.Source].Parse(now, []byte(s.Output)) {
+			mon.sm.Append(sample.Series, sample.Device, report.Measurement[float64]{Time: float64(s.Time) / 1e9, Value: sample.Value})
 		}
-		prevCPU = currCPU
-
-		buf = mon.runCommand(client, "cat /proc/diskstats")
-		mon.appendDiskIOMetrics(time.Now(), buf)
-
-		buf = mon.runCommand(client, "cat /proc/diskstats")
-		mon.appendDiskIOMetrics(time.Now(), buf)
-
-		buf = mon.runCommand(client, "cat /proc/meminfo")
-		mon.appendMemoryMetrics(time.Now(), buf)
-
-		buf = mon.runCommand(client, "cat /proc/net/dev")
-		mon.appendNetworkMetrics(time.Now(), buf)
-
-		buf = mon.runCommand(client, "netstat -n -4")
-		mon.appendS3IPMetrics(time.Now(), buf, mon.s3Prefixes)
-
-		time.Sleep(loopTime)
 	}
 	slog.Debug("SystemMonitor: stopped")
 }
-
-func (mon *systemMonitor) runCommand(client *ssh.Client, cmd string) []byte {
-	session, err := client.NewSession()
-	if err == io.EOF {
-		// TODO try to handle this more gracefully when we purposefully terminate an instance
-		slog.Error("SystemMonitor: client got EOF when creating session, stopping monitor because connection is dead", slog.String("error", err.Error()))
-		mon.StopMonitoring()
-		return nil
-	} else if err != nil {
-		slog.Warn("SystemMonitor: failed to create session", slog.String("error", err.Error()))
-		return nil
-	} else {
-		defer session.Close()
-		buf, err := session.CombinedOutput(cmd)
-		if err != nil {
-			slog.Warn("SystemMonitor: failed to run command", slog.String("command", cmd), slog.String("output", string(buf)))
-			return nil
-		} else {
-			return buf
-		}
-	}
-}
@@ -0,0 +1,87 @@
+package systemmonitor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+// The counters in /proc/net/snmp and /proc/net/netstat which are recorded, by section and name. All are cumulative
+// except tcp.curr_estab.
+var tcpCounters = map[string]map[string]string{
+	"Tcp": {
+		"ActiveOpens":  "tcp.active_opens",
+		"AttemptFails": "tcp.attempt_fails",
+		"EstabResets":  "tcp.estab_resets",
+		"CurrEstab":    "tcp.curr_estab",
+		"InSegs":       "tcp.in_segs",
+		"OutSegs":      "tcp.out_segs",
+		"RetransSegs":  "tcp.retrans_segs",
+		"InErrs":       "tcp.in_errs",
+		"OutRsts":      "tcp.out_rsts",
+	},
+	"TcpExt": {
+		"TCPTimeouts":         "tcp.rto_timeouts",
+		"TCPLostRetransmit":   "tcp.lost_retransmits",
+		"TCPFastRetrans":      "tcp.fast_retrans",
+		"TCPSlowStartRetrans": "tcp.slow_start_retrans",
+		"TCPSynRetrans":       "tcp.syn_retrans",
+		"ListenOverflows":     "tcp.listen_overflows",
+		"ListenDrops":         "tcp.listen_drops",
+		"TCPRcvQDrop":         "tcp.rcvq_drops",
+		"TCPBacklogDrop":      "tcp.backlog_drops",
+	},
+}
+
+// Records the target's TCP counters, e.g. "tcp.retrans_segs" and "tcp.rto_timeouts".
+type tcpCollector struct{}
+
+func init() {
+	RegisterCollector("tcp", func(*CollectorContext) Collector { return &tcpCollector{} })
+}
+
+func (c *tcpCollector) Name() string {
+	return "tcp"
+}
+
+func (c *tcpCollector) SetUpCommand(target.PackageManager) string {
+	return ""
+}
+
+func (c *tcpCollector) SampleCommand() string {
+	return "cat /proc/net/snmp /proc/net/netstat"
+}
+
+// Both files hold pairs of lines per section, the first naming the counters and the second holding their values, e.g.
+// "Tcp: RtoAlgorithm RtoMin ..." then "Tcp: 1 200 ...".
+func (c *tcpCollector) Parse(now time.Time, buf []byte) []Sample {
+	samples := []Sample{}
+	lines := strings.Split(string(buf), "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		names := strings.Fields(lines[i])
+		values := strings.Fields(lines[i+1])
+		if len(names) == 0 || len(names) != len(values) || names[0] != values[0] {
+			continue
+		}
+		i++
+
+		counters, ok := tcpCounters[strings.TrimSuffix(names[0], ":")]
+		if !ok {
+			continue
+		}
+		for j := 1; j < len(names); j++ {
+			series, ok := counters[names[j]]
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseFloat(values[j], 64)
+			if err != nil {
+				continue
+			}
+			samples = append(samples, Sample{Series: series, Value: v})
+		}
+	}
+	return samples
+}
@@ -0,0 +1,196 @@
+package systemmonitor
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Octogonapus/S3Benchmark/target"
+)
+
+// The TCP states which ss reports for non-listening sockets and the series which count them.
+var tcpStates = map[string]string{
+	"ESTAB":      "tcp.sockets_established",
+	"SYN-SENT":   "tcp.sockets_syn_sent",
+	"SYN-RECV":   "tcp.sockets_syn_recv",
+	"FIN-WAIT-1": "tcp.sockets_fin_wait_1",
+	"FIN-WAIT-2": "tcp.sockets_fin_wait_2",
+	"TIME-WAIT":  "tcp.sockets_time_wait",
+	"CLOSE-WAIT": "tcp.sockets_close_wait",
+	"LAST-ACK":   "tcp.sockets_last_ack",
+	"CLOSING":    "tcp.sockets_closing",
+}
+
+// Records the number of sockets in each TCP state (e.g. "tcp.sockets_time_wait") and summarizes the established
+// connections to S3 using ss: how many there are ("tcp.s3_conns"), their mean congestion window
+// ("tcp.s3_cwnd_mean"), their mean and max smoothed RTT ("tcp.s3_rtt_ms_mean" and "tcp.s3_rtt_ms_max"), their total
+// delivery rate ("tcp.s3_delivery_gbps"), and how many segments they have retransmitted ("tcp.s3_retrans"). Also
+// records the bytes received from each S3 IP so far ("s3.bytes_recv", per IP), which misses what a connection received
+// between its last sample and closing.
+type tcpConnCollector struct {
+	s3Prefixes []netip.Prefix
+	connBytes  map[string]float64     // bytes received by each open S3 connection at the last sample, by its addresses
+	bytesRecv  map[netip.Addr]float64 // by S3 IP
+}
+
+func init() {
+	RegisterCollector("tcp_conn", func(cctx *CollectorContext) Collector {
+		return &tcpConnCollector{
+			s3Prefixes: cctx.S3Prefixes,
+			connBytes:  map[string]float64{},
+			bytesRecv:  map[netip.Addr]float64{},
+		}
+	})
+}
+
+func (c *tcpConnCollector) Name() string {
+	return "tcp_conn"
+}
+
+func (c *tcpConnCollector) SetUpCommand(pm target.PackageManager) string {
+	return pm.InstallCommand("iproute2")
+}
+
+func (c *tcpConnCollector) SampleCommand() string {
+	return "ss -4 -t -i -n"
+}
+
+// The fields of ss -i which are summarized.
+type tcpConnInfo struct {
+	cwnd              float64
+	rttMs             float64
+	deliveryRateBitps float64
+	retrans           float64
+	bytesReceived     float64
+}
+
+func (c *tcpConnCollector) Parse(now time.Time, buf []byte) []Sample {
+	states := map[string]int{}
+	s3Conns := []*tcpConnInfo{}
+	connBytes := map[string]float64{}
+
+	// Each socket is a line like "ESTAB 0 0 10.0.0.5:40000 52.216.0.1:443" followed by an indented line of info
+	lines := strings.Split(string(buf), "\n")
+	for i, line := range lines {
+		parts := strings.Fields(line)
+		if len(parts) < 5 || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if _, ok := tcpStates[parts[0]]; !ok {
+			continue
+		}
+		states[parts[0]]++
+
+		peer, err := netip.ParseAddrPort(parts[4])
+		if err != nil || parts[0] != "ESTAB" || !isS3(c.s3Prefixes, peer.Addr()) {
+			continue
+		}
+		next := ""
+		if i+1 < len(lines) {
+			next = lines[i+1]
+		}
+		info := &tcpConnInfo{}
+		if strings.HasPrefix(next, "\t") || strings.HasPrefix(next, " ") {
+			info = parseTCPConnInfo(next)
+		}
+		s3Conns = append(s3Conns, info)
+
+		// A connection which is new or whose addresses were reused has received everything since it opened
+		conn := parts[3] + " " + parts[4]
+		last, ok := c.connBytes[conn]
+		if !ok || info.bytesReceived < last {
+			last = 0
+		}
+		c.bytesRecv[peer.Addr()] += info.bytesReceived - last
+		connBytes[conn] = info.bytesReceived
+	}
+	c.connBytes = connBytes
+
+	samples := []Sample{}
+	for state, series := range tcpStates {
+		samples = append(samples, Sample{Series: series, Value: float64(states[state])})
+	}
+
+	cwnd := 0.0
+	rttMs := 0.0
+	maxRttMs := 0.0
+	deliveryRate := 0.0
+	retrans := 0.0
+	for _, info := range s3Conns {
+		cwnd += info.cwnd
+		rttMs += info.rttMs
+		maxRttMs = max(maxRttMs, info.rttMs)
+		deliveryRate += info.deliveryRateBitps
+		retrans += info.retrans
+	}
+	if n := float64(len(s3Conns)); n > 0 {
+		cwnd /= n
+		rttMs /= n
+	}
+	samples = append(samples,
+		Sample{Series: "tcp.s3_conns", Value: float64(len(s3Conns))},
+		Sample{Series: "tcp.s3_cwnd_mean", Value: cwnd},
+		Sample{Series: "tcp.s3_rtt_ms_mean", Value: rttMs},
+		Sample{Series: "tcp.s3_rtt_ms_max", Value: maxRttMs},
+		Sample{Series: "tcp.s3_delivery_gbps", Value: deliveryRate / 1e9},
+		Sample{Series: "tcp.s3_retrans", Value: retrans},
+	)
+	for ip, bytes := range c.bytesRecv {
+		samples = append(samples, Sample{Series: "s3.bytes_recv", Device: ip.String(), Value: bytes})
+	}
+	return samples
+}
+
+func isS3(s3Prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range s3Prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses an info line of ss -i, e.g. "cubic wscale:7,7 rto:204 rtt:0.178/0.05 ... cwnd:10 ... retrans:0/5
+// delivery_rate 1.2Gbps ...". Rates are either plain bits per second or have a unit such as Mbps.
+func parseTCPConnInfo(line string) *tcpConnInfo {
+	info := &tcpConnInfo{}
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok && field == "delivery_rate" && i+1 < len(fields) {
+			info.deliveryRateBitps = parseRate(fields[i+1])
+			continue
+		}
+		switch key {
+		case "cwnd":
+			info.cwnd, _ = strconv.ParseFloat(value, 64)
+		case "rtt":
+			// smoothed RTT/RTT variance
+			rtt, _, _ := strings.Cut(value, "/")
+			info.rttMs, _ = strconv.ParseFloat(rtt, 64)
+		case "bytes_received":
+			info.bytesReceived, _ = strconv.ParseFloat(value, 64)
+		case "retrans":
+			// currently unacknowledged retransmits/total retransmits
+			_, total, _ := strings.Cut(value, "/")
+			info.retrans, _ = strconv.ParseFloat(total, 64)
+		}
+	}
+	return info
+}
+
+// Parses a rate printed by ss, e.g. "1234bps" or "1.2Gbps", into bits per second.
+func parseRate(s string) float64 {
+	s = strings.TrimSuffix(s, "bps")
+	scale := 1.0
+	for suffix, v := range map[string]float64{"K": 1e3, "M": 1e6, "G": 1e9, "T": 1e12} {
+		if strings.HasSuffix(s, suffix) {
+			s = strings.TrimSuffix(s, suffix)
+			scale = v
+			break
+		}
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	return v * scale
+}
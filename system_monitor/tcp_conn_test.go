@@ -0,0 +1,78 @@
+package systemmonitor
+
+import (
+	"testing"
+	"time"
+)
+
+// Returns a sample of every socket state series with the given counts, which are zero for states not in counts.
+func tcpStateSamples(counts map[string]float64) map[string]float64 {
+	out := map[string]float64{}
+	for _, series := range tcpStates {
+		out[series] = counts[series]
+	}
+	return out
+}
+
+func TestTCPConnCollector(t *testing.T) {
+	c := newTestCollector(t, "tcp_conn")
+
+	// Two established S3 connections, an SSH connection, and S3 connections which are closing or opening
+	want := tcpStateSamples(map[string]float64{
+		"tcp.sockets_established": 3,
+		"tcp.sockets_time_wait":   1,
+		"tcp.sockets_syn_sent":    1,
+	})
+	want["tcp.s3_conns"] = 2
+	want["tcp.s3_cwnd_mean"] = 20
+	want["tcp.s3_rtt_ms_mean"] = 2
+	want["tcp.s3_rtt_ms_max"] = 2.5
+	want["tcp.s3_delivery_gbps"] = 2
+	want["tcp.s3_retrans"] = 3
+	want["s3.bytes_recv/52.216.0.1"] = 5000000
+	want["s3.bytes_recv/52.216.0.2"] = 2000000
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "ss")), want)
+
+	// The first connection received more, the second closed, and a new one opened to the same IP
+	out := "ESTAB 0 0 10.0.0.5:40000 52.216.0.1:443\n\t cubic rtt:2/1 cwnd:10 bytes_received:8000000 delivery_rate 1Gbps\n" +
+		"ESTAB 0 0 10.0.0.5:40008 52.216.0.2:443\n\t cubic rtt:2/1 cwnd:10 bytes_received:1000000 delivery_rate 1Gbps\n"
+	want = tcpStateSamples(map[string]float64{"tcp.sockets_established": 2})
+	want["tcp.s3_conns"] = 2
+	want["tcp.s3_cwnd_mean"] = 10
+	want["tcp.s3_rtt_ms_mean"] = 2
+	want["tcp.s3_rtt_ms_max"] = 2
+	want["tcp.s3_delivery_gbps"] = 2
+	want["tcp.s3_retrans"] = 0
+	want["s3.bytes_recv/52.216.0.1"] = 8000000
+	want["s3.bytes_recv/52.216.0.2"] = 3000000
+	checkSamples(t, c.Parse(time.Now(), []byte(out)), want)
+
+	// The first connection's addresses were reused by a new connection, whose counter started over
+	out = "ESTAB 0 0 10.0.0.5:40000 52.216.0.1:443\n\t cubic rtt:2/1 cwnd:10 bytes_received:100\n"
+	want = tcpStateSamples(map[string]float64{"tcp.sockets_established": 1})
+	want["tcp.s3_conns"] = 1
+	want["tcp.s3_cwnd_mean"] = 10
+	want["tcp.s3_rtt_ms_mean"] = 2
+	want["tcp.s3_rtt_ms_max"] = 2
+	want["tcp.s3_delivery_gbps"] = 0
+	want["tcp.s3_retrans"] = 0
+	want["s3.bytes_recv/52.216.0.1"] = 8000100
+	want["s3.bytes_recv/52.216.0.2"] = 3000000
+	checkSamples(t, c.Parse(time.Now(), []byte(out)), want)
+}
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]float64{
+		"1234bps":   1234,
+		"1.5Kbps":   1500,
+		"286Mbps":   286e6,
+		"1.2Gbps":   1.2e9,
+		"2Tbps":     2e12,
+		"not-a-bps": 0,
+	}
+	for in, want := range tests {
+		if got := parseRate(in); got != want {
+			t.Errorf("parseRate(%s) = %g, want %g", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package systemmonitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTCPCollector(t *testing.T) {
+	c := newTestCollector(t, "tcp")
+	checkSamples(t, c.Parse(time.Now(), readFixture(t, "snmp_netstat")), map[string]float64{
+		"tcp.active_opens":       4521,
+		"tcp.attempt_fails":      3,
+		"tcp.estab_resets":       7,
+		"tcp.curr_estab":         64,
+		"tcp.in_segs":            9876543,
+		"tcp.out_segs":           8765432,
+		"tcp.retrans_segs":       1234,
+		"tcp.in_errs":            2,
+		"tcp.out_rsts":           56,
+		"tcp.rto_timeouts":       11,
+		"tcp.lost_retransmits":   22,
+		"tcp.fast_retrans":       33,
+		"tcp.slow_start_retrans": 44,
+		"tcp.syn_retrans":        55,
+		"tcp.listen_overflows":   0,
+		"tcp.listen_drops":       0,
+		"tcp.rcvq_drops":         66,
+		"tcp.backlog_drops":      77,
+	})
+
+	// A section whose values don't line up with its names is skipped rather than misattributed
+	out := "Tcp: RtoAlgorithm RtoMin ActiveOpens\nTcp: 1 200\nTcpExt: TCPTimeouts\nTcpExt: 9\n"
+	checkSamples(t, c.Parse(time.Now(), []byte(out)), map[string]float64{"tcp.rto_timeouts": 9})
+}
@@ -0,0 +1,181 @@
+package target
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Runs commands in a Docker container. CPU and memory limits are enforced by the container's cgroup.
+// The network bandwidth limit is enforced with tc inside the container (egress shaping and ingress policing),
+// so the container gets the NET_ADMIN capability when it is set.
+type DockerTarget struct {
+	Image                string
+	Name                 string   // the container name. docker picks one if empty.
+	Network              string   // the docker network to attach to, e.g. one shared with a local S3 stand-in
+	Env                  []string // KEY=VALUE pairs set in the container
+	CPUs                 float64  // unlimited if zero
+	MemoryBytes          int64    // unlimited if zero
+	NetworkBandwidthMbit int      // unlimited if zero
+	containerID          string
+}
+
+// The working directory for commands and relative paths, matching the root user's home on SSH targets.
+const dockerWorkDir = "/root"
+
+// Starts the container and applies the network limit. The container idles until Stop is called.
+func (t *DockerTarget) Start() error {
+	args := []string{"run", "-d", "--entrypoint", "sleep", "-w", dockerWorkDir}
+	if t.Name != "" {
+		args = append(args, "--name", t.Name)
+	}
+	if t.Network != "" {
+		args = append(args, "--network", t.Network)
+	}
+	for _, env := range t.Env {
+		args = append(args, "-e", env)
+	}
+	if t.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(t.CPUs, 'f', -1, 64))
+	}
+	if t.MemoryBytes > 0 {
+		// Setting the swap limit equal to the memory limit disables swap
+		args = append(args, "--memory", strconv.FormatInt(t.MemoryBytes, 10), "--memory-swap", strconv.FormatInt(t.MemoryBytes, 10))
+	}
+	if t.NetworkBandwidthMbit > 0 {
+		args = append(args, "--cap-add", "NET_ADMIN")
+	}
+	args = append(args, t.Image, "infinity")
+
+	out, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to start container: %w: %s", err, string(out))
+	}
+	t.containerID = strings.TrimSpace(string(out))
+
+	if t.NetworkBandwidthMbit > 0 {
+		rate := fmt.Sprintf("%dmbit", t.NetworkBandwidthMbit)
+		// Burst must be at least rate / HZ; 1/100 of a second of traffic is plenty
+		burst := fmt.Sprintf("%dkb", max(t.NetworkBandwidthMbit*1000/8/100, 32))
+		os, err := DetectOS(context.Background(), t)
+		if err != nil {
+			return err
+		}
+		out, err = t.RunCommand(context.Background(), fmt.Sprintf(
+			"(command -v tc || (%[3]s)) && "+
+				"tc qdisc add dev eth0 root tbf rate %[1]s burst %[2]s latency 50ms && "+
+				"tc qdisc add dev eth0 handle ffff: ingress && "+
+				"tc filter add dev eth0 parent ffff: matchall action police rate %[1]s burst %[2]s drop",
+			rate,
+			burst,
+			os.PackageManager.InstallCommand("iproute2"),
+		))
+		if err != nil {
+			return fmt.Errorf("failed to limit container network bandwidth: %w: %s", err, string(out))
+		}
+	}
+
+	return nil
+}
+
+// Removes the container.
+func (t *DockerTarget) Stop() error {
+	if t.containerID == "" {
+		return nil
+	}
+	out, err := exec.Command("docker", "rm", "-f", t.containerID).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to remove container: %w: %s", err, string(out))
+	}
+	t.containerID = ""
+	return nil
+}
+
+func (t *DockerTarget) RunCommand(ctx context.Context, cmd string) ([]byte, error) {
+	if ctx.Done() == nil {
+		return exec.Command("docker", "exec", "-u", "root", t.containerID, "bash", "-c", cmd).CombinedOutput()
+	}
+
+	// Killing docker exec doesn't stop the command in the container, so it is killed with another docker exec
+	pidFile := newPIDFile()
+	c := exec.CommandContext(ctx, "docker", "exec", "-u", "root", t.containerID, "bash", "-c", killableCommand(cmd, pidFile))
+	c.Cancel = func() error {
+		exec.Command("docker", "exec", "-u", "root", t.containerID, "bash", "-c", killCommand(pidFile)).Run()
+		return c.Process.Kill()
+	}
+	out, err := c.CombinedOutput()
+	if ctx.Err() != nil {
+		return out, ctx.Err()
+	}
+	return out, err
+}
+
+func (t *DockerTarget) StreamCommand(ctx context.Context, cmd string, w io.Writer) error {
+	pidFile := newPIDFile()
+	stderr := &bytes.Buffer{}
+	c := exec.CommandContext(ctx, "docker", "exec", "-u", "root", t.containerID, "bash", "-c", killableCommand(cmd, pidFile))
+	c.Cancel = func() error {
+		exec.Command("docker", "exec", "-u", "root", t.containerID, "bash", "-c", killCommand(pidFile)).Run()
+		return c.Process.Kill()
+	}
+	c.Stdout = w
+	c.Stderr = stderr
+	err := c.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+func (t *DockerTarget) CopyFileTo(localPath io.Reader, remotePath string) error {
+	c := exec.Command("docker", "exec", "-i", "-u", "root", t.containerID, "sh", "-c", `mkdir -p "$(dirname "$1")" && cat > "$1"`, "sh", t.resolve(remotePath))
+	c.Stdin = localPath
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, string(out))
+	}
+	return nil
+}
+
+func (t *DockerTarget) CopyFileFrom(remotePath string, localFile io.Writer) error {
+	stderr := &bytes.Buffer{}
+	c := exec.Command("docker", "exec", "-u", "root", t.containerID, "cat", t.resolve(remotePath))
+	c.Stdout = localFile
+	c.Stderr = stderr
+	err := c.Run()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+func (t *DockerTarget) NewSession() (Session, error) {
+	return &dockerSession{target: t}, nil
+}
+
+func (t *DockerTarget) resolve(p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join(dockerWorkDir, p)
+}
+
+type dockerSession struct {
+	target *DockerTarget
+}
+
+func (s *dockerSession) RunCommand(cmd string) ([]byte, error) {
+	return s.target.RunCommand(context.Background(), cmd)
+}
+
+func (s *dockerSession) Close() error {
+	return nil
+}
@@ -0,0 +1,33 @@
+package target
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Returns a new path for a pid file on a target.
+func newPIDFile() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return "/tmp/s3benchmark-" + hex.EncodeToString(id) + ".pid"
+}
+
+// Wraps cmd so that it runs in a new process group whose ID is written to pidFile. Canceling a command which is run
+// this way uses killCommand to kill everything it started, rather than only the remote shell.
+func killableCommand(cmd, pidFile string) string {
+	return fmt.Sprintf("setsid bash -c %s & echo $! > %s; wait $!; rc=$?; rm -f %s; exit $rc", shellQuote(cmd), pidFile, pidFile)
+}
+
+// Kills the process group of a command wrapped by killableCommand. Waits briefly for the pid file in case the command
+// was canceled right after it started.
+func killCommand(pidFile string) string {
+	return fmt.Sprintf("for i in $(seq 20); do [ -s %[1]s ] && break; sleep 0.1; done; "+
+		"[ -s %[1]s ] && kill -KILL -- -$(cat %[1]s); rm -f %[1]s", pidFile)
+}
+
+// Quotes s for use as a single word in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
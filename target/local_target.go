@@ -0,0 +1,160 @@
+package target
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Runs commands on the current machine inside a working directory. Commands start in that directory with HOME set to
+// it. Files copied to or from the target must be inside it: relative paths and ~ resolve inside it, and paths which
+// escape it are rejected, so benchmarks don't write all over the machine. Commands themselves aren't sandboxed and run
+// as the current user, not necessarily root, so setup steps which install packages may need the harness to run as
+// root. Static hosts with a LocalDir (e.g. the CLI's -local-dir) run benchmarks on a LocalTarget.
+type LocalTarget struct {
+	Dir string
+}
+
+// Creates a local target in dir. If dir is empty, a new temporary directory is created.
+func NewLocalTarget(dir string) (*LocalTarget, error) {
+	if dir == "" {
+		var err error
+		dir, err = os.MkdirTemp("", "s3benchmark-")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &LocalTarget{Dir: dir}, nil
+}
+
+func (t *LocalTarget) RunCommand(ctx context.Context, cmd string) ([]byte, error) {
+	c := exec.CommandContext(ctx, "bash", "-c", cmd)
+	c.Dir = t.Dir
+	c.Env = append(os.Environ(), "HOME="+t.Dir)
+	// Run in a new process group so that canceling kills everything the command started
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+	c.WaitDelay = 5 * time.Second
+	out, err := c.CombinedOutput()
+	if ctx.Err() != nil {
+		return out, ctx.Err()
+	}
+	return out, err
+}
+
+func (t *LocalTarget) StreamCommand(ctx context.Context, cmd string, w io.Writer) error {
+	stderr := &bytes.Buffer{}
+	c := exec.CommandContext(ctx, "bash", "-c", cmd)
+	c.Dir = t.Dir
+	c.Env = append(os.Environ(), "HOME="+t.Dir)
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+	c.WaitDelay = 5 * time.Second
+	c.Stdout = w
+	c.Stderr = stderr
+	err := c.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+func (t *LocalTarget) CopyFileTo(localPath io.Reader, remotePath string) error {
+	remotePath, err := t.resolve(remotePath)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(remotePath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(remotePath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = dst.ReadFrom(localPath)
+	return err
+}
+
+func (t *LocalTarget) CopyFileFrom(remotePath string, localFile io.Writer) error {
+	remotePath, err := t.resolve(remotePath)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = src.WriteTo(localFile)
+	return err
+}
+
+func (t *LocalTarget) NewSession() (Session, error) {
+	return &localSession{target: t}, nil
+}
+
+// Removes the working directory and everything in it.
+func (t *LocalTarget) Remove() error {
+	return os.RemoveAll(t.Dir)
+}
+
+// Returns the path on this machine for a path on the target. ~ is the working directory, relative paths are inside
+// it, and absolute paths must already be inside it.
+func (t *LocalTarget) resolve(p string) (string, error) {
+	dir, err := filepath.Abs(t.Dir)
+	if err != nil {
+		return "", err
+	}
+	var resolved string
+	switch {
+	case p == "~":
+		resolved = dir
+	case strings.HasPrefix(p, "~/"):
+		resolved = filepath.Join(dir, p[2:])
+	case filepath.IsAbs(p):
+		resolved = filepath.Clean(p)
+	default:
+		resolved = filepath.Join(dir, p)
+	}
+	rel, err := filepath.Rel(dir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("path %s is outside the local target's directory %s", p, t.Dir)
+	}
+	return resolved, nil
+}
+
+type localSession struct {
+	target *LocalTarget
+}
+
+func (s *localSession) RunCommand(cmd string) ([]byte, error) {
+	return s.target.RunCommand(context.Background(), cmd)
+}
+
+func (s *localSession) Close() error {
+	return nil
+}
@@ -0,0 +1,134 @@
+package target
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestTarget(t *testing.T) *LocalTarget {
+	lt, err := NewLocalTarget(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lt
+}
+
+func TestLocalTargetRunCommand(t *testing.T) {
+	lt := newTestTarget(t)
+	out, err := lt.RunCommand(context.Background(), `echo "$PWD $HOME"; echo oops >&2`)
+	if err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+	want := lt.Dir + " " + lt.Dir + "\noops\n"
+	if string(out) != want {
+		t.Errorf("RunCommand returned %q, want %q", out, want)
+	}
+
+	_, err = lt.RunCommand(context.Background(), "exit 3")
+	if err == nil {
+		t.Errorf("RunCommand didn't return an error for a failed command")
+	}
+}
+
+func TestLocalTargetRunCommandCancelKillsProcessGroup(t *testing.T) {
+	lt := newTestTarget(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := lt.RunCommand(ctx, "sleep 30 & echo $! > child.pid; wait")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunCommand returned %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("RunCommand took %v to return after its context was canceled", elapsed)
+	}
+
+	buf, err := os.ReadFile(filepath.Join(lt.Dir, "child.pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the command's child process %d is still running", pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Returns true if the process exists and isn't a zombie waiting to be reaped.
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func TestLocalTargetCopyFile(t *testing.T) {
+	lt := newTestTarget(t)
+	for _, p := range []string{"a/b/file", "~/home-file", filepath.Join(lt.Dir, "abs-file")} {
+		err := lt.CopyFileTo(strings.NewReader("data "+p), p)
+		if err != nil {
+			t.Fatalf("CopyFileTo(%s) failed: %v", p, err)
+		}
+		out := &bytes.Buffer{}
+		err = lt.CopyFileFrom(p, out)
+		if err != nil {
+			t.Fatalf("CopyFileFrom(%s) failed: %v", p, err)
+		}
+		if out.String() != "data "+p {
+			t.Errorf("CopyFileFrom(%s) returned %q", p, out.String())
+		}
+	}
+
+	buf, err := os.ReadFile(filepath.Join(lt.Dir, "home-file"))
+	if err != nil || string(buf) != "data ~/home-file" {
+		t.Errorf("~ didn't resolve to the target's directory: %q, %v", buf, err)
+	}
+
+	for _, p := range []string{"../escaped", "~/../escaped", "/tmp/escaped", filepath.Dir(lt.Dir)} {
+		if err := lt.CopyFileTo(strings.NewReader("data"), p); err == nil {
+			t.Errorf("CopyFileTo(%s) wrote outside the target's directory", p)
+		}
+		if err := lt.CopyFileFrom(p, &bytes.Buffer{}); err == nil {
+			t.Errorf("CopyFileFrom(%s) read outside the target's directory", p)
+		}
+	}
+}
+
+func TestLocalTargetNewSession(t *testing.T) {
+	lt := newTestTarget(t)
+	s, err := lt.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	defer s.Close()
+	for i := range 3 {
+		out, err := s.RunCommand("echo " + strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("session RunCommand failed: %v", err)
+		}
+		if string(out) != strconv.Itoa(i)+"\n" {
+			t.Errorf("session RunCommand returned %q", out)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package target
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+type PackageManager string
+
+const (
+	Apt PackageManager = "apt"
+	Dnf PackageManager = "dnf"
+)
+
+// The operating system of a target, read from /etc/os-release.
+type OS struct {
+	ID             string // e.g. "ubuntu" or "amzn"
+	VersionID      string // e.g. "22.04" or "2023"
+	PackageManager PackageManager
+}
+
+// The architecture of a target as reported by uname -m.
+type Arch string
+
+const (
+	X8664 Arch = "x86_64"
+	Arm64 Arch = "aarch64"
+)
+
+// The architecture's name in GOARCH, which many downloads also use (e.g. "amd64").
+func (a Arch) GoArch() string {
+	switch a {
+	case X8664:
+		return "amd64"
+	case Arm64:
+		return "arm64"
+	default:
+		return string(a)
+	}
+}
+
+// Packages are named as in Debian. These are the names in Fedora-based distributions (e.g. Amazon Linux) which differ.
+var dnfPackageNames = map[string]string{
+	"build-essential": "gcc gcc-c++ make",
+	"libatomic1":      "libatomic",
+	"gfortran":        "gcc-gfortran",
+	"pkg-config":      "pkgconf-pkg-config",
+	"gpg-agent":       "gnupg2",
+	"iproute2":        "iproute",
+	"dnsmasq-base":    "dnsmasq",
+}
+
+func DetectOS(ctx context.Context, t Target) (*OS, error) {
+	out, err := t.RunCommand(ctx, "cat /etc/os-release")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /etc/os-release: %w: %s", err, string(out))
+	}
+	return parseOSRelease(out)
+}
+
+func DetectArch(ctx context.Context, t Target) (Arch, error) {
+	out, err := t.RunCommand(ctx, "uname -m")
+	if err != nil {
+		return "", fmt.Errorf("failed to run uname: %w: %s", err, string(out))
+	}
+	arch := Arch(strings.TrimSpace(string(out)))
+	switch arch {
+	case X8664, Arm64:
+		return arch, nil
+	case "arm64":
+		return Arm64, nil
+	default:
+		return "", fmt.Errorf("unsupported architecture: %s", arch)
+	}
+}
+
+func parseOSRelease(buf []byte) (*OS, error) {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok {
+			fields[key] = strings.Trim(value, `"'`)
+		}
+	}
+
+	os := &OS{ID: fields["ID"], VersionID: fields["VERSION_ID"]}
+	like := strings.Fields(fields["ID_LIKE"])
+	for _, id := range append([]string{os.ID}, like...) {
+		switch id {
+		case "debian", "ubuntu":
+			os.PackageManager = Apt
+		case "fedora", "rhel", "centos", "amzn":
+			os.PackageManager = Dnf
+		}
+		if os.PackageManager != "" {
+			return os, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported OS: %s %s", os.ID, os.VersionID)
+}
+
+// Returns a command which installs the packages, which are named as in Debian.
+func (m PackageManager) InstallCommand(packages ...string) string {
+	switch m {
+	case Dnf:
+		names := []string{}
+		for _, p := range packages {
+			if name, ok := dnfPackageNames[p]; ok {
+				p = name
+			}
+			names = append(names, p)
+		}
+		// Amazon Linux ships curl-minimal, which conflicts with curl
+		return "dnf install -y --allowerasing " + strings.Join(names, " ")
+	default:
+		return "apt-get update -y && DEBIAN_FRONTEND=noninteractive apt-get install -y " + strings.Join(packages, " ")
+	}
+}
+
+// Installs the packages, which are named as in Debian, with the target's package manager.
+func InstallPackages(ctx context.Context, t Target, packages ...string) ([]byte, error) {
+	os, err := DetectOS(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return t.RunCommand(ctx, os.PackageManager.InstallCommand(packages...))
+}
@@ -0,0 +1,83 @@
+package target
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDetectArch(t *testing.T) {
+	tests := []struct {
+		uname   string
+		want    Arch
+		goArch  string
+		wantErr bool
+	}{
+		{uname: "x86_64", want: X8664, goArch: "amd64"},
+		{uname: "aarch64", want: Arm64, goArch: "arm64"},
+		{uname: "arm64", want: Arm64, goArch: "arm64"},
+		{uname: "riscv64", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uname, func(t *testing.T) {
+			lt, err := NewLocalTarget(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Shadow uname with a script that reports the architecture under test
+			err = lt.CopyFileTo(strings.NewReader("#!/bin/sh\necho "+tt.uname+"\n"), "bin/uname")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PATH", lt.Dir+"/bin:/usr/bin:/bin")
+			if out, err := lt.RunCommand(context.Background(), "chmod +x bin/uname"); err != nil {
+				t.Fatalf("chmod failed: %v: %s", err, out)
+			}
+
+			arch, err := DetectArch(context.Background(), lt)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DetectArch returned %s, want an error", arch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DetectArch failed: %v", err)
+			}
+			if arch != tt.want || arch.GoArch() != tt.goArch {
+				t.Errorf("DetectArch returned %s (GOARCH %s), want %s (GOARCH %s)", arch, arch.GoArch(), tt.want, tt.goArch)
+			}
+		})
+	}
+}
+
+func TestParseOSRelease(t *testing.T) {
+	tests := []struct {
+		name    string
+		release string
+		want    PackageManager
+		wantErr bool
+	}{
+		{"ubuntu", "ID=ubuntu\nVERSION_ID=\"22.04\"\nID_LIKE=debian\n", Apt, false},
+		{"amazon linux", "ID=\"amzn\"\nVERSION_ID=\"2023\"\nID_LIKE=\"fedora\"\n", Dnf, false},
+		{"rocky", "ID=\"rocky\"\nVERSION_ID=\"9.3\"\nID_LIKE=\"rhel centos fedora\"\n", Dnf, false},
+		{"alpine", "ID=alpine\nVERSION_ID=3.19.1\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os, err := parseOSRelease([]byte(tt.release))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseOSRelease returned %+v, want an error", os)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOSRelease failed: %v", err)
+			}
+			if os.PackageManager != tt.want {
+				t.Errorf("package manager is %s, want %s", os.PackageManager, tt.want)
+			}
+		})
+	}
+}
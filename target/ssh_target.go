@@ -1,6 +1,8 @@
 package target
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"path"
@@ -16,16 +18,81 @@ type SSHTarget struct {
 	Auths   []ssh.AuthMethod
 }
 
-func (t *SSHTarget) RunCommand(cmd string) ([]byte, error) {
+func (t *SSHTarget) RunCommand(ctx context.Context, cmd string) ([]byte, error) {
 	client, err := t.Client()
 	if err != nil {
 		return nil, err
 	}
+	defer client.Close()
+
 	session, err := client.NewSession()
 	if err != nil {
 		return nil, err
 	}
-	return session.CombinedOutput(cmd)
+	defer session.Close()
+	if ctx.Done() == nil {
+		return session.CombinedOutput(cmd)
+	}
+
+	// Closing the session doesn't stop the remote command, so it is killed over another session
+	pidFile := newPIDFile()
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := session.CombinedOutput(killableCommand(cmd, pidFile))
+		done <- result{out, err}
+	}()
+	select {
+	case r := <-done:
+		return r.out, r.err
+	case <-ctx.Done():
+		killSession, err := client.NewSession()
+		if err == nil {
+			killSession.Run(killCommand(pidFile))
+			killSession.Close()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (t *SSHTarget) StreamCommand(ctx context.Context, cmd string, w io.Writer) error {
+	client, err := t.Client()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	stderr := &bytes.Buffer{}
+	session.Stdout = w
+	session.Stderr = stderr
+
+	pidFile := newPIDFile()
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(killableCommand(cmd, pidFile))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, stderr.String())
+		}
+		return nil
+	case <-ctx.Done():
+		killSession, err := client.NewSession()
+		if err == nil {
+			killSession.Run(killCommand(pidFile))
+			killSession.Close()
+		}
+		return ctx.Err()
+	}
 }
 
 func (t *SSHTarget) CopyFileTo(localPath io.Reader, remotePath string) error {
@@ -77,6 +144,15 @@ func (t *SSHTarget) CopyFileFrom(remotePath string, localFile io.Writer) error {
 	return err
 }
 
+func (t *SSHTarget) NewSession() (Session, error) {
+	client, err := t.Client()
+	if err != nil {
+		return nil, err
+	}
+	return &sshSession{client: client}, nil
+}
+
+// Opens an SSH connection as the target's user.
 func (t *SSHTarget) Client() (*ssh.Client, error) {
 	cfg := &ssh.ClientConfig{
 		User:            *t.User,
@@ -85,3 +161,20 @@ func (t *SSHTarget) Client() (*ssh.Client, error) {
 	}
 	return ssh.Dial("tcp", fmt.Sprintf("%s:%d", *t.IP, t.SSHPort), cfg)
 }
+
+type sshSession struct {
+	client *ssh.Client
+}
+
+func (s *sshSession) RunCommand(cmd string) ([]byte, error) {
+	session, err := s.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return session.CombinedOutput(cmd)
+}
+
+func (s *sshSession) Close() error {
+	return s.client.Close()
+}
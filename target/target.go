@@ -1,15 +1,20 @@
 package target
 
 import (
+	"context"
 	"io"
-
-	"golang.org/x/crypto/ssh"
 )
 
 // A target is something on which you can run a benchmark (usually a server, but could be e.g. a container).
 type Target interface {
-	// Runs the command as the root user and returns the combined output.
-	RunCommand(cmd string) ([]byte, error)
+	// Runs the command as the root user (the current user for LocalTarget) and returns the combined output. If ctx is
+	// canceled, the command and every process it started are killed and ctx.Err() is returned.
+	RunCommand(ctx context.Context, cmd string) ([]byte, error)
+
+	// Runs the command as the root user (the current user for LocalTarget), writing its stdout to w as it is produced.
+	// If ctx is canceled, the command and every process it started are killed and ctx.Err() is returned. Stderr is
+	// included in the error if the command fails.
+	StreamCommand(ctx context.Context, cmd string, w io.Writer) error
 
 	// Copies the local file to the remote, creating the remote path if it does not exist.
 	CopyFileTo(localPath io.Reader, remotePath string) error
@@ -17,6 +22,15 @@ type Target interface {
 	// Copies the remote file to the local file.
 	CopyFileFrom(remotePath string, localFile io.Writer) error
 
-	// Opens an SSH connection as the root user.
-	Client() (*ssh.Client, error)
+	// Opens a long-lived session for running many commands (e.g. polling) without reconnecting each time.
+	NewSession() (Session, error)
+}
+
+// A session runs commands on a target over one connection. Callers must close it when finished.
+type Session interface {
+	// Runs the command as the same user as the target's RunCommand and returns the combined output.
+	// Returns io.EOF if the underlying connection is dead.
+	RunCommand(cmd string) ([]byte, error)
+
+	Close() error
 }
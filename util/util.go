@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -79,3 +80,15 @@ func LastNonEmptyLine(out []byte) string {
 	line := lines[len(lines)-offset]
 	return line
 }
+
+// Sleeps for d, or until ctx is canceled, in which case ctx.Err() is returned.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}